@@ -0,0 +1,81 @@
+//who is calling a chaincode, shared by the chaincodes in this repository. Organisations are
+//told apart by MSP, regulator and QA identities by a role attribute in their certificate.
+package caller
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+//the MSP and certificate id of the caller, as kept in audit records
+func Id(stub shim.ChaincodeStubInterface) (string, error) {
+	mspId, err := cid.GetMSPID(stub)
+	if err != nil {
+		return "", fmt.Errorf("Failed to get caller MSP: %s", err.Error())
+	}
+	Id, err := cid.GetID(stub)
+	if err != nil {
+		return "", fmt.Errorf("Failed to get caller id: %s", err.Error())
+	}
+	return mspId + "/" + Id, nil
+}
+
+//regulator and QA identities carry a role attribute in their enrollment certificate
+func Role(stub shim.ChaincodeStubInterface) (string, error) {
+	Role, found, err := cid.GetAttributeValue(stub, "role")
+	if err != nil {
+		return "", fmt.Errorf("Failed to get caller role: %s", err.Error())
+	} else if !found {
+		return "", nil
+	}
+	return strings.ToLower(Role), nil
+}
+
+//only the given organisations may call
+func RequireMSP(stub shim.ChaincodeStubInterface, MSPs ...string) error {
+	mspId, err := cid.GetMSPID(stub)
+	if err != nil {
+		return fmt.Errorf("Failed to get caller MSP: %s", err.Error())
+	}
+	for _, MSP := range MSPs {
+		if mspId == MSP {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not allowed to do this, expecting %s", mspId, strings.Join(MSPs, " or "))
+}
+
+//the transaction must have been sent to the given chaincode, which passed it on to this one.
+//A called chaincode shares the creator and signed proposal of the transaction, so a client
+//invoking this chaincode directly shows up as this chaincode itself
+func RequireChaincode(stub shim.ChaincodeStubInterface, Chaincode string) error {
+	signedProposal, err := stub.GetSignedProposal()
+	if err != nil {
+		return fmt.Errorf("Failed to get signed proposal: %s", err.Error())
+	}
+	proposal := &pb.Proposal{}
+	err = proto.Unmarshal(signedProposal.ProposalBytes, proposal)
+	if err != nil {
+		return err
+	}
+	payload := &pb.ChaincodeProposalPayload{}
+	err = proto.Unmarshal(proposal.Payload, payload)
+	if err != nil {
+		return err
+	}
+	invocation := &pb.ChaincodeInvocationSpec{}
+	err = proto.Unmarshal(payload.Input, invocation)
+	if err != nil {
+		return err
+	}
+	Invoked := invocation.GetChaincodeSpec().GetChaincodeId().GetName()
+	if Invoked != Chaincode {
+		return fmt.Errorf("only the %s chaincode can call this, the transaction was sent to %s", Chaincode, Invoked)
+	}
+	return nil
+}
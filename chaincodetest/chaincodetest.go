@@ -0,0 +1,457 @@
+//runs the chaincodes of this repository in tests the way a peer does. Chaincodes are installed
+//on a channel and called by client identities. A chaincode called by another one shares its
+//transaction id, creator and signed proposal, and a chaincode already running in a transaction
+//cannot be called again, the peer refuses that with "txid ... exists". Writes are only seen by
+//later transactions and a transaction that fails leaves none behind.
+package chaincodetest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/common"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+//the certificate extension a Fabric CA puts enrollment attributes in
+var attributesOID = asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}
+
+//a channel with the chaincodes installed on it. Now is the timestamp of the next
+//transaction, every transaction moves it on by a second
+type Channel struct {
+	Name   string
+	Now    time.Time
+	stubs  map[string]*Stub
+	height uint64
+	txs    int
+}
+
+//a chaincode installed on a channel, and the stub it is given in every transaction
+type Stub struct {
+	*shim.MockStub
+	channel        *Channel
+	cc             shim.Chaincode
+	args           [][]byte
+	creator        []byte
+	signedProposal *pb.SignedProposal
+	running        bool
+	writes         map[string]*queryresult.KeyModification //pending writes of the transaction
+	event          *pb.ChaincodeEvent
+	history        map[string][]*queryresult.KeyModification
+	Event          *pb.ChaincodeEvent //the event of the last committed transaction
+}
+
+func NewChannel() *Channel {
+	return &Channel{Name: "mychannel", Now: time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC), stubs: map[string]*Stub{}, height: 1}
+}
+
+//install a chaincode under the name other chaincodes invoke it by
+func (c *Channel) Install(Name string, cc shim.Chaincode) *Stub {
+	stub := &Stub{MockStub: shim.NewMockStub(Name, cc), channel: c, cc: cc, history: map[string][]*queryresult.KeyModification{}}
+	stub.ChannelID = c.Name
+	c.stubs[Name] = stub
+	return stub
+}
+
+//the channel the chaincode is installed on, to move its clock
+func (s *Stub) Channel() *Channel {
+	return s.channel
+}
+
+//instantiate the chaincode with the given args
+func (s *Stub) Init(creator []byte, args ...string) pb.Response {
+	return s.channel.submit(s, creator, true, true, args)
+}
+
+//a transaction sent by the client, committed when it succeeds
+func (s *Stub) Invoke(creator []byte, args ...string) pb.Response {
+	return s.channel.submit(s, creator, false, true, args)
+}
+
+//a query sent by the client, its writes are never committed
+func (s *Stub) Query(creator []byte, args ...string) pb.Response {
+	return s.channel.submit(s, creator, false, false, args)
+}
+
+func (c *Channel) submit(stub *Stub, creator []byte, init bool, commit bool, args []string) pb.Response {
+	c.txs++
+	TxId := fmt.Sprintf("tx%04d", c.txs)
+	txTimestamp := &timestamp.Timestamp{Seconds: c.Now.Unix(), Nanos: int32(c.Now.Nanosecond())}
+	c.Now = c.Now.Add(time.Second)
+
+	response := stub.call(TxId, txTimestamp, creator, SignedProposal(stub.Name, args...), util.ToChaincodeArgs(args...), init)
+	commit = commit && response.Status < shim.ERRORTHRESHOLD
+	for _, s := range c.stubs {
+		if commit {
+			s.commit(TxId, txTimestamp)
+		}
+		s.writes = nil
+		s.event = nil
+	}
+	if commit {
+		c.height++
+	}
+	return response
+}
+
+func (s *Stub) call(TxId string, txTimestamp *timestamp.Timestamp, creator []byte, signedProposal *pb.SignedProposal, args [][]byte, init bool) pb.Response {
+	if s.running {
+		return shim.Error(fmt.Sprintf("txid: %s(%s) exists", TxId, s.channel.Name))
+	}
+	s.running = true
+	s.args = args
+	s.creator = creator
+	s.signedProposal = signedProposal
+	s.TxID = TxId
+	s.TxTimestamp = txTimestamp
+	if s.writes == nil {
+		s.writes = map[string]*queryresult.KeyModification{}
+	}
+	defer func() {
+		s.running = false
+	}()
+
+	if init {
+		return s.cc.Init(s)
+	}
+	return s.cc.Invoke(s)
+}
+
+func (s *Stub) commit(TxId string, txTimestamp *timestamp.Timestamp) {
+	if len(s.writes) > 0 {
+		keys := []string{}
+		for key := range s.writes {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		s.MockTransactionStart(TxId)
+		for _, key := range keys {
+			write := s.writes[key]
+			write.Timestamp = txTimestamp
+			if write.IsDelete {
+				s.MockStub.DelState(key)
+			} else {
+				s.MockStub.PutState(key, write.Value)
+			}
+			s.history[key] = append(s.history[key], write)
+		}
+		s.MockTransactionEnd(TxId)
+	}
+	if s.event != nil {
+		s.Event = s.event
+	}
+}
+
+func (s *Stub) GetArgs() [][]byte {
+	return s.args
+}
+
+func (s *Stub) GetStringArgs() []string {
+	args := []string{}
+	for _, arg := range s.args {
+		args = append(args, string(arg))
+	}
+	return args
+}
+
+func (s *Stub) GetFunctionAndParameters() (string, []string) {
+	args := s.GetStringArgs()
+	if len(args) == 0 {
+		return "", []string{}
+	}
+	return args[0], args[1:]
+}
+
+func (s *Stub) GetArgsSlice() ([]byte, error) {
+	argsSlice := []byte{}
+	for _, arg := range s.args {
+		argsSlice = append(argsSlice, arg...)
+	}
+	return argsSlice, nil
+}
+
+func (s *Stub) GetCreator() ([]byte, error) {
+	return s.creator, nil
+}
+
+func (s *Stub) GetSignedProposal() (*pb.SignedProposal, error) {
+	return s.signedProposal, nil
+}
+
+func (s *Stub) GetTransient() (map[string][]byte, error) {
+	return map[string][]byte{}, nil
+}
+
+//the called chaincode runs in the same transaction, qscc answers with the channel height
+func (s *Stub) InvokeChaincode(chaincodeName string, args [][]byte, channel string) pb.Response {
+	if channel != "" && channel != s.channel.Name {
+		return shim.Error("chaincodetest has a single channel " + s.channel.Name)
+	}
+	if chaincodeName == "qscc" {
+		return s.channel.qscc(args)
+	}
+	callee, ok := s.channel.stubs[chaincodeName]
+	if !ok {
+		return shim.Error("chaincode " + chaincodeName + " is not installed")
+	}
+	return callee.call(s.TxID, s.TxTimestamp, s.creator, s.signedProposal, args, false)
+}
+
+func (c *Channel) qscc(args [][]byte) pb.Response {
+	if len(args) == 0 || string(args[0]) != "GetChainInfo" {
+		return shim.Error("chaincodetest only answers qscc GetChainInfo")
+	}
+	chainInfoAsBytes, err := proto.Marshal(&common.BlockchainInfo{Height: c.height})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(chainInfoAsBytes)
+}
+
+func (s *Stub) PutState(key string, value []byte) error {
+	if !s.running {
+		return errors.New("cannot PutState outside a transaction")
+	}
+	if key == "" {
+		return errors.New("key must not be an empty string")
+	}
+	s.writes[key] = &queryresult.KeyModification{TxId: s.TxID, Value: append([]byte(nil), value...)}
+	return nil
+}
+
+func (s *Stub) DelState(key string) error {
+	if !s.running {
+		return errors.New("cannot DelState outside a transaction")
+	}
+	s.writes[key] = &queryresult.KeyModification{TxId: s.TxID, IsDelete: true}
+	return nil
+}
+
+func (s *Stub) SetEvent(name string, payload []byte) error {
+	if name == "" {
+		return errors.New("event name can not be nil string")
+	}
+	s.event = &pb.ChaincodeEvent{ChaincodeId: s.Name, TxId: s.TxID, EventName: name, Payload: payload}
+	return nil
+}
+
+func (s *Stub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	return &historyIterator{modifications: append([]*queryresult.KeyModification(nil), s.history[key]...)}, nil
+}
+
+//a CouchDB selector over the committed state, with the operators the chaincodes use
+func (s *Stub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	parsed := struct {
+		Selector map[string]interface{} `json:"selector"`
+	}{}
+	err := json.Unmarshal([]byte(query), &parsed)
+	if err != nil || parsed.Selector == nil {
+		return nil, fmt.Errorf("invalid query: %s", query)
+	}
+
+	keys := []string{}
+	for key := range s.State {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	results := &queryIterator{}
+	for _, key := range keys {
+		document := map[string]interface{}{}
+		if json.Unmarshal(s.State[key], &document) != nil {
+			continue
+		}
+		matched, err := matches(document, parsed.Selector)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			results.kvs = append(results.kvs, &queryresult.KV{Namespace: s.Name, Key: key, Value: s.State[key]})
+		}
+	}
+	return results, nil
+}
+
+func matches(document map[string]interface{}, selector map[string]interface{}) (bool, error) {
+	for field, condition := range selector {
+		value, found := document[field]
+		operators, ok := condition.(map[string]interface{})
+		if !ok {
+			operators = map[string]interface{}{"$eq": condition}
+		}
+		for operator, operand := range operators {
+			if !found {
+				return false, nil
+			}
+			matched, err := compare(operator, value, operand)
+			if err != nil || !matched {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+func compare(operator string, value interface{}, operand interface{}) (bool, error) {
+	switch operator {
+	case "$eq":
+		return reflect.DeepEqual(value, operand), nil
+	case "$ne":
+		return !reflect.DeepEqual(value, operand), nil
+	case "$in":
+		operands, ok := operand.([]interface{})
+		if !ok {
+			return false, fmt.Errorf("$in needs an array")
+		}
+		for _, operand := range operands {
+			if reflect.DeepEqual(value, operand) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$gt", "$gte", "$lt", "$lte":
+		order := 0
+		if number, ok := value.(float64); ok {
+			other, ok := operand.(float64)
+			if !ok {
+				return false, nil
+			}
+			if number < other {
+				order = -1
+			} else if number > other {
+				order = 1
+			}
+		} else if text, ok := value.(string); ok {
+			other, ok := operand.(string)
+			if !ok {
+				return false, nil
+			}
+			order = strings.Compare(text, other)
+		} else {
+			return false, nil
+		}
+		switch operator {
+		case "$gt":
+			return order > 0, nil
+		case "$gte":
+			return order >= 0, nil
+		case "$lt":
+			return order < 0, nil
+		}
+		return order <= 0, nil
+	}
+	return false, fmt.Errorf("chaincodetest does not support %s in a selector", operator)
+}
+
+type queryIterator struct {
+	kvs []*queryresult.KV
+}
+
+func (it *queryIterator) HasNext() bool {
+	return len(it.kvs) > 0
+}
+
+func (it *queryIterator) Close() error {
+	return nil
+}
+
+func (it *queryIterator) Next() (*queryresult.KV, error) {
+	if len(it.kvs) == 0 {
+		return nil, errors.New("no more results")
+	}
+	kv := it.kvs[0]
+	it.kvs = it.kvs[1:]
+	return kv, nil
+}
+
+type historyIterator struct {
+	modifications []*queryresult.KeyModification
+}
+
+func (it *historyIterator) HasNext() bool {
+	return len(it.modifications) > 0
+}
+
+func (it *historyIterator) Close() error {
+	return nil
+}
+
+func (it *historyIterator) Next() (*queryresult.KeyModification, error) {
+	if len(it.modifications) == 0 {
+		return nil, errors.New("no more history")
+	}
+	modification := it.modifications[0]
+	it.modifications = it.modifications[1:]
+	return modification, nil
+}
+
+//the serialized identity of a client of the MSP, as the creator of a proposal. A role goes
+//in the role attribute of the certificate, the way a Fabric CA enrolls regulator and QA users
+func Identity(MSP string, Role string) []byte {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	Name := "user"
+	if Role != "" {
+		Name = Role
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: Name + "@" + MSP, Organization: []string{MSP}},
+		NotBefore:    time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2035, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if Role != "" {
+		attributes, err := json.Marshal(map[string]map[string]string{"attrs": {"role": Role}})
+		if err != nil {
+			panic(err)
+		}
+		template.ExtraExtensions = []pkix.Extension{{Id: attributesOID, Value: attributes}}
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		panic(err)
+	}
+	identity, err := proto.Marshal(&msp.SerializedIdentity{Mspid: MSP, IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate})})
+	if err != nil {
+		panic(err)
+	}
+	return identity
+}
+
+//the signed proposal of a client invoking the chaincode, as GetSignedProposal returns it
+func SignedProposal(Chaincode string, args ...string) *pb.SignedProposal {
+	invocation, err := proto.Marshal(&pb.ChaincodeInvocationSpec{ChaincodeSpec: &pb.ChaincodeSpec{
+		ChaincodeId: &pb.ChaincodeID{Name: Chaincode}, Input: &pb.ChaincodeInput{Args: util.ToChaincodeArgs(args...)}}})
+	if err != nil {
+		panic(err)
+	}
+	payload, err := proto.Marshal(&pb.ChaincodeProposalPayload{Input: invocation})
+	if err != nil {
+		panic(err)
+	}
+	proposal, err := proto.Marshal(&pb.Proposal{Payload: payload})
+	if err != nil {
+		panic(err)
+	}
+	return &pb.SignedProposal{ProposalBytes: proposal}
+}
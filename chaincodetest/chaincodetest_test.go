@@ -0,0 +1,97 @@
+package chaincodetest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+//writes its args as key and value, reads a key back, calls another chaincode or fails
+type testChaincode struct{}
+
+func (cc *testChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (cc *testChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	function, args := stub.GetFunctionAndParameters()
+	switch function {
+	case "put":
+		err := stub.PutState(args[0], []byte(args[1]))
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if len(args) > 2 {
+			return shim.Error(args[2])
+		}
+		valueAsBytes, _ := stub.GetState(args[0])
+		return shim.Success(valueAsBytes)
+	case "get":
+		valueAsBytes, _ := stub.GetState(args[0])
+		return shim.Success(valueAsBytes)
+	case "call":
+		return stub.InvokeChaincode(args[0], stub.GetArgs()[2:], "")
+	case "whoami":
+		mspId, err := cid.GetMSPID(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		Role, _, err := cid.GetAttributeValue(stub, "role")
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		return shim.Success([]byte(mspId + "/" + Role))
+	}
+	return shim.Error("unknown function " + function)
+}
+
+func TestWritesAreSeenAfterCommit(t *testing.T) {
+	channel := NewChannel()
+	stub := channel.Install("a", new(testChaincode))
+	client := Identity("Org1MSP", "")
+
+	response := stub.Invoke(client, "put", "k", "v")
+	if response.Status != shim.OK || response.Payload != nil {
+		t.Fatalf("put read back %q in its own transaction", response.Payload)
+	}
+	if response = stub.Query(client, "get", "k"); string(response.Payload) != "v" {
+		t.Fatalf("get = %q after commit", response.Payload)
+	}
+}
+
+func TestFailedTransactionLeavesNoWrites(t *testing.T) {
+	channel := NewChannel()
+	stub := channel.Install("a", new(testChaincode))
+	client := Identity("Org1MSP", "")
+
+	stub.Invoke(client, "put", "k", "v", "refused")
+	if _, found := stub.State["k"]; found {
+		t.Fatal("a failed transaction was committed")
+	}
+	stub.Query(client, "put", "k", "v")
+	if _, found := stub.State["k"]; found {
+		t.Fatal("a query was committed")
+	}
+}
+
+func TestCalledChaincodeSharesTransaction(t *testing.T) {
+	channel := NewChannel()
+	a := channel.Install("a", new(testChaincode))
+	channel.Install("b", new(testChaincode))
+
+	response := a.Invoke(Identity("Org1MSP", "qa"), "call", "b", "whoami")
+	if string(response.Payload) != "Org1MSP/qa" {
+		t.Fatalf("called chaincode sees %q, expecting the client Org1MSP/qa", response.Payload)
+	}
+	response = a.Invoke(Identity("Org1MSP", ""), "call", "b", "call", "b", "whoami")
+	if response.Status == shim.OK || !strings.Contains(response.Message, "exists") {
+		t.Fatalf("b called itself in its own transaction: %+v", response)
+	}
+	response = a.Invoke(Identity("Org1MSP", ""), "call", "b", "call", "a", "get", "k")
+	if response.Status == shim.OK || !strings.Contains(response.Message, "exists") {
+		t.Fatalf("b called back into a: %+v", response)
+	}
+}
@@ -0,0 +1,131 @@
+//amounts and unit prices shared by the purchase order (purchaseorder.go) and invoice
+//(invoice.go) chaincodes. Amounts are kept as whole numbers of minor units, unit prices
+//and rates as the decimal text they were given in, and neither ever goes through floating point.
+package currency
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+//ISO 4217 currencies accepted on purchase orders and invoices, with the number of digits
+//after the decimal point of their minor unit
+var MinorUnits = map[string]int{
+	"AUD": 2, "BHD": 3, "BRL": 2, "CAD": 2, "CHF": 2, "CNY": 2, "CZK": 2, "DKK": 2, "EUR": 2,
+	"GBP": 2, "HKD": 2, "HUF": 2, "IDR": 2, "INR": 2, "JPY": 0, "KRW": 0, "KWD": 3, "MXN": 2,
+	"MYR": 2, "NOK": 2, "NZD": 2, "PLN": 2, "SEK": 2, "SGD": 2, "THB": 2, "TND": 3, "TRY": 2,
+	"USD": 2, "VND": 0, "ZAR": 2,
+}
+
+//unit prices may carry this many more decimals than the currency's minor unit, only
+//the amounts of lines are rounded to minor units
+const PriceExtraDigits = 4
+
+//whether text is an unsigned decimal such as "12", "0.0125" or "2.5", and how many decimals it has.
+//No sign, exponent or fraction, so it reads back the same in every language
+func IsDecimal(text string) (bool, int) {
+	units, fraction := text, ""
+	if i := strings.Index(text, "."); i >= 0 {
+		units, fraction = text[:i], text[i+1:]
+	}
+	if units == "" || strings.Trim(units+fraction, "0123456789") != "" {
+		return false, 0
+	}
+	return true, len(fraction)
+}
+
+//a decimal amount such as "12.50" as a whole number of minor units of the currency (1250
+//cents). More decimals than the currency has are refused rather than rounded
+func ParseAmount(amount string, Currency string) (int64, error) {
+	digits, ok := MinorUnits[Currency]
+	if !ok {
+		return 0, fmt.Errorf("%s is not a supported ISO 4217 currency code", Currency)
+	}
+	amount = strings.TrimSpace(amount)
+	decimal, decimals := IsDecimal(amount)
+	if !decimal || decimals > digits {
+		return 0, fmt.Errorf("%q is not an amount in %s", amount, Currency)
+	}
+	units := strings.Replace(amount, ".", "", 1)
+	minor, err := strconv.ParseInt(units+strings.Repeat("0", digits-decimals), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an amount in %s", amount, Currency)
+	}
+	return minor, nil
+}
+
+//a unit price such as "0.0125" checked and kept as the decimal text it was given in
+func ParsePrice(price string, Currency string) (string, error) {
+	digits, ok := MinorUnits[Currency]
+	if !ok {
+		return "", fmt.Errorf("%s is not a supported ISO 4217 currency code", Currency)
+	}
+	price = strings.TrimSpace(price)
+	decimal, decimals := IsDecimal(price)
+	if !decimal || decimals > digits+PriceExtraDigits {
+		return "", fmt.Errorf("%q is not a unit price in %s, expecting at most %d decimals", price, Currency, digits+PriceExtraDigits)
+	}
+	return price, nil
+}
+
+//quantity times unit price in minor units of the currency, rounded half away from zero
+func LineAmount(Quantity int64, UnitPrice string, Currency string) int64 {
+	price, ok := new(big.Rat).SetString(UnitPrice)
+	if !ok {
+		return 0
+	}
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(MinorUnits[Currency])), nil)
+	amount := new(big.Rat).Mul(new(big.Rat).SetInt64(Quantity), price)
+	return roundMinor(amount.Mul(amount, new(big.Rat).SetInt(scale)))
+}
+
+//an amount in minor units of one currency converted at the decimal rate to minor units
+//of the other, rounded half away from zero
+func Convert(amount int64, From string, To string, Rate string) int64 {
+	rate, _ := new(big.Rat).SetString(Rate)
+	converted := new(big.Rat).Mul(new(big.Rat).SetInt64(amount), rate)
+	shift := MinorUnits[To] - MinorUnits[From]
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(shift))), nil))
+	if shift >= 0 {
+		converted.Mul(converted, scale)
+	} else {
+		converted.Quo(converted, scale)
+	}
+	return roundMinor(converted)
+}
+
+//minor units back as a decimal amount, for messages
+func Format(minor int64, Currency string) string {
+	digits := MinorUnits[Currency]
+	sign := ""
+	if minor < 0 {
+		sign, minor = "-", -minor
+	}
+	text := fmt.Sprintf("%0*d", digits+1, minor)
+	if digits == 0 {
+		return sign + text + " " + Currency
+	}
+	return sign + text[:len(text)-digits] + "." + text[len(text)-digits:] + " " + Currency
+}
+
+//a fraction of minor units rounded half away from zero
+func roundMinor(minor *big.Rat) int64 {
+	rounded := new(big.Rat).Set(minor)
+	half := big.NewRat(1, 2)
+	if rounded.Sign() < 0 {
+		rounded.Sub(rounded, half)
+	} else {
+		rounded.Add(rounded, half)
+	}
+	// Quo truncates toward zero
+	return new(big.Int).Quo(rounded.Num(), rounded.Denom()).Int64()
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,128 @@
+package currency
+
+import "testing"
+
+func TestParsePrice(t *testing.T) {
+	valid := []struct{ price, currency string }{{"12.50", "EUR"}, {"0.0125", "EUR"}, {"0.123456", "EUR"}, {"120", "JPY"}, {"1.2345", "JPY"}, {"0.1234567", "KWD"}}
+	for _, test := range valid {
+		if _, err := ParsePrice(test.price, test.currency); err != nil {
+			t.Errorf("ParsePrice(%q, %s): %s", test.price, test.currency, err)
+		}
+	}
+	invalid := []struct{ price, currency string }{{"0.1234567", "EUR"}, {"1.23456", "JPY"}, {"-1", "EUR"}, {"1e3", "EUR"}, {"abc", "EUR"}, {".5", "EUR"}, {"1", "XXX"}}
+	for _, test := range invalid {
+		if _, err := ParsePrice(test.price, test.currency); err == nil {
+			t.Errorf("ParsePrice(%q, %s) accepted", test.price, test.currency)
+		}
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		amount   string
+		currency string
+		want     int64
+	}{
+		{"12.50", "EUR", 1250},
+		{"12.5", "EUR", 1250},
+		{"12", "EUR", 1200},
+		{"1200", "JPY", 1200},
+		{"1.234", "KWD", 1234},
+	}
+	for _, test := range tests {
+		got, err := ParseAmount(test.amount, test.currency)
+		if err != nil || got != test.want {
+			t.Errorf("ParseAmount(%q, %s) = %d, %v, want %d", test.amount, test.currency, got, err, test.want)
+		}
+	}
+	for _, amount := range []string{"12.505", "-1", "+1", ".5", "abc"} {
+		if _, err := ParseAmount(amount, "EUR"); err == nil {
+			t.Errorf("ParseAmount(%q, EUR) accepted", amount)
+		}
+	}
+}
+
+func TestIsDecimal(t *testing.T) {
+	tests := []struct {
+		text     string
+		decimal  bool
+		decimals int
+	}{
+		{"12", true, 0},
+		{"2.5", true, 1},
+		{"0.0125", true, 4},
+		{"-1", false, 0},
+		{"1e3", false, 0},
+		{"1/3", false, 0},
+		{".5", false, 0},
+		{"", false, 0},
+	}
+	for _, test := range tests {
+		if decimal, decimals := IsDecimal(test.text); decimal != test.decimal || decimals != test.decimals {
+			t.Errorf("IsDecimal(%q) = %v, %d, want %v, %d", test.text, decimal, decimals, test.decimal, test.decimals)
+		}
+	}
+}
+
+func TestLineAmount(t *testing.T) {
+	tests := []struct {
+		quantity  int64
+		unitPrice string
+		currency  string
+		want      int64
+	}{
+		{100, "12.50", "EUR", 125000},
+		{3, "0.0125", "EUR", 4}, // 3.75 cents
+		{1, "0.005", "EUR", 1},  // half a cent rounds away from zero
+		{1, "0.0049", "EUR", 0},
+		{7, "123", "JPY", 861},
+		{1, "0.0005", "KWD", 1},
+	}
+	for _, test := range tests {
+		if got := LineAmount(test.quantity, test.unitPrice, test.currency); got != test.want {
+			t.Errorf("LineAmount(%d, %q, %s) = %d, want %d", test.quantity, test.unitPrice, test.currency, got, test.want)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		amount   int64
+		from, to string
+		rate     string
+		want     int64
+	}{
+		{10000, "EUR", "USD", "1.0823", 10823},
+		{-1050, "EUR", "USD", "1.0823", -1136}, // -1136.415
+		{1050, "EUR", "JPY", "161.2345", 1693}, // 1692.96225 yen
+		{1693, "JPY", "EUR", "0.006202", 1050}, // 1049.9986 cents
+		{1234, "KWD", "USD", "3.25", 401},      // 401.05 cents
+		{100, "EUR", "USD", "1.005", 101},      // 100.5 rounds away from zero
+		{-100, "EUR", "USD", "1.005", -101},
+		{10, "EUR", "USD", "1.005", 10},
+	}
+	for _, test := range tests {
+		if got := Convert(test.amount, test.from, test.to, test.rate); got != test.want {
+			t.Errorf("Convert(%d %s to %s at %s) = %d, want %d", test.amount, test.from, test.to, test.rate, got, test.want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		minor    int64
+		currency string
+		want     string
+	}{
+		{1250, "EUR", "12.50 EUR"},
+		{5, "EUR", "0.05 EUR"},
+		{-1136, "USD", "-11.36 USD"},
+		{1693, "JPY", "1693 JPY"},
+		{1234, "KWD", "1.234 KWD"},
+	}
+	for _, test := range tests {
+		if got := Format(test.minor, test.currency); got != test.want {
+			t.Errorf("Format(%d, %s) = %q, want %q", test.minor, test.currency, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+//GS1 identifiers shared by the product (tracktrace.go) and shipment (painting.go) chaincodes.
+//GTINs identify trade items and SSCCs logistic units such as cases, pallets and shipments,
+//both end in a mod 10 check digit.
+package gs1
+
+import "strings"
+
+//GTIN-8, -12, -13 and -14 all carry a GS1 mod 10 check digit
+func IsValidGTIN(gtin string) bool {
+	switch len(gtin) {
+	case 8, 12, 13, 14:
+		return HasValidCheckDigit(gtin)
+	}
+	return false
+}
+
+//an SSCC identifies a logistic unit such as a case or pallet
+func IsValidSSCC(sscc string) bool {
+	return len(sscc) == 18 && HasValidCheckDigit(sscc)
+}
+
+//an SSCC read from a label can carry the (00) application identifier in front, the bare
+//18 digits are what is stored and looked up
+func NormalizeSSCC(sscc string) string {
+	return strings.TrimPrefix(sscc, "(00)")
+}
+
+//weights alternate 3, 1, 3... starting from the digit next to the check digit
+func HasValidCheckDigit(digits string) bool {
+	if digits == "" {
+		return false
+	}
+	sum := 0
+	for i := len(digits) - 2; i >= 0; i-- {
+		digit := int(digits[i] - '0')
+		if digit < 0 || digit > 9 {
+			return false
+		}
+		if (len(digits)-2-i)%2 == 0 {
+			sum += digit * 3
+		} else {
+			sum += digit
+		}
+	}
+	check := int(digits[len(digits)-1] - '0')
+	return check >= 0 && check <= 9 && (10-sum%10)%10 == check
+}
@@ -0,0 +1,43 @@
+package gs1
+
+import "testing"
+
+func TestIsValidGTIN(t *testing.T) {
+	for _, gtin := range []string{"96385074", "036000291452", "4006381333931", "09506000134352"} {
+		if !IsValidGTIN(gtin) {
+			t.Errorf("IsValidGTIN(%q) = false", gtin)
+		}
+	}
+	// wrong check digit, wrong length, not digits
+	for _, gtin := range []string{"09506000134353", "0950600013435", "950600013435", "0950600013435A", "", "1"} {
+		if IsValidGTIN(gtin) {
+			t.Errorf("IsValidGTIN(%q) = true", gtin)
+		}
+	}
+}
+
+func TestIsValidSSCC(t *testing.T) {
+	for _, sscc := range []string{"106141412345678908", "340123450000000017"} {
+		if !IsValidSSCC(sscc) {
+			t.Errorf("IsValidSSCC(%q) = false", sscc)
+		}
+	}
+	for _, sscc := range []string{"106141412345678909", "(00)106141412345678908", "10614141234567890", "09506000134352"} {
+		if IsValidSSCC(sscc) {
+			t.Errorf("IsValidSSCC(%q) = true", sscc)
+		}
+	}
+}
+
+func TestNormalizeSSCC(t *testing.T) {
+	tests := []struct{ sscc, want string }{
+		{"(00)106141412345678908", "106141412345678908"},
+		{"106141412345678908", "106141412345678908"},
+		{"2", "2"},
+	}
+	for _, test := range tests {
+		if got := NormalizeSSCC(test.sscc); got != test.want {
+			t.Errorf("NormalizeSSCC(%q) = %q, want %q", test.sscc, got, test.want)
+		}
+	}
+}
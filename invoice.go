@@ -0,0 +1,1663 @@
+//peer chaincode instantiate -n invoice -v 0 -c '{"Args":["init","CentralTreasuryMSP"]}' -C myc
+//peer chaincode invoke -n invoice -c '{"Args":["setTolerances","2","5"]}' -C myc
+//peer chaincode invoke -n invoice -c '{"Args":["submitInvoice","INV-9001","4500001","2018-09-30","EUR","10","240","12.50","3000.00"]}' -C myc
+//peer chaincode invoke -n invoice -c '{"Args":["matchInvoice","FlextronicsMSP","INV-9001"]}' -C myc
+//peer chaincode invoke -n invoice -c '{"Args":["releaseInvoice","FlextronicsMSP","INV-9001","price increase agreed by phone"]}' -C myc
+//peer chaincode invoke -n invoice -c '{"Args":["rejectInvoice","FlextronicsMSP","INV-9001","duplicate of INV-8990"]}' -C myc
+//peer chaincode query -n invoice -c '{"Args":["getInvoice","FlextronicsMSP","INV-9001"]}' -C myc
+//peer chaincode query -n invoice -c '{"Args":["getInvoicesForPO","4500001"]}' -C myc
+//peer chaincode invoke -n invoice -c '{"Args":["generateSelfBillingInvoice","4500002","2018-10-01","2018-10-31"]}' -C myc
+//peer chaincode invoke -n invoice -c '{"Args":["recordPayment","PAY-120","SEPA-2018-10-05-0042","2018-10-05","EUR","FlextronicsMSP","INV-9001","2000.00","INV-9002","310.00"]}' -C myc
+//peer chaincode query -n invoice -c '{"Args":["getPayment","PAY-120"]}' -C myc
+//peer chaincode query -n invoice -c '{"Args":["getSupplierBalance","SchneiderMSP","FlextronicsMSP"]}' -C myc
+//peer chaincode invoke -n invoice -c '{"Args":["issueAdjustmentNote","CREDIT","CN-311","FlextronicsMSP","INV-9001","10","SHORT_DELIVERY","20","250.00","20 pcs short on delivery note DN-7781"]}' -C myc
+//peer chaincode invoke -n invoice -c '{"Args":["acceptAdjustmentNote","FlextronicsMSP","INV-9001","CN-311","agreed"]}' -C myc
+//peer chaincode invoke -n invoice -c '{"Args":["rejectAdjustmentNote","FlextronicsMSP","INV-9001","CN-311","goods arrived with the second delivery"]}' -C myc
+//peer chaincode query -n invoice -c '{"Args":["getAdjustmentNotes","FlextronicsMSP","INV-9001"]}' -C myc
+//peer chaincode invoke -n invoice -c '{"Args":["publishExchangeRate","USD","EUR","0.8714","2018-10-05"]}' -C myc
+//peer chaincode query -n invoice -c '{"Args":["getExchangeRate","USD","EUR","2018-10-07"]}' -C myc
+//peer chaincode query -n invoice -c '{"Args":["getSupplierBalance","SchneiderMSP","FlextronicsMSP","EUR","2018-10-07"]}' -C myc
+
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RinuT/chaincode/caller"
+	"github.com/RinuT/chaincode/currency"
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+type InvoiceChaincode struct {
+}
+
+//a supplier invoice against a purchase order, matched against PO price and received quantity.
+//Invoice ids are the supplier's own numbers, so an invoice is kept under supplier and invoice id
+type Invoice struct {
+	ObjectType        string        `json:"docType"`
+	InvoiceId         string        `json:"InvoiceId"`
+	PONumber          string        `json:"PONumber"`
+	Supplier          string        `json:"Supplier"`
+	Buyer             string        `json:"Buyer"`
+	InvoiceDate       string        `json:"InvoiceDate"`
+	Currency          string        `json:"Currency"`
+	Lines             []InvoiceLine `json:"Lines"`
+	TotalQuantity     int64         `json:"TotalQuantity"`
+	TotalAmount       int64         `json:"TotalAmount"` //amount to be paid, in minor units of Currency
+	Status            string        `json:"Status"`      //MATCHED, ON_HOLD or REJECTED
+	HoldReasons       []string      `json:"HoldReasons"`
+	SubmittedBy       string        `json:"SubmittedBy"`
+	MatchDate         string        `json:"MatchDate"`
+	Comment           string        `json:"Comment"`    //why the buyer released or rejected it
+	SelfBilled        bool          `json:"SelfBilled"` //generated from consignment consumption
+	PeriodFrom        string        `json:"PeriodFrom"`
+	PeriodTo          string        `json:"PeriodTo"`
+	ConsumptionIds    []string      `json:"ConsumptionIds"`
+	PaidAmount        int64         `json:"PaidAmount"`
+	SettlementStatus  string        `json:"SettlementStatus"` //UNPAID, PARTIALLY_PAID, PAID or CREDIT
+	PaymentIds        []string      `json:"PaymentIds"`
+	CreditedAmount    int64         `json:"CreditedAmount"` //accepted credit notes
+	DebitedAmount     int64         `json:"DebitedAmount"`  //accepted debit notes
+	AdjustmentNoteIds []string      `json:"AdjustmentNoteIds"`
+}
+
+//a credit or debit note settling a price or quantity difference on one invoice line
+type AdjustmentNote struct {
+	ObjectType      string `json:"docType"`
+	NoteId          string `json:"NoteId"`
+	NoteType        string `json:"NoteType"` //CREDIT or DEBIT
+	Supplier        string `json:"Supplier"`
+	InvoiceId       string `json:"InvoiceId"`
+	PONumber        string `json:"PONumber"`
+	LineNumber      string `json:"LineNumber"`
+	Reason          string `json:"Reason"`
+	Quantity        int64  `json:"Quantity"` //0 for a price difference
+	Amount          int64  `json:"Amount"`   //in minor units of Currency
+	Currency        string `json:"Currency"`
+	IssuedBy        string `json:"IssuedBy"` //MSP of the side that issued it
+	IssueDate       string `json:"IssueDate"`
+	Comment         string `json:"Comment"`
+	Status          string `json:"Status"` //PROPOSED, ACCEPTED or REJECTED
+	DecidedBy       string `json:"DecidedBy"`
+	DecisionDate    string `json:"DecisionDate"`
+	DecisionComment string `json:"DecisionComment"`
+}
+
+//a payment from buyer to supplier, split over the invoices it settles
+type Payment struct {
+	ObjectType       string       `json:"docType"`
+	PaymentId        string       `json:"PaymentId"`
+	PaymentReference string       `json:"PaymentReference"` //bank reference of the transfer
+	ValueDate        string       `json:"ValueDate"`
+	Buyer            string       `json:"Buyer"`
+	Supplier         string       `json:"Supplier"`
+	Currency         string       `json:"Currency"`
+	Amount           int64        `json:"Amount"` //in minor units of Currency
+	Allocations      []Allocation `json:"Allocations"`
+	RecordedBy       string       `json:"RecordedBy"`
+}
+
+type Allocation struct {
+	InvoiceId string `json:"InvoiceId"`
+	Amount    int64  `json:"Amount"`
+}
+
+//what a buyer owes a supplier in one currency, and in the base currency when one is asked
+//for together with the rate used
+type SupplierBalance struct {
+	Buyer              string           `json:"Buyer"`
+	Supplier           string           `json:"Supplier"`
+	Currency           string           `json:"Currency"`
+	InvoicedAmount     int64            `json:"InvoicedAmount"`
+	PaidAmount         int64            `json:"PaidAmount"`
+	CreditedAmount     int64            `json:"CreditedAmount"`
+	DebitedAmount      int64            `json:"DebitedAmount"`
+	Outstanding        int64            `json:"Outstanding"`
+	BaseCurrency       string           `json:"BaseCurrency"`
+	ExchangeRate       *ExchangeRate    `json:"ExchangeRate"` //empty when Currency is the base currency
+	BaseInvoicedAmount int64            `json:"BaseInvoicedAmount"`
+	BasePaidAmount     int64            `json:"BasePaidAmount"`
+	BaseCreditedAmount int64            `json:"BaseCreditedAmount"`
+	BaseDebitedAmount  int64            `json:"BaseDebitedAmount"`
+	BaseOutstanding    int64            `json:"BaseOutstanding"`
+	Invoices           []InvoiceBalance `json:"Invoices"`
+}
+
+type InvoiceBalance struct {
+	InvoiceId        string `json:"InvoiceId"`
+	TotalAmount      int64  `json:"TotalAmount"`
+	PaidAmount       int64  `json:"PaidAmount"`
+	CreditedAmount   int64  `json:"CreditedAmount"`
+	DebitedAmount    int64  `json:"DebitedAmount"`
+	Outstanding      int64  `json:"Outstanding"`
+	SettlementStatus string `json:"SettlementStatus"`
+}
+
+type InvoiceLine struct {
+	LineNumber       string `json:"LineNumber"`
+	Quantity         int64  `json:"Quantity"`
+	UnitPrice        string `json:"UnitPrice"` //decimal text, may be finer than the minor unit
+	Amount           int64  `json:"Amount"`
+	CreditedQuantity int64  `json:"CreditedQuantity"` //by accepted credit notes
+	DebitedQuantity  int64  `json:"DebitedQuantity"`  //by accepted debit notes
+}
+
+//the rate of one currency against another for a day, as published by the rate publisher.
+//Rate is kept as the decimal text it was published with so conversions are exact
+type ExchangeRate struct {
+	ObjectType  string `json:"docType"`
+	From        string `json:"From"`
+	To          string `json:"To"`
+	Rate        string `json:"Rate"` //units of To for one unit of From
+	RateDate    string `json:"RateDate"`
+	PublishedBy string `json:"PublishedBy"`
+	PublishDate string `json:"PublishDate"`
+	TxId        string `json:"TxId"`
+}
+
+//how far an invoice may stray from the purchase order before it is put on hold, per buyer
+type Tolerances struct {
+	ObjectType      string `json:"docType"`
+	Buyer           string `json:"Buyer"`
+	PricePercent    string `json:"PricePercent"`    //decimal text, like exchange rates
+	QuantityPercent string `json:"QuantityPercent"` //decimal text
+}
+
+//the purchase order as kept by the purchase order chaincode, only the fields matching needs
+type PurchaseOrder struct {
+	PONumber       string   `json:"PONumber"`
+	Buyer          string   `json:"Buyer"`
+	Supplier       string   `json:"Supplier"`
+	Acknowledgment string   `json:"Acknowledgment"`
+	Consignment    bool     `json:"Consignment"`
+	Lines          []POLine `json:"Lines"`
+}
+
+//consignment stock the buyer took into use, as kept by the purchase order chaincode
+type ConsumptionRecord struct {
+	RecordId   string `json:"RecordId"`
+	LineNumber string `json:"LineNumber"`
+	Quantity   int64  `json:"Quantity"`
+}
+
+type POLine struct {
+	LineNumber        string `json:"LineNumber"`
+	Quantity          int64  `json:"Quantity"`
+	Price             string `json:"Price"` //decimal text, may be finer than the minor unit
+	Currency          string `json:"Currency"`
+	DeliveredQuantity int64  `json:"DeliveredQuantity"`
+}
+
+const dateLayout = "2006-01-02"
+
+//why a credit or debit note was issued
+var adjustmentReasons = map[string]bool{
+	"PRICE_VARIANCE":      true,
+	"SHORT_DELIVERY":      true,
+	"ADDITIONAL_DELIVERY": true,
+	"DAMAGED_GOODS":       true,
+	"OTHER":               true,
+}
+
+//the purchase order chaincode (purchaseorder.go) as installed on the same channel
+const purchaseOrderChaincode = "purchaseorder"
+
+//the notification chaincode (notification.go) as installed on the same channel
+const notificationChaincode = "notification"
+
+//used until a buyer sets its own
+var defaultTolerances = Tolerances{ObjectType: "tolerances", PricePercent: "0", QuantityPercent: "0"}
+
+func main() {
+	err := shim.Start(new(InvoiceChaincode))
+	if err != nil {
+		fmt.Printf("Error starting Invoice chaincode: %s", err)
+	}
+}
+
+//args are the MSP id of the organisation that publishes exchange rates. An upgrade
+//without args keeps the one named before
+func (t *InvoiceChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	fmt.Println("- init of invoice chaincode")
+	_, args := stub.GetFunctionAndParameters()
+	if len(args) > 0 {
+		err := stub.PutState("ratePublisher", []byte(strings.TrimSpace(args[0])))
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	return shim.Success(nil)
+}
+
+//invoke function
+
+func (t *InvoiceChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	function, args := stub.GetFunctionAndParameters()
+	fmt.Println("invoke is running " + function)
+
+	// Handle different functions
+	if function == "submitInvoice" {
+		return t.submitInvoice(stub, args)
+	} else if function == "matchInvoice" {
+		return t.matchInvoice(stub, args)
+	} else if function == "releaseInvoice" {
+		return t.releaseInvoice(stub, args)
+	} else if function == "rejectInvoice" {
+		return t.rejectInvoice(stub, args)
+	} else if function == "getInvoice" {
+		return t.getInvoice(stub, args)
+	} else if function == "getInvoicesForPO" {
+		return t.getInvoicesForPO(stub, args)
+	} else if function == "setTolerances" {
+		return t.setTolerances(stub, args)
+	} else if function == "generateSelfBillingInvoice" {
+		return t.generateSelfBillingInvoice(stub, args)
+	} else if function == "recordPayment" {
+		return t.recordPayment(stub, args)
+	} else if function == "getPayment" {
+		return t.getPayment(stub, args)
+	} else if function == "getSupplierBalance" {
+		return t.getSupplierBalance(stub, args)
+	} else if function == "issueAdjustmentNote" {
+		return t.issueAdjustmentNote(stub, args)
+	} else if function == "acceptAdjustmentNote" {
+		return t.acceptAdjustmentNote(stub, args)
+	} else if function == "rejectAdjustmentNote" {
+		return t.rejectAdjustmentNote(stub, args)
+	} else if function == "getAdjustmentNotes" {
+		return t.getAdjustmentNotes(stub, args)
+	} else if function == "publishExchangeRate" {
+		return t.publishExchangeRate(stub, args)
+	} else if function == "getExchangeRate" {
+		return t.getExchangeRate(stub, args)
+	}
+
+	fmt.Println("invoke did not find func: " + function) //error
+	return shim.Error("Received unknown function invocation")
+}
+
+//the supplier submits an invoice, which is matched straight away.
+//args are invoice id, PO number, invoice date, currency and groups of line number,
+//quantity, unit price and amount. Returns the matched invoice
+func (t *InvoiceChaincode) submitInvoice(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 8 || (len(args)-4)%4 != 0 {
+		return shim.Error("Incorrect number of arguments. Expecting invoice id, PO number, invoice date, currency and groups of line number, quantity, unit price and amount")
+	}
+
+	InvoiceId := strings.TrimSpace(args[0])
+	PONumber := args[1]
+	InvoiceDate := args[2]
+	Currency := strings.ToUpper(strings.TrimSpace(args[3]))
+	fmt.Println("- start submitInvoice ", InvoiceId, PONumber)
+
+	if InvoiceId == "" {
+		return shim.Error("Invoice id must not be empty")
+	}
+	_, err := time.Parse(dateLayout, InvoiceDate)
+	if err != nil {
+		return shim.Error("Invoice date must be YYYY-MM-DD")
+	}
+	_, ok := currency.MinorUnits[Currency]
+	if !ok {
+		return shim.Error(Currency + " is not a supported ISO 4217 currency code")
+	}
+
+	purchaseOrder, err := getPurchaseOrder(stub, PONumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = caller.RequireMSP(stub, purchaseOrder.Supplier)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// ==== Check if invoice already exists ====
+	_, found, err := findInvoice(stub, purchaseOrder.Supplier, InvoiceId)
+	if err != nil {
+		return shim.Error("Failed to submit invoice: " + err.Error())
+	} else if found {
+		return shim.Error("This invoice already exists: " + InvoiceId)
+	}
+	if purchaseOrder.Consignment {
+		return shim.Error("purchase order " + PONumber + " is a consignment order, it is billed by self-billing invoices")
+	}
+	SubmittedBy, err := caller.Id(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	invoice := Invoice{ObjectType: "invoice", InvoiceId: InvoiceId, PONumber: PONumber, Supplier: purchaseOrder.Supplier,
+		Buyer: purchaseOrder.Buyer, InvoiceDate: InvoiceDate, Currency: Currency, Lines: []InvoiceLine{}, SubmittedBy: SubmittedBy}
+	listed := map[string]bool{}
+	for i := 4; i < len(args); i += 4 {
+		line := InvoiceLine{LineNumber: args[i]}
+		if listed[line.LineNumber] {
+			return shim.Error("Line " + line.LineNumber + " is listed more than once")
+		}
+		listed[line.LineNumber] = true
+		line.Quantity, err = strconv.ParseInt(args[i+1], 10, 64)
+		if err != nil || line.Quantity <= 0 {
+			return shim.Error("quantity of line " + line.LineNumber + " must be a positive whole number")
+		}
+		line.UnitPrice, err = currency.ParsePrice(args[i+2], Currency)
+		if err != nil {
+			return shim.Error("unit price of line " + line.LineNumber + ": " + err.Error())
+		}
+		line.Amount, err = currency.ParseAmount(args[i+3], Currency)
+		if err != nil {
+			return shim.Error("amount of line " + line.LineNumber + ": " + err.Error())
+		}
+		invoice.Lines = append(invoice.Lines, line)
+		invoice.TotalQuantity += line.Quantity
+		invoice.TotalAmount += line.Amount
+	}
+
+	err = matchAndPut(stub, &invoice, purchaseOrder)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	invoiceJSONasBytes, err := json.Marshal(invoice)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end submitInvoice (success)", invoice.Status)
+	return shim.Success(invoiceJSONasBytes)
+}
+
+//match an invoice on hold again, for instance once the missing goods were received
+func (t *InvoiceChaincode) matchInvoice(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting supplier and invoice id")
+	}
+
+	Supplier := args[0]
+	InvoiceId := args[1]
+	fmt.Println("- start matchInvoice ", Supplier, InvoiceId)
+
+	invoice, err := getInvoice(stub, Supplier, InvoiceId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = caller.RequireMSP(stub, invoice.Buyer, invoice.Supplier)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if invoice.Status != "ON_HOLD" {
+		return shim.Error("invoice " + InvoiceId + " is " + invoice.Status + ", only invoices on hold are matched again")
+	}
+	purchaseOrder, err := getPurchaseOrder(stub, invoice.PONumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = matchAndPut(stub, &invoice, purchaseOrder)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	invoiceJSONasBytes, err := json.Marshal(invoice)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end matchInvoice (success)", invoice.Status)
+	return shim.Success(invoiceJSONasBytes)
+}
+
+//the buyer accepts an invoice on hold despite its variances
+func (t *InvoiceChaincode) releaseInvoice(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return decideInvoice(stub, args, "MATCHED")
+}
+
+//the buyer refuses an invoice on hold
+func (t *InvoiceChaincode) rejectInvoice(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return decideInvoice(stub, args, "REJECTED")
+}
+
+func (t *InvoiceChaincode) getInvoice(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting supplier and invoice id to query")
+	}
+
+	invoiceKey, err := stub.CreateCompositeKey("invoice", []string{args[0], args[1]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	invoiceAsBytes, err := stub.GetState(invoiceKey)
+	if err != nil {
+		return shim.Error("{\"Error\":\"Failed to get state for " + args[1] + "\"}")
+	} else if invoiceAsBytes == nil {
+		return shim.Error("{\"Error\":\"invoice does not exist: " + args[1] + "\"}")
+	}
+
+	return shim.Success(invoiceAsBytes)
+}
+
+//every invoice submitted against a purchase order
+func (t *InvoiceChaincode) getInvoicesForPO(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting PO number to query")
+	}
+
+	selector := map[string]interface{}{"docType": "invoice", "PONumber": args[0]}
+	queryAsBytes, err := json.Marshal(map[string]interface{}{"selector": selector})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	invoices, err := getInvoicesForQueryString(stub, string(queryAsBytes))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	invoicesAsBytes, err := json.Marshal(invoices)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(invoicesAsBytes)
+}
+
+//the calling buyer sets how far invoices may stray, in percent of PO price and of received quantity
+func (t *InvoiceChaincode) setTolerances(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting price and quantity tolerance in percent")
+	}
+
+	PricePercent := strings.TrimSpace(args[0])
+	if decimal, _ := currency.IsDecimal(PricePercent); !decimal {
+		return shim.Error("Price tolerance must be a positive decimal number of percent")
+	}
+	QuantityPercent := strings.TrimSpace(args[1])
+	if decimal, _ := currency.IsDecimal(QuantityPercent); !decimal {
+		return shim.Error("Quantity tolerance must be a positive decimal number of percent")
+	}
+	Buyer, err := cid.GetMSPID(stub)
+	if err != nil {
+		return shim.Error("Failed to get caller MSP: " + err.Error())
+	}
+	fmt.Println("- start setTolerances ", Buyer, PricePercent, QuantityPercent)
+
+	tolerances := Tolerances{ObjectType: "tolerances", Buyer: Buyer, PricePercent: PricePercent, QuantityPercent: QuantityPercent}
+	toleranceKey, err := stub.CreateCompositeKey("tolerances", []string{Buyer})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	tolerancesJSONasBytes, err := json.Marshal(tolerances)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(toleranceKey, tolerancesJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end setTolerances (success)")
+	return shim.Success(nil)
+}
+
+// ==== Self-billing ====
+
+//bill the consignment stock consumed in a period, so the supplier does not have to
+//type in an invoice. Buyer or supplier may close the period.
+//args are PO number, period start and period end (YYYY-MM-DD). Returns the invoice
+func (t *InvoiceChaincode) generateSelfBillingInvoice(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting PO number, period start and period end")
+	}
+
+	PONumber := args[0]
+	PeriodFrom := args[1]
+	PeriodTo := args[2]
+	fmt.Println("- start generateSelfBillingInvoice ", PONumber, PeriodFrom, PeriodTo)
+
+	for _, date := range []string{PeriodFrom, PeriodTo} {
+		_, err := time.Parse(dateLayout, date)
+		if err != nil {
+			return shim.Error("Period dates must be YYYY-MM-DD")
+		}
+	}
+	if PeriodFrom > PeriodTo {
+		return shim.Error("Period start must not be after period end")
+	}
+
+	purchaseOrder, err := getPurchaseOrder(stub, PONumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = caller.RequireMSP(stub, purchaseOrder.Buyer, purchaseOrder.Supplier)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !purchaseOrder.Consignment {
+		return shim.Error("purchase order " + PONumber + " is not a consignment order")
+	}
+
+	// one self-billing invoice per order and period, numbered on when an earlier one was rejected
+	InvoiceId := "SB-" + PONumber + "-" + PeriodFrom + "-" + PeriodTo
+	for n := 2; ; n++ {
+		earlier, found, err := findInvoice(stub, purchaseOrder.Supplier, InvoiceId)
+		if err != nil {
+			return shim.Error("Failed to generate invoice: " + err.Error())
+		} else if !found {
+			break
+		} else if earlier.Status != "REJECTED" {
+			return shim.Error("This period was already billed on invoice " + InvoiceId)
+		}
+		InvoiceId = "SB-" + PONumber + "-" + PeriodFrom + "-" + PeriodTo + "-" + strconv.Itoa(n)
+	}
+
+	response := stub.InvokeChaincode(purchaseOrderChaincode, util.ToChaincodeArgs("getConsumptions", PONumber, PeriodFrom, PeriodTo), "")
+	if response.Status != shim.OK {
+		return shim.Error("Failed to get consumption of purchase order " + PONumber + ": " + response.Message)
+	}
+	consumptions := []ConsumptionRecord{}
+	err = json.Unmarshal(response.Payload, &consumptions)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	consumed := map[string]int64{}
+	RecordIds := []string{}
+	for _, consumption := range consumptions {
+		billedOn, err := getBillingInvoice(stub, PONumber, consumption.RecordId)
+		if err != nil {
+			return shim.Error(err.Error())
+		} else if billedOn != "" {
+			continue
+		}
+		consumed[consumption.LineNumber] += consumption.Quantity
+		RecordIds = append(RecordIds, consumption.RecordId)
+	}
+	if len(RecordIds) == 0 {
+		return shim.Error("Nothing was consumed on purchase order " + PONumber + " between " + PeriodFrom + " and " + PeriodTo + " that is not billed yet")
+	}
+
+	SubmittedBy, err := caller.Id(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	invoice := Invoice{ObjectType: "invoice", InvoiceId: InvoiceId, PONumber: PONumber, Supplier: purchaseOrder.Supplier,
+		Buyer: purchaseOrder.Buyer, InvoiceDate: PeriodTo, Lines: []InvoiceLine{}, SubmittedBy: SubmittedBy,
+		SelfBilled: true, PeriodFrom: PeriodFrom, PeriodTo: PeriodTo, ConsumptionIds: RecordIds}
+	// lines in PO order, priced at the PO price
+	for _, poLine := range purchaseOrder.Lines {
+		Quantity := consumed[poLine.LineNumber]
+		if Quantity == 0 {
+			continue
+		}
+		if invoice.Currency == "" {
+			invoice.Currency = poLine.Currency
+		} else if invoice.Currency != poLine.Currency {
+			return shim.Error("consumed lines of purchase order " + PONumber + " are in more than one currency")
+		}
+		Amount := currency.LineAmount(Quantity, poLine.Price, poLine.Currency)
+		invoice.Lines = append(invoice.Lines, InvoiceLine{LineNumber: poLine.LineNumber, Quantity: Quantity, UnitPrice: poLine.Price, Amount: Amount})
+		invoice.TotalQuantity += Quantity
+		invoice.TotalAmount += Amount
+	}
+
+	err = matchAndPut(stub, &invoice, purchaseOrder)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	invoiceJSONasBytes, err := json.Marshal(invoice)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end generateSelfBillingInvoice (success)", invoice.Status)
+	return shim.Success(invoiceJSONasBytes)
+}
+
+// ==== Payments ====
+
+//the buyer records a payment to a supplier covering one or more matched invoices, in
+//part or in full.
+//args are payment id, payment reference, value date, currency, supplier and groups of invoice id and amount
+func (t *InvoiceChaincode) recordPayment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 7 || (len(args)-5)%2 != 0 {
+		return shim.Error("Incorrect number of arguments. Expecting payment id, payment reference, value date, currency, supplier and groups of invoice id and amount")
+	}
+
+	PaymentId := strings.TrimSpace(args[0])
+	PaymentReference := strings.TrimSpace(args[1])
+	ValueDate := args[2]
+	Currency := strings.ToUpper(strings.TrimSpace(args[3]))
+	Supplier := args[4]
+	fmt.Println("- start recordPayment ", PaymentId, PaymentReference)
+
+	if PaymentId == "" || PaymentReference == "" {
+		return shim.Error("Payment id and payment reference must not be empty")
+	}
+	_, err := time.Parse(dateLayout, ValueDate)
+	if err != nil {
+		return shim.Error("Value date must be YYYY-MM-DD")
+	}
+	paymentKey, err := stub.CreateCompositeKey("payment", []string{PaymentId})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	paymentAsBytes, err := stub.GetState(paymentKey)
+	if err != nil {
+		return shim.Error("Failed to get payment: " + err.Error())
+	} else if paymentAsBytes != nil {
+		return shim.Error("This payment already exists: " + PaymentId)
+	}
+
+	RecordedBy, err := caller.Id(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	payment := Payment{ObjectType: "payment", PaymentId: PaymentId, PaymentReference: PaymentReference, ValueDate: ValueDate,
+		Supplier: Supplier, Currency: Currency, Allocations: []Allocation{}, RecordedBy: RecordedBy}
+	invoices := []Invoice{}
+	for i := 5; i < len(args); i += 2 {
+		InvoiceId := args[i]
+		Amount, err := currency.ParseAmount(args[i+1], Currency)
+		if err != nil {
+			return shim.Error("amount paid on invoice " + InvoiceId + ": " + err.Error())
+		}
+		if Amount == 0 {
+			return shim.Error("amount paid on invoice " + InvoiceId + " must not be zero")
+		}
+		for _, allocation := range payment.Allocations {
+			if allocation.InvoiceId == InvoiceId {
+				return shim.Error("Invoice " + InvoiceId + " is listed more than once")
+			}
+		}
+
+		invoice, err := getInvoice(stub, Supplier, InvoiceId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if payment.Buyer == "" {
+			payment.Buyer = invoice.Buyer
+		} else if invoice.Buyer != payment.Buyer {
+			return shim.Error("a payment can only cover invoices between one buyer and one supplier")
+		}
+		if invoice.Status != "MATCHED" {
+			return shim.Error("invoice " + InvoiceId + " is " + invoice.Status + ", only matched invoices can be paid")
+		}
+		if invoice.Currency != Currency {
+			return shim.Error("invoice " + InvoiceId + " is in " + invoice.Currency + ", not " + Currency)
+		}
+		outstanding := getOutstanding(invoice)
+		if Amount > outstanding {
+			return shim.Error("invoice " + InvoiceId + " has " + currency.Format(outstanding, Currency) + " outstanding, cannot pay " + currency.Format(Amount, Currency))
+		}
+
+		invoice.PaidAmount += Amount
+		invoice.PaymentIds = append(invoice.PaymentIds, PaymentId)
+		invoice.SettlementStatus = getSettlementStatus(invoice)
+		invoices = append(invoices, invoice)
+		payment.Allocations = append(payment.Allocations, Allocation{InvoiceId: InvoiceId, Amount: Amount})
+		payment.Amount += Amount
+	}
+	err = caller.RequireMSP(stub, payment.Buyer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	for _, invoice := range invoices {
+		err = putInvoice(stub, invoice)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	paymentJSONasBytes, err := json.Marshal(payment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(paymentKey, paymentJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	notify(stub, "PAYMENT_RECORDED", PaymentId, "payment "+PaymentReference+" of "+currency.Format(payment.Amount, Currency)+
+		" with value date "+ValueDate, payment.Supplier)
+
+	fmt.Println("- end recordPayment (success)")
+	return shim.Success(nil)
+}
+
+func (t *InvoiceChaincode) getPayment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting payment id to query")
+	}
+
+	paymentKey, err := stub.CreateCompositeKey("payment", []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	paymentAsBytes, err := stub.GetState(paymentKey)
+	if err != nil {
+		return shim.Error("{\"Error\":\"Failed to get state for " + args[0] + "\"}")
+	} else if paymentAsBytes == nil {
+		return shim.Error("{\"Error\":\"payment does not exist: " + args[0] + "\"}")
+	}
+
+	return shim.Success(paymentAsBytes)
+}
+
+//what a buyer still owes a supplier, per invoice and in total per currency. Both sides
+//read the same ledger records, so they see the same settlement status.
+//args are buyer, supplier and optionally a base currency and the date whose rates to
+//convert at
+func (t *InvoiceChaincode) getSupplierBalance(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 && len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting buyer, supplier and optionally base currency and rate date")
+	}
+
+	Buyer := args[0]
+	Supplier := args[1]
+	selector := map[string]interface{}{"docType": "invoice", "Buyer": Buyer, "Supplier": Supplier, "Status": "MATCHED"}
+	queryAsBytes, err := json.Marshal(map[string]interface{}{"selector": selector})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	invoices, err := getInvoicesForQueryString(stub, string(queryAsBytes))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	balances := []SupplierBalance{}
+	for _, invoice := range invoices {
+		i := -1
+		for j, balance := range balances {
+			if balance.Currency == invoice.Currency {
+				i = j
+			}
+		}
+		if i < 0 {
+			balances = append(balances, SupplierBalance{Buyer: Buyer, Supplier: Supplier, Currency: invoice.Currency, Invoices: []InvoiceBalance{}})
+			i = len(balances) - 1
+		}
+		balance := &balances[i]
+		outstanding := getOutstanding(invoice)
+		balance.InvoicedAmount += invoice.TotalAmount
+		balance.PaidAmount += invoice.PaidAmount
+		balance.CreditedAmount += invoice.CreditedAmount
+		balance.DebitedAmount += invoice.DebitedAmount
+		balance.Outstanding += outstanding
+		balance.Invoices = append(balance.Invoices, InvoiceBalance{InvoiceId: invoice.InvoiceId, TotalAmount: invoice.TotalAmount,
+			PaidAmount: invoice.PaidAmount, CreditedAmount: invoice.CreditedAmount, DebitedAmount: invoice.DebitedAmount, Outstanding: outstanding, SettlementStatus: getSettlementStatus(invoice)})
+	}
+
+	if len(args) == 4 {
+		BaseCurrency := strings.ToUpper(strings.TrimSpace(args[2]))
+		RateDate := args[3]
+		_, ok := currency.MinorUnits[BaseCurrency]
+		if !ok {
+			return shim.Error(BaseCurrency + " is not a supported ISO 4217 currency code")
+		}
+		for i := range balances {
+			balance := &balances[i]
+			balance.BaseCurrency = BaseCurrency
+			if balance.Currency == BaseCurrency {
+				balance.BaseInvoicedAmount = balance.InvoicedAmount
+				balance.BasePaidAmount = balance.PaidAmount
+				balance.BaseCreditedAmount = balance.CreditedAmount
+				balance.BaseDebitedAmount = balance.DebitedAmount
+				balance.BaseOutstanding = balance.Outstanding
+				continue
+			}
+			exchangeRate, err := findExchangeRate(stub, balance.Currency, BaseCurrency, RateDate)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			balance.ExchangeRate = &exchangeRate
+			balance.BaseInvoicedAmount = currency.Convert(balance.InvoicedAmount, exchangeRate.From, exchangeRate.To, exchangeRate.Rate)
+			balance.BasePaidAmount = currency.Convert(balance.PaidAmount, exchangeRate.From, exchangeRate.To, exchangeRate.Rate)
+			balance.BaseCreditedAmount = currency.Convert(balance.CreditedAmount, exchangeRate.From, exchangeRate.To, exchangeRate.Rate)
+			balance.BaseDebitedAmount = currency.Convert(balance.DebitedAmount, exchangeRate.From, exchangeRate.To, exchangeRate.Rate)
+			balance.BaseOutstanding = currency.Convert(balance.Outstanding, exchangeRate.From, exchangeRate.To, exchangeRate.Rate)
+		}
+	}
+
+	balancesAsBytes, err := json.Marshal(balances)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(balancesAsBytes)
+}
+
+//what is still to be paid on an invoice, after accepted credit and debit notes
+func getOutstanding(invoice Invoice) int64 {
+	return invoice.TotalAmount + invoice.DebitedAmount - invoice.CreditedAmount - invoice.PaidAmount
+}
+
+//UNPAID, PARTIALLY_PAID, PAID, or CREDIT when credit notes accepted after payment leave
+//the supplier owing the buyer
+func getSettlementStatus(invoice Invoice) string {
+	switch {
+	case getOutstanding(invoice) < 0:
+		return "CREDIT"
+	case getOutstanding(invoice) == 0:
+		return "PAID"
+	case invoice.PaidAmount > 0:
+		return "PARTIALLY_PAID"
+	}
+	return "UNPAID"
+}
+
+// ==== Credit and debit notes ====
+
+//either side settles a price or quantity difference on a line of a matched invoice. A
+//credit note lowers what the buyer owes, a debit note raises it. The note only counts
+//once the other side accepted it.
+//args are CREDIT or DEBIT, note id, supplier, invoice id, line number, reason, quantity, amount and comment.
+//Quantity is 0 for a price difference, otherwise amount must be quantity times the invoiced unit price
+func (t *InvoiceChaincode) issueAdjustmentNote(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 9 {
+		return shim.Error("Incorrect number of arguments. Expecting CREDIT or DEBIT, note id, supplier, invoice id, line number, reason, quantity, amount and comment")
+	}
+
+	NoteType := strings.ToUpper(strings.TrimSpace(args[0]))
+	NoteId := strings.TrimSpace(args[1])
+	Supplier := args[2]
+	InvoiceId := args[3]
+	Reason := strings.ToUpper(strings.TrimSpace(args[5]))
+	fmt.Println("- start issueAdjustmentNote ", NoteType, NoteId, Supplier, InvoiceId)
+
+	if NoteType != "CREDIT" && NoteType != "DEBIT" {
+		return shim.Error("Note type must be CREDIT or DEBIT")
+	}
+	if NoteId == "" {
+		return shim.Error("Note id must not be empty")
+	}
+	if !adjustmentReasons[Reason] {
+		return shim.Error("Unknown reason " + Reason)
+	}
+	invoice, err := getInvoice(stub, Supplier, InvoiceId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = caller.RequireMSP(stub, invoice.Buyer, invoice.Supplier)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	noteKey, err := stub.CreateCompositeKey("adjustmentnote", []string{Supplier, InvoiceId, NoteId})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	noteAsBytes, err := stub.GetState(noteKey)
+	if err != nil {
+		return shim.Error("Failed to get note: " + err.Error())
+	} else if noteAsBytes != nil {
+		return shim.Error("This note already exists: " + NoteId)
+	}
+
+	Quantity, err := strconv.ParseInt(args[6], 10, 64)
+	if err != nil || Quantity < 0 {
+		return shim.Error("quantity must be a whole number, 0 for a price difference")
+	}
+	Amount, err := currency.ParseAmount(args[7], invoice.Currency)
+	if err != nil {
+		return shim.Error("amount: " + err.Error())
+	}
+	if Amount == 0 {
+		return shim.Error("amount must not be zero")
+	}
+	IssuedBy, err := cid.GetMSPID(stub)
+	if err != nil {
+		return shim.Error("Failed to get caller MSP: " + err.Error())
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	note := AdjustmentNote{ObjectType: "adjustmentnote", NoteId: NoteId, NoteType: NoteType, Supplier: Supplier, InvoiceId: InvoiceId,
+		PONumber: invoice.PONumber, LineNumber: args[4], Reason: Reason, Quantity: Quantity, Amount: Amount, Currency: invoice.Currency,
+		IssuedBy: IssuedBy, IssueDate: txTime.Format(time.RFC3339), Comment: strings.TrimSpace(args[8]), Status: "PROPOSED"}
+	err = checkAdjustmentNote(stub, note, invoice)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putAdjustmentNote(stub, note)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	counterparty := invoice.Supplier
+	if IssuedBy == invoice.Supplier {
+		counterparty = invoice.Buyer
+	}
+	notify(stub, "ADJUSTMENT_NOTE", InvoiceId, strings.ToLower(NoteType)+" note "+NoteId+" of "+currency.Format(Amount, invoice.Currency)+
+		" on invoice "+InvoiceId+" waits for your decision", counterparty)
+
+	fmt.Println("- end issueAdjustmentNote (success)")
+	return shim.Success(nil)
+}
+
+//the other side accepts a note, which then adjusts the outstanding balance of the invoice
+//and, for quantity notes, the quantity billed on the PO line
+func (t *InvoiceChaincode) acceptAdjustmentNote(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting supplier, invoice id, note id and comment")
+	}
+
+	Supplier := args[0]
+	InvoiceId := args[1]
+	NoteId := args[2]
+	fmt.Println("- start acceptAdjustmentNote ", Supplier, InvoiceId, NoteId)
+
+	invoice, note, err := getOpenAdjustmentNote(stub, Supplier, InvoiceId, NoteId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	// the invoice may have been paid or adjusted since the note was issued
+	err = checkAdjustmentNote(stub, note, invoice)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	i := findInvoiceLine(invoice, note.LineNumber)
+	invoiced, err := getInvoicedQuantity(stub, invoice.PONumber, note.LineNumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if note.NoteType == "CREDIT" {
+		invoice.CreditedAmount += note.Amount
+		invoice.Lines[i].CreditedQuantity += note.Quantity
+		invoiced -= note.Quantity
+	} else {
+		invoice.DebitedAmount += note.Amount
+		invoice.Lines[i].DebitedQuantity += note.Quantity
+		invoiced += note.Quantity
+	}
+	invoice.AdjustmentNoteIds = append(invoice.AdjustmentNoteIds, NoteId)
+	if note.Quantity != 0 {
+		err = putInvoicedQuantity(stub, invoice.PONumber, note.LineNumber, invoiced)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	err = putInvoice(stub, invoice)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = decideAdjustmentNote(stub, note, "ACCEPTED", strings.TrimSpace(args[3]))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end acceptAdjustmentNote (success)")
+	return shim.Success(nil)
+}
+
+//the other side turns a note down, the invoice stays as it is
+func (t *InvoiceChaincode) rejectAdjustmentNote(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting supplier, invoice id, note id and comment")
+	}
+
+	Supplier := args[0]
+	InvoiceId := args[1]
+	NoteId := args[2]
+	Comment := strings.TrimSpace(args[3])
+	fmt.Println("- start rejectAdjustmentNote ", Supplier, InvoiceId, NoteId)
+
+	if Comment == "" {
+		return shim.Error("A comment is required to reject a note")
+	}
+	_, note, err := getOpenAdjustmentNote(stub, Supplier, InvoiceId, NoteId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = decideAdjustmentNote(stub, note, "REJECTED", Comment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end rejectAdjustmentNote (success)")
+	return shim.Success(nil)
+}
+
+//all credit and debit notes of an invoice, whatever their status
+func (t *InvoiceChaincode) getAdjustmentNotes(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting supplier and invoice id")
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("adjustmentnote", []string{args[0], args[1]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	notes := []AdjustmentNote{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		note := AdjustmentNote{}
+		err = json.Unmarshal(queryResponse.Value, &note)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		notes = append(notes, note)
+	}
+
+	notesAsBytes, err := json.Marshal(notes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(notesAsBytes)
+}
+
+//a note must fit the invoice line it adjusts. A credit may exceed what is outstanding,
+//leaving the buyer in credit, but not what was billed. A debit for extra quantity needs
+//goods received that are not billed yet
+func checkAdjustmentNote(stub shim.ChaincodeStubInterface, note AdjustmentNote, invoice Invoice) error {
+	if invoice.Status != "MATCHED" {
+		return fmt.Errorf("invoice %s is %s, only matched invoices can be adjusted", invoice.InvoiceId, invoice.Status)
+	}
+	i := findInvoiceLine(invoice, note.LineNumber)
+	if i < 0 {
+		return fmt.Errorf("line %s is not on invoice %s", note.LineNumber, invoice.InvoiceId)
+	}
+	line := invoice.Lines[i]
+	if note.Quantity > 0 && currency.LineAmount(note.Quantity, line.UnitPrice, invoice.Currency) != note.Amount {
+		return fmt.Errorf("amount must be %d times the invoiced unit price of %s %s", note.Quantity, line.UnitPrice, invoice.Currency)
+	}
+
+	if note.NoteType == "CREDIT" {
+		billed := invoice.TotalAmount + invoice.DebitedAmount - invoice.CreditedAmount
+		if note.Amount > billed {
+			return fmt.Errorf("invoice %s has %s billed, cannot credit %s", invoice.InvoiceId,
+				currency.Format(billed, invoice.Currency), currency.Format(note.Amount, invoice.Currency))
+		}
+		if note.Quantity > line.Quantity+line.DebitedQuantity-line.CreditedQuantity {
+			return fmt.Errorf("cannot credit more than the %d billed on line %s", line.Quantity+line.DebitedQuantity-line.CreditedQuantity, line.LineNumber)
+		}
+		return nil
+	}
+
+	if note.Quantity > 0 {
+		purchaseOrder, err := getPurchaseOrder(stub, invoice.PONumber)
+		if err != nil {
+			return err
+		}
+		invoiced, err := getInvoicedQuantity(stub, invoice.PONumber, note.LineNumber)
+		if err != nil {
+			return err
+		}
+		for _, poLine := range purchaseOrder.Lines {
+			if poLine.LineNumber == note.LineNumber && note.Quantity > poLine.DeliveredQuantity-invoiced {
+				return fmt.Errorf("only %d received on line %s is not billed yet", poLine.DeliveredQuantity-invoiced, note.LineNumber)
+			}
+		}
+	}
+	return nil
+}
+
+//a note still waiting for a decision, which only the side that did not issue it may take
+func getOpenAdjustmentNote(stub shim.ChaincodeStubInterface, Supplier string, InvoiceId string, NoteId string) (Invoice, AdjustmentNote, error) {
+	note := AdjustmentNote{}
+	invoice, err := getInvoice(stub, Supplier, InvoiceId)
+	if err != nil {
+		return invoice, note, err
+	}
+	noteKey, err := stub.CreateCompositeKey("adjustmentnote", []string{Supplier, InvoiceId, NoteId})
+	if err != nil {
+		return invoice, note, err
+	}
+	noteAsBytes, err := stub.GetState(noteKey)
+	if err != nil {
+		return invoice, note, fmt.Errorf("Failed to get note: %s", err.Error())
+	} else if noteAsBytes == nil {
+		return invoice, note, fmt.Errorf("note does not exist: %s", NoteId)
+	}
+	err = json.Unmarshal(noteAsBytes, &note)
+	if err != nil {
+		return invoice, note, err
+	}
+	if note.Status != "PROPOSED" {
+		return invoice, note, fmt.Errorf("note %s was already %s", NoteId, strings.ToLower(note.Status))
+	}
+
+	counterparty := invoice.Supplier
+	if note.IssuedBy == invoice.Supplier {
+		counterparty = invoice.Buyer
+	}
+	err = caller.RequireMSP(stub, counterparty)
+	return invoice, note, err
+}
+
+func decideAdjustmentNote(stub shim.ChaincodeStubInterface, note AdjustmentNote, Status string, Comment string) error {
+	DecidedBy, err := caller.Id(stub)
+	if err != nil {
+		return err
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return err
+	}
+	note.Status = Status
+	note.DecidedBy = DecidedBy
+	note.DecisionDate = txTime.Format(time.RFC3339)
+	note.DecisionComment = Comment
+	return putAdjustmentNote(stub, note)
+}
+
+func putAdjustmentNote(stub shim.ChaincodeStubInterface, note AdjustmentNote) error {
+	noteKey, err := stub.CreateCompositeKey("adjustmentnote", []string{note.Supplier, note.InvoiceId, note.NoteId})
+	if err != nil {
+		return err
+	}
+	noteJSONasBytes, err := json.Marshal(note)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(noteKey, noteJSONasBytes)
+}
+
+//index of a line on the invoice, -1 when it is not there
+func findInvoiceLine(invoice Invoice, LineNumber string) int {
+	for i, line := range invoice.Lines {
+		if line.LineNumber == LineNumber {
+			return i
+		}
+	}
+	return -1
+}
+
+// ==== Exchange rates ====
+
+//the rate publisher named at instantiation publishes the rate of one currency against
+//another for a day. Rates are never overwritten, so a report can always point back at
+//the rate it used.
+//args are from currency, to currency, rate and rate date
+func (t *InvoiceChaincode) publishExchangeRate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting from currency, to currency, rate and rate date")
+	}
+
+	From := strings.ToUpper(strings.TrimSpace(args[0]))
+	To := strings.ToUpper(strings.TrimSpace(args[1]))
+	RateDate := args[3]
+	fmt.Println("- start publishExchangeRate ", From, To, RateDate)
+
+	publisherAsBytes, err := stub.GetState("ratePublisher")
+	if err != nil {
+		return shim.Error("Failed to get rate publisher: " + err.Error())
+	} else if publisherAsBytes == nil {
+		return shim.Error("No rate publisher was named when the chaincode was instantiated")
+	}
+	err = caller.RequireMSP(stub, string(publisherAsBytes))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	_, fromKnown := currency.MinorUnits[From]
+	_, toKnown := currency.MinorUnits[To]
+	if !fromKnown || !toKnown || From == To {
+		return shim.Error("Exchange rates are published between two different ISO 4217 currencies")
+	}
+	rate, ok := new(big.Rat).SetString(strings.TrimSpace(args[2]))
+	if !ok || rate.Sign() <= 0 {
+		return shim.Error("Rate must be a positive decimal number")
+	}
+	_, err = time.Parse(dateLayout, RateDate)
+	if err != nil {
+		return shim.Error("Rate date must be YYYY-MM-DD")
+	}
+
+	rateKey, err := stub.CreateCompositeKey("exchangerate", []string{From, To, RateDate})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	rateAsBytes, err := stub.GetState(rateKey)
+	if err != nil {
+		return shim.Error("Failed to get exchange rate: " + err.Error())
+	} else if rateAsBytes != nil {
+		return shim.Error("The " + From + "/" + To + " rate of " + RateDate + " is already published")
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	exchangeRate := ExchangeRate{ObjectType: "exchangerate", From: From, To: To, Rate: strings.TrimSpace(args[2]), RateDate: RateDate,
+		PublishedBy: string(publisherAsBytes), PublishDate: txTime.Format(time.RFC3339), TxId: stub.GetTxID()}
+	rateJSONasBytes, err := json.Marshal(exchangeRate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(rateKey, rateJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end publishExchangeRate (success)")
+	return shim.Success(nil)
+}
+
+//the rate in force on a date, that is the latest one published for that date or before.
+//args are from currency, to currency and date
+func (t *InvoiceChaincode) getExchangeRate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting from currency, to currency and date")
+	}
+
+	exchangeRate, err := findExchangeRate(stub, strings.ToUpper(args[0]), strings.ToUpper(args[1]), args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	rateAsBytes, err := json.Marshal(exchangeRate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(rateAsBytes)
+}
+
+func findExchangeRate(stub shim.ChaincodeStubInterface, From string, To string, Date string) (ExchangeRate, error) {
+	var exchangeRate ExchangeRate
+	_, err := time.Parse(dateLayout, Date)
+	if err != nil {
+		return exchangeRate, fmt.Errorf("rate date must be YYYY-MM-DD")
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("exchangerate", []string{From, To})
+	if err != nil {
+		return exchangeRate, err
+	}
+	defer resultsIterator.Close()
+
+	// keys come in date order, the last one not after Date wins
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return exchangeRate, err
+		}
+		_, keyParts, err := stub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return exchangeRate, err
+		}
+		if keyParts[2] > Date {
+			break
+		}
+		err = json.Unmarshal(queryResponse.Value, &exchangeRate)
+		if err != nil {
+			return exchangeRate, err
+		}
+	}
+	if exchangeRate.RateDate == "" {
+		return exchangeRate, fmt.Errorf("no %s/%s rate was published on or before %s", From, To, Date)
+	}
+	return exchangeRate, nil
+}
+
+// ==== Three-way match ====
+
+//match the invoice against PO price and received quantity and store it. Quantity already
+//billed by other invoices that are matched or on hold does not count as received.
+//The buyer is notified of an invoice on hold, the supplier of a rejected one
+func matchAndPut(stub shim.ChaincodeStubInterface, invoice *Invoice, purchaseOrder PurchaseOrder) error {
+	tolerances, err := getTolerances(stub, purchaseOrder.Buyer)
+	if err != nil {
+		return err
+	}
+	// what this invoice reserved before does not count against itself
+	wasReserving := isReserving(*invoice)
+
+	rejectReasons := []string{}
+	holdReasons := []string{}
+	if purchaseOrder.Acknowledgment != "CONFIRMED" {
+		rejectReasons = append(rejectReasons, "PO_NOT_CONFIRMED")
+	}
+	for _, line := range invoice.Lines {
+		i := -1
+		for j, poLine := range purchaseOrder.Lines {
+			if poLine.LineNumber == line.LineNumber {
+				i = j
+			}
+		}
+		if i < 0 {
+			rejectReasons = append(rejectReasons, "LINE_"+line.LineNumber+"_NOT_ON_PO")
+			continue
+		}
+		poLine := purchaseOrder.Lines[i]
+		if poLine.Currency != invoice.Currency {
+			rejectReasons = append(rejectReasons, "LINE_"+line.LineNumber+"_CURRENCY_"+invoice.Currency+"_NOT_"+poLine.Currency)
+		}
+		if currency.LineAmount(line.Quantity, line.UnitPrice, invoice.Currency) != line.Amount {
+			rejectReasons = append(rejectReasons, "LINE_"+line.LineNumber+"_AMOUNT_IS_NOT_QUANTITY_TIMES_PRICE")
+		}
+
+		invoiced, err := getInvoicedQuantity(stub, invoice.PONumber, line.LineNumber)
+		if err != nil {
+			return err
+		}
+		if wasReserving {
+			invoiced -= line.Quantity
+		}
+		billable := poLine.DeliveredQuantity - invoiced
+		if billable <= 0 {
+			holdReasons = append(holdReasons, "LINE_"+line.LineNumber+"_NOTHING_RECEIVED_TO_BILL")
+		} else if exceedsTolerance(new(big.Rat).SetInt64(line.Quantity), new(big.Rat).SetInt64(billable), tolerances.QuantityPercent) {
+			holdReasons = append(holdReasons, fmt.Sprintf("LINE_%s_QUANTITY_%d_ABOVE_RECEIVED_%d", line.LineNumber, line.Quantity, billable))
+		}
+		// a price below the PO price is in the buyer's favour and passes
+		unitPrice, _ := new(big.Rat).SetString(line.UnitPrice)
+		poPrice, ok := new(big.Rat).SetString(poLine.Price)
+		if !ok {
+			return fmt.Errorf("price of line %s on purchase order %s is not readable", poLine.LineNumber, purchaseOrder.PONumber)
+		}
+		if exceedsTolerance(unitPrice, poPrice, tolerances.PricePercent) {
+			holdReasons = append(holdReasons, fmt.Sprintf("LINE_%s_PRICE_%s_ABOVE_PO_%s", line.LineNumber, line.UnitPrice, poLine.Price))
+		}
+	}
+
+	switch {
+	case len(rejectReasons) > 0:
+		invoice.Status = "REJECTED"
+		invoice.HoldReasons = rejectReasons
+	case len(holdReasons) > 0:
+		invoice.Status = "ON_HOLD"
+		invoice.HoldReasons = holdReasons
+	default:
+		invoice.Status = "MATCHED"
+		invoice.HoldReasons = []string{}
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return err
+	}
+	invoice.MatchDate = txTime.Format(time.RFC3339)
+
+	err = reserveQuantities(stub, *invoice, wasReserving, isReserving(*invoice))
+	if err != nil {
+		return err
+	}
+	err = reserveConsumptions(stub, *invoice, wasReserving, isReserving(*invoice))
+	if err != nil {
+		return err
+	}
+	err = putInvoice(stub, *invoice)
+	if err != nil {
+		return err
+	}
+	switch invoice.Status {
+	case "ON_HOLD":
+		notify(stub, "INVOICE_ON_HOLD", invoice.InvoiceId, "invoice "+invoice.InvoiceId+" on purchase order "+invoice.PONumber+
+			" is on hold: "+strings.Join(invoice.HoldReasons, ", "), invoice.Buyer)
+	case "REJECTED":
+		notify(stub, "INVOICE_REJECTED", invoice.InvoiceId, "invoice "+invoice.InvoiceId+" on purchase order "+invoice.PONumber+
+			" was rejected: "+strings.Join(invoice.HoldReasons, ", "), invoice.Supplier)
+	}
+	return nil
+}
+
+//whether value is more than percent above limit. The percent is the decimal text it was
+//set with and compared in exact fractions, never in floating point
+func exceedsTolerance(value *big.Rat, limit *big.Rat, percent string) bool {
+	factor, ok := new(big.Rat).SetString(percent)
+	if !ok {
+		// setTolerances only stores decimals, anything else allows no deviation
+		factor = new(big.Rat)
+	}
+	factor.Add(factor, big.NewRat(100, 1))
+	allowed := new(big.Rat).Mul(limit, factor)
+	return new(big.Rat).Mul(value, big.NewRat(100, 1)).Cmp(allowed) > 0
+}
+
+//the buyer's decision on an invoice on hold, args are supplier, invoice id and comment
+func decideInvoice(stub shim.ChaincodeStubInterface, args []string, Status string) pb.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting supplier, invoice id and comment")
+	}
+
+	Supplier := args[0]
+	InvoiceId := args[1]
+	Comment := strings.TrimSpace(args[2])
+	fmt.Println("- start decideInvoice ", Supplier, InvoiceId, Status)
+
+	if Comment == "" {
+		return shim.Error("A comment is required to release or reject an invoice")
+	}
+	invoice, err := getInvoice(stub, Supplier, InvoiceId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = caller.RequireMSP(stub, invoice.Buyer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if invoice.Status != "ON_HOLD" {
+		return shim.Error("invoice " + InvoiceId + " is " + invoice.Status + ", only invoices on hold can be released or rejected")
+	}
+
+	err = reserveQuantities(stub, invoice, true, Status != "REJECTED")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = reserveConsumptions(stub, invoice, true, Status != "REJECTED")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	invoice.Status = Status
+	invoice.Comment = Comment
+	err = putInvoice(stub, invoice)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end decideInvoice (success)")
+	return shim.Success(nil)
+}
+
+//an invoice holds on to the quantities it bills while it is matched or on hold
+func isReserving(invoice Invoice) bool {
+	return invoice.Status == "MATCHED" || invoice.Status == "ON_HOLD"
+}
+
+//move the quantities an invoice bills on each PO line in or out of the invoiced totals.
+//GetState does not see writes of the same transaction, so each total is written once
+func reserveQuantities(stub shim.ChaincodeStubInterface, invoice Invoice, wasReserving bool, reserving bool) error {
+	if wasReserving == reserving {
+		return nil
+	}
+	for _, line := range invoice.Lines {
+		invoiced, err := getInvoicedQuantity(stub, invoice.PONumber, line.LineNumber)
+		if err != nil {
+			return err
+		}
+		if reserving {
+			invoiced += line.Quantity
+		} else {
+			invoiced -= line.Quantity
+		}
+		err = putInvoicedQuantity(stub, invoice.PONumber, line.LineNumber, invoiced)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//mark the consumption records a self-billing invoice covers as billed while it is matched
+//or on hold, and release them when it is rejected so the period can be billed again
+func reserveConsumptions(stub shim.ChaincodeStubInterface, invoice Invoice, wasReserving bool, reserving bool) error {
+	if !invoice.SelfBilled || wasReserving == reserving {
+		return nil
+	}
+	for _, RecordId := range invoice.ConsumptionIds {
+		billedKey, err := stub.CreateCompositeKey("billedconsumption", []string{invoice.PONumber, RecordId})
+		if err != nil {
+			return err
+		}
+		if !reserving {
+			err = stub.DelState(billedKey)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		billedOn, err := getBillingInvoice(stub, invoice.PONumber, RecordId)
+		if err != nil {
+			return err
+		} else if billedOn != "" {
+			return fmt.Errorf("consumption record %s is already billed on invoice %s", RecordId, billedOn)
+		}
+		err = stub.PutState(billedKey, []byte(invoice.InvoiceId))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//the self-billing invoice a consumption record is billed on, empty when it is not billed
+func getBillingInvoice(stub shim.ChaincodeStubInterface, PONumber string, RecordId string) (string, error) {
+	billedKey, err := stub.CreateCompositeKey("billedconsumption", []string{PONumber, RecordId})
+	if err != nil {
+		return "", err
+	}
+	billedAsBytes, err := stub.GetState(billedKey)
+	if err != nil {
+		return "", err
+	}
+	return string(billedAsBytes), nil
+}
+
+func putInvoicedQuantity(stub shim.ChaincodeStubInterface, PONumber string, LineNumber string, invoiced int64) error {
+	invoicedKey, err := stub.CreateCompositeKey("invoiced", []string{PONumber, LineNumber})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(invoicedKey, []byte(strconv.FormatInt(invoiced, 10)))
+}
+
+//quantity of a PO line billed by invoices that are matched or on hold
+func getInvoicedQuantity(stub shim.ChaincodeStubInterface, PONumber string, LineNumber string) (int64, error) {
+	invoicedKey, err := stub.CreateCompositeKey("invoiced", []string{PONumber, LineNumber})
+	if err != nil {
+		return 0, err
+	}
+	invoicedAsBytes, err := stub.GetState(invoicedKey)
+	if err != nil {
+		return 0, err
+	} else if invoicedAsBytes == nil {
+		return 0, nil
+	}
+	return strconv.ParseInt(string(invoicedAsBytes), 10, 64)
+}
+
+func getTolerances(stub shim.ChaincodeStubInterface, Buyer string) (Tolerances, error) {
+	tolerances := defaultTolerances
+	toleranceKey, err := stub.CreateCompositeKey("tolerances", []string{Buyer})
+	if err != nil {
+		return tolerances, err
+	}
+	tolerancesAsBytes, err := stub.GetState(toleranceKey)
+	if err != nil {
+		return tolerances, err
+	} else if tolerancesAsBytes == nil {
+		return tolerances, nil
+	}
+	err = json.Unmarshal(tolerancesAsBytes, &tolerances)
+	return tolerances, err
+}
+
+// ==== Helpers ====
+
+func getPurchaseOrder(stub shim.ChaincodeStubInterface, PONumber string) (PurchaseOrder, error) {
+	purchaseOrder := PurchaseOrder{}
+	response := stub.InvokeChaincode(purchaseOrderChaincode, util.ToChaincodeArgs("getPurchaseOrder", PONumber), "")
+	if response.Status != shim.OK {
+		return purchaseOrder, fmt.Errorf("Failed to get purchase order %s: %s", PONumber, response.Message)
+	}
+	err := json.Unmarshal(response.Payload, &purchaseOrder)
+	return purchaseOrder, err
+}
+
+func getInvoice(stub shim.ChaincodeStubInterface, Supplier string, InvoiceId string) (Invoice, error) {
+	invoice, found, err := findInvoice(stub, Supplier, InvoiceId)
+	if err != nil {
+		return invoice, err
+	} else if !found {
+		return invoice, fmt.Errorf("invoice %s of %s does not exist", InvoiceId, Supplier)
+	}
+	return invoice, nil
+}
+
+//the invoice a supplier numbered InvoiceId, if there is one
+func findInvoice(stub shim.ChaincodeStubInterface, Supplier string, InvoiceId string) (Invoice, bool, error) {
+	invoice := Invoice{}
+	invoiceKey, err := stub.CreateCompositeKey("invoice", []string{Supplier, InvoiceId})
+	if err != nil {
+		return invoice, false, err
+	}
+	invoiceAsBytes, err := stub.GetState(invoiceKey)
+	if err != nil {
+		return invoice, false, fmt.Errorf("Failed to get invoice: %s", err.Error())
+	} else if invoiceAsBytes == nil {
+		return invoice, false, nil
+	}
+	err = json.Unmarshal(invoiceAsBytes, &invoice)
+	return invoice, err == nil, err
+}
+
+func putInvoice(stub shim.ChaincodeStubInterface, invoice Invoice) error {
+	invoice.SettlementStatus = getSettlementStatus(invoice)
+	invoiceKey, err := stub.CreateCompositeKey("invoice", []string{invoice.Supplier, invoice.InvoiceId})
+	if err != nil {
+		return err
+	}
+	invoiceJSONasBytes, err := json.Marshal(invoice)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(invoiceKey, invoiceJSONasBytes)
+}
+
+func getInvoicesForQueryString(stub shim.ChaincodeStubInterface, queryString string) ([]Invoice, error) {
+	resultsIterator, err := stub.GetQueryResult(queryString)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	invoices := []Invoice{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		invoice := Invoice{}
+		err = json.Unmarshal(queryResponse.Value, &invoice)
+		if err != nil {
+			return nil, err
+		}
+		invoices = append(invoices, invoice)
+	}
+	return invoices, nil
+}
+
+//leave a notification in the inbox of each recipient and emit it as a chaincode event.
+//A transaction carries one event only, so call it once per transaction. Notifying is best
+//effort: a failure is logged and the invoice change it reports is still recorded
+func notify(stub shim.ChaincodeStubInterface, Type string, Reference string, Message string, Recipients ...string) {
+	notifyArgs := append([]string{"notify", Type, Reference, Message}, Recipients...)
+	response := stub.InvokeChaincode(notificationChaincode, util.ToChaincodeArgs(notifyArgs...), "")
+	if response.Status != shim.OK {
+		fmt.Println("- failed to notify " + strings.Join(Recipients, ", ") + ": " + response.Message)
+		return
+	}
+	err := stub.SetEvent("NotificationEvent", response.Payload)
+	if err != nil {
+		fmt.Println("- failed to emit notification event: " + err.Error())
+	}
+}
+
+//the transaction timestamp is the same on every endorser, unlike time.Now()
+func getTxTime(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos)).UTC(), nil
+}
@@ -0,0 +1,611 @@
+package main
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/RinuT/chaincode/chaincodetest"
+	"github.com/RinuT/chaincode/currency"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+//stands in for the notification chaincode and keeps the args of every notify
+type notificationRecorder struct {
+	notified [][]string
+}
+
+func (r *notificationRecorder) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (r *notificationRecorder) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	_, args := stub.GetFunctionAndParameters()
+	r.notified = append(r.notified, args)
+	return shim.Success([]byte("[]"))
+}
+
+//an invoice chaincode stub with a recording notification chaincode next to it
+func newInvoiceStub() (*shim.MockStub, *notificationRecorder) {
+	stub := shim.NewMockStub("invoice", new(InvoiceChaincode))
+	recorder := &notificationRecorder{}
+	stub.MockPeerChaincode(notificationChaincode, shim.NewMockStub(notificationChaincode, recorder))
+	return stub, recorder
+}
+
+//a confirmed purchase order of 100 pieces at 12.50 EUR, 100 of them received
+func newPurchaseOrder() PurchaseOrder {
+	return PurchaseOrder{PONumber: "4500001", Buyer: "SchneiderMSP", Supplier: "FlextronicsMSP", Acknowledgment: "CONFIRMED",
+		Lines: []POLine{{LineNumber: "10", Quantity: 100, Price: "12.50", Currency: "EUR", DeliveredQuantity: 100}}}
+}
+
+//an invoice for one line of the purchase order, totalled the way submitInvoice does
+func newInvoice(InvoiceId string, Quantity int64, UnitPrice string) Invoice {
+	Amount := currency.LineAmount(Quantity, UnitPrice, "EUR")
+	return Invoice{ObjectType: "invoice", InvoiceId: InvoiceId, PONumber: "4500001", Supplier: "FlextronicsMSP", Buyer: "SchneiderMSP",
+		Currency: "EUR", Lines: []InvoiceLine{{LineNumber: "10", Quantity: Quantity, UnitPrice: UnitPrice, Amount: Amount}},
+		TotalQuantity: Quantity, TotalAmount: Amount}
+}
+
+func putTolerances(t *testing.T, stub *shim.MockStub, tolerances Tolerances) {
+	toleranceKey, _ := stub.CreateCompositeKey("tolerances", []string{tolerances.Buyer})
+	tolerancesAsBytes, _ := json.Marshal(tolerances)
+	stub.MockTransactionStart("tolerances")
+	if err := stub.PutState(toleranceKey, tolerancesAsBytes); err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("tolerances")
+}
+
+func match(t *testing.T, stub *shim.MockStub, TxId string, invoice *Invoice, purchaseOrder PurchaseOrder) {
+	stub.MockTransactionStart(TxId)
+	defer stub.MockTransactionEnd(TxId)
+	if err := matchAndPut(stub, invoice, purchaseOrder); err != nil {
+		t.Fatalf("matchAndPut: %s", err)
+	}
+}
+
+func invoicedQuantity(t *testing.T, stub *shim.MockStub) int64 {
+	invoiced, err := getInvoicedQuantity(stub, "4500001", "10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return invoiced
+}
+
+//stands in for the purchase order chaincode with fixed purchase orders and consumption records
+type purchaseOrderStandIn struct {
+	purchaseOrders map[string]PurchaseOrder
+	consumptions   map[string][]ConsumptionRecord
+}
+
+func (s *purchaseOrderStandIn) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (s *purchaseOrderStandIn) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	function, args := stub.GetFunctionAndParameters()
+	var result interface{}
+	switch function {
+	case "getPurchaseOrder":
+		purchaseOrder, found := s.purchaseOrders[args[0]]
+		if !found {
+			return shim.Error("purchase order does not exist: " + args[0])
+		}
+		result = purchaseOrder
+	case "getConsumptions":
+		result = s.consumptions[args[0]]
+	default:
+		return shim.Error("unexpected call " + function)
+	}
+	resultAsBytes, _ := json.Marshal(result)
+	return shim.Success(resultAsBytes)
+}
+
+var (
+	schneider   = chaincodetest.Identity("SchneiderMSP", "")
+	flextronics = chaincodetest.Identity("FlextronicsMSP", "")
+)
+
+//the invoice chaincode on a channel with a purchase order stand-in and a recording
+//notification chaincode. The stand-in starts with newPurchaseOrder as 4500001
+func newInvoiceChannel() (*chaincodetest.Stub, *purchaseOrderStandIn) {
+	channel := chaincodetest.NewChannel()
+	invoices := channel.Install("invoice", new(InvoiceChaincode))
+	purchaseOrders := &purchaseOrderStandIn{purchaseOrders: map[string]PurchaseOrder{"4500001": newPurchaseOrder()},
+		consumptions: map[string][]ConsumptionRecord{}}
+	channel.Install(purchaseOrderChaincode, purchaseOrders)
+	channel.Install(notificationChaincode, &notificationRecorder{})
+	return invoices, purchaseOrders
+}
+
+func invokeOK(t *testing.T, stub *chaincodetest.Stub, creator []byte, args ...string) []byte {
+	t.Helper()
+	response := stub.Invoke(creator, args...)
+	if response.Status != shim.OK {
+		t.Fatalf("%s: %s", args[0], response.Message)
+	}
+	return response.Payload
+}
+
+func invokeFails(t *testing.T, stub *chaincodetest.Stub, creator []byte, want string, args ...string) {
+	t.Helper()
+	response := stub.Invoke(creator, args...)
+	if response.Status == shim.OK || !strings.Contains(response.Message, want) {
+		t.Fatalf("%s: got %q, expecting an error containing %q", args[0], response.Message, want)
+	}
+}
+
+func readInvoice(t *testing.T, invoices *chaincodetest.Stub, Supplier string, InvoiceId string) Invoice {
+	t.Helper()
+	response := invoices.Query(flextronics, "getInvoice", Supplier, InvoiceId)
+	if response.Status != shim.OK {
+		t.Fatal(response.Message)
+	}
+	invoice := Invoice{}
+	if err := json.Unmarshal(response.Payload, &invoice); err != nil {
+		t.Fatal(err)
+	}
+	return invoice
+}
+
+// ==== Three-way match ====
+
+func TestMatchAndPutMatched(t *testing.T) {
+	stub, recorder := newInvoiceStub()
+	invoice := newInvoice("INV-1", 100, "12.50")
+	match(t, stub, "tx1", &invoice, newPurchaseOrder())
+
+	if invoice.Status != "MATCHED" || len(invoice.HoldReasons) != 0 {
+		t.Fatalf("got %s %v, want MATCHED", invoice.Status, invoice.HoldReasons)
+	}
+	stored, err := getInvoice(stub, "FlextronicsMSP", "INV-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != "MATCHED" || stored.SettlementStatus != "UNPAID" || stored.MatchDate == "" {
+		t.Errorf("stored invoice is %s, %s, matched on %q", stored.Status, stored.SettlementStatus, stored.MatchDate)
+	}
+	if got := invoicedQuantity(t, stub); got != 100 {
+		t.Errorf("invoiced quantity is %d, want 100", got)
+	}
+	if len(recorder.notified) != 0 {
+		t.Errorf("a matched invoice notified %v", recorder.notified)
+	}
+}
+
+func TestMatchAndPutHold(t *testing.T) {
+	tests := []struct {
+		name      string
+		quantity  int64
+		unitPrice string
+		delivered int64
+		reason    string
+	}{
+		{"price above PO", 100, "12.51", 100, "LINE_10_PRICE_12.51_ABOVE_PO_12.50"},
+		{"quantity above received", 100, "12.50", 60, "LINE_10_QUANTITY_100_ABOVE_RECEIVED_60"},
+		{"nothing received", 10, "12.50", 0, "LINE_10_NOTHING_RECEIVED_TO_BILL"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stub, recorder := newInvoiceStub()
+			purchaseOrder := newPurchaseOrder()
+			purchaseOrder.Lines[0].DeliveredQuantity = test.delivered
+			invoice := newInvoice("INV-1", test.quantity, test.unitPrice)
+			match(t, stub, "tx1", &invoice, purchaseOrder)
+
+			if invoice.Status != "ON_HOLD" || !reflect.DeepEqual(invoice.HoldReasons, []string{test.reason}) {
+				t.Fatalf("got %s %v, want ON_HOLD [%s]", invoice.Status, invoice.HoldReasons, test.reason)
+			}
+			// an invoice on hold still holds on to what it bills
+			if got := invoicedQuantity(t, stub); got != test.quantity {
+				t.Errorf("invoiced quantity is %d, want %d", got, test.quantity)
+			}
+			if len(recorder.notified) != 1 || recorder.notified[0][0] != "INVOICE_ON_HOLD" || recorder.notified[0][3] != "SchneiderMSP" {
+				t.Errorf("notified %v, want INVOICE_ON_HOLD to the buyer", recorder.notified)
+			}
+		})
+	}
+}
+
+func TestMatchAndPutReject(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*Invoice, *PurchaseOrder)
+		reason string
+	}{
+		{"PO not confirmed", func(invoice *Invoice, purchaseOrder *PurchaseOrder) { purchaseOrder.Acknowledgment = "" }, "PO_NOT_CONFIRMED"},
+		{"line not on PO", func(invoice *Invoice, purchaseOrder *PurchaseOrder) { invoice.Lines[0].LineNumber = "20" }, "LINE_20_NOT_ON_PO"},
+		{"other currency", func(invoice *Invoice, purchaseOrder *PurchaseOrder) { purchaseOrder.Lines[0].Currency = "USD" }, "LINE_10_CURRENCY_EUR_NOT_USD"},
+		{"wrong amount", func(invoice *Invoice, purchaseOrder *PurchaseOrder) { invoice.Lines[0].Amount++ }, "LINE_10_AMOUNT_IS_NOT_QUANTITY_TIMES_PRICE"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stub, recorder := newInvoiceStub()
+			purchaseOrder := newPurchaseOrder()
+			invoice := newInvoice("INV-1", 100, "12.50")
+			test.change(&invoice, &purchaseOrder)
+			match(t, stub, "tx1", &invoice, purchaseOrder)
+
+			if invoice.Status != "REJECTED" || !reflect.DeepEqual(invoice.HoldReasons, []string{test.reason}) {
+				t.Fatalf("got %s %v, want REJECTED [%s]", invoice.Status, invoice.HoldReasons, test.reason)
+			}
+			// a rejected invoice bills nothing
+			if got := invoicedQuantity(t, stub); got != 0 {
+				t.Errorf("invoiced quantity is %d, want 0", got)
+			}
+			if len(recorder.notified) != 1 || recorder.notified[0][0] != "INVOICE_REJECTED" || recorder.notified[0][3] != "FlextronicsMSP" {
+				t.Errorf("notified %v, want INVOICE_REJECTED to the supplier", recorder.notified)
+			}
+		})
+	}
+}
+
+func TestMatchAndPutPriceTolerance(t *testing.T) {
+	stub, _ := newInvoiceStub()
+	putTolerances(t, stub, Tolerances{ObjectType: "tolerances", Buyer: "SchneiderMSP", PricePercent: "2.5"})
+
+	// 12.50 plus 2.5% is exactly 12.8125
+	atLimit := newInvoice("INV-1", 50, "12.8125")
+	match(t, stub, "tx1", &atLimit, newPurchaseOrder())
+	if atLimit.Status != "MATCHED" {
+		t.Errorf("price at the tolerance: got %s %v, want MATCHED", atLimit.Status, atLimit.HoldReasons)
+	}
+	aboveLimit := newInvoice("INV-2", 50, "12.8126")
+	match(t, stub, "tx2", &aboveLimit, newPurchaseOrder())
+	if aboveLimit.Status != "ON_HOLD" {
+		t.Errorf("price above the tolerance: got %s %v, want ON_HOLD", aboveLimit.Status, aboveLimit.HoldReasons)
+	}
+}
+
+func TestMatchAndPutBilledQuantity(t *testing.T) {
+	stub, _ := newInvoiceStub()
+	first := newInvoice("INV-1", 60, "12.50")
+	match(t, stub, "tx1", &first, newPurchaseOrder())
+	second := newInvoice("INV-2", 60, "12.50")
+	match(t, stub, "tx2", &second, newPurchaseOrder())
+
+	if first.Status != "MATCHED" {
+		t.Fatalf("first invoice is %s %v, want MATCHED", first.Status, first.HoldReasons)
+	}
+	// only 40 of the 100 received are left to bill
+	want := []string{"LINE_10_QUANTITY_60_ABOVE_RECEIVED_40"}
+	if second.Status != "ON_HOLD" || !reflect.DeepEqual(second.HoldReasons, want) {
+		t.Fatalf("second invoice is %s %v, want ON_HOLD %v", second.Status, second.HoldReasons, want)
+	}
+	if got := invoicedQuantity(t, stub); got != 120 {
+		t.Errorf("invoiced quantity is %d, want 120", got)
+	}
+
+	// matching the held invoice again does not count its own quantity against it
+	putTolerances(t, stub, Tolerances{ObjectType: "tolerances", Buyer: "SchneiderMSP", QuantityPercent: "50"})
+	match(t, stub, "tx3", &second, newPurchaseOrder())
+	if second.Status != "MATCHED" {
+		t.Errorf("second invoice rematched is %s %v, want MATCHED", second.Status, second.HoldReasons)
+	}
+	if got := invoicedQuantity(t, stub); got != 120 {
+		t.Errorf("invoiced quantity after rematch is %d, want 120", got)
+	}
+}
+
+func TestExceedsTolerance(t *testing.T) {
+	tests := []struct {
+		value   string
+		limit   string
+		percent string
+		want    bool
+	}{
+		{"12.50", "12.50", "0", false},
+		{"12.5001", "12.50", "0", true},
+		{"12.49", "12.50", "0", false},
+		{"12.8125", "12.50", "2.5", false},
+		{"12.8126", "12.50", "2.5", true},
+		// 0.1 has no exact float, it is compared as the decimal text it was set with
+		{"1001", "1000", "0.1", false},
+		{"1002", "1000", "0.1", true},
+	}
+	for _, test := range tests {
+		value, _ := new(big.Rat).SetString(test.value)
+		limit, _ := new(big.Rat).SetString(test.limit)
+		if got := exceedsTolerance(value, limit, test.percent); got != test.want {
+			t.Errorf("exceedsTolerance(%s, %s, %s) = %v, want %v", test.value, test.limit, test.percent, got, test.want)
+		}
+	}
+}
+
+func TestSetTolerancesKeepsDecimalText(t *testing.T) {
+	channel := chaincodetest.NewChannel()
+	stub := channel.Install("invoice", new(InvoiceChaincode))
+	buyer := chaincodetest.Identity("SchneiderMSP", "")
+
+	for _, percent := range []string{"-1", "1e2", "1/3"} {
+		if response := stub.Invoke(buyer, "setTolerances", percent, "5"); response.Status == shim.OK {
+			t.Errorf("setTolerances accepted a price tolerance of %q", percent)
+		}
+	}
+	if response := stub.Invoke(buyer, "setTolerances", "0.1", "5"); response.Status != shim.OK {
+		t.Fatal(response.Message)
+	}
+	toleranceKey, _ := stub.CreateCompositeKey("tolerances", []string{"SchneiderMSP"})
+	tolerances := Tolerances{}
+	if err := json.Unmarshal(stub.State[toleranceKey], &tolerances); err != nil {
+		t.Fatal(err)
+	}
+	if tolerances.PricePercent != "0.1" || tolerances.QuantityPercent != "5" {
+		t.Fatalf("tolerances = %+v, expecting the decimal text 0.1 and 5", tolerances)
+	}
+}
+
+// ==== Currency conversion ====
+
+func TestFindExchangeRate(t *testing.T) {
+	stub, _ := newInvoiceStub()
+	stub.MockTransactionStart("rates")
+	for _, exchangeRate := range []ExchangeRate{
+		{ObjectType: "exchangerate", From: "EUR", To: "USD", Rate: "1.0823", RateDate: "2026-01-02"},
+		{ObjectType: "exchangerate", From: "EUR", To: "USD", Rate: "1.0911", RateDate: "2026-01-05"},
+		{ObjectType: "exchangerate", From: "USD", To: "EUR", Rate: "0.9164", RateDate: "2026-01-03"},
+	} {
+		rateKey, _ := stub.CreateCompositeKey("exchangerate", []string{exchangeRate.From, exchangeRate.To, exchangeRate.RateDate})
+		rateAsBytes, _ := json.Marshal(exchangeRate)
+		if err := stub.PutState(rateKey, rateAsBytes); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stub.MockTransactionEnd("rates")
+
+	tests := []struct {
+		date string
+		want string
+	}{
+		{"2026-01-02", "1.0823"},
+		{"2026-01-04", "1.0823"}, // no rate on the day, the last one before it is in force
+		{"2026-01-05", "1.0911"},
+		{"2026-03-01", "1.0911"},
+	}
+	for _, test := range tests {
+		exchangeRate, err := findExchangeRate(stub, "EUR", "USD", test.date)
+		if err != nil || exchangeRate.Rate != test.want {
+			t.Errorf("EUR/USD rate on %s is %q, %v, want %s", test.date, exchangeRate.Rate, err, test.want)
+		}
+	}
+	if _, err := findExchangeRate(stub, "EUR", "USD", "2026-01-01"); err == nil {
+		t.Error("found a EUR/USD rate before the first one was published")
+	}
+	if _, err := findExchangeRate(stub, "EUR", "GBP", "2026-01-05"); err == nil {
+		t.Error("found a EUR/GBP rate that was never published")
+	}
+	if _, err := findExchangeRate(stub, "EUR", "USD", "05/01/2026"); err == nil {
+		t.Error("accepted a date that is not YYYY-MM-DD")
+	}
+}
+
+// ==== Settlement ====
+
+func TestSettlementStatus(t *testing.T) {
+	tests := []struct {
+		name        string
+		invoice     Invoice
+		outstanding int64
+		want        string
+	}{
+		{"nothing paid", Invoice{TotalAmount: 10000}, 10000, "UNPAID"},
+		{"part paid", Invoice{TotalAmount: 10000, PaidAmount: 4000}, 6000, "PARTIALLY_PAID"},
+		{"paid in full", Invoice{TotalAmount: 10000, PaidAmount: 10000}, 0, "PAID"},
+		{"credit note settles the rest", Invoice{TotalAmount: 10000, PaidAmount: 9000, CreditedAmount: 1000}, 0, "PAID"},
+		{"debit note after payment", Invoice{TotalAmount: 10000, PaidAmount: 10000, DebitedAmount: 500}, 500, "PARTIALLY_PAID"},
+		{"credit note after payment", Invoice{TotalAmount: 10000, PaidAmount: 10000, CreditedAmount: 2500}, -2500, "CREDIT"},
+		{"credited in full before payment", Invoice{TotalAmount: 10000, CreditedAmount: 10000}, 0, "PAID"},
+	}
+	for _, test := range tests {
+		if got := getOutstanding(test.invoice); got != test.outstanding {
+			t.Errorf("%s: outstanding is %d, want %d", test.name, got, test.outstanding)
+		}
+		if got := getSettlementStatus(test.invoice); got != test.want {
+			t.Errorf("%s: settlement status is %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPutInvoiceSettlementStatus(t *testing.T) {
+	stub, _ := newInvoiceStub()
+	invoice := newInvoice("INV-1", 100, "12.50")
+	invoice.Status = "MATCHED"
+	invoice.PaidAmount = 125000
+	invoice.CreditedAmount = 5000
+
+	stub.MockTransactionStart("tx1")
+	if err := putInvoice(stub, invoice); err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("tx1")
+
+	stored, err := getInvoice(stub, "FlextronicsMSP", "INV-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.SettlementStatus != "CREDIT" {
+		t.Errorf("stored settlement status is %s, want CREDIT", stored.SettlementStatus)
+	}
+	// invoice numbers are the supplier's own, another supplier may use the same one
+	if _, found, err := findInvoice(stub, "OtherSupplierMSP", "INV-1"); err != nil || found {
+		t.Errorf("found INV-1 of another supplier: %v, %v", found, err)
+	}
+}
+
+//the supplier invoices 40 and 60 of the 100 pieces of 4500001 at 12.50 EUR, both are matched
+func submitTestInvoices(t *testing.T, invoices *chaincodetest.Stub) {
+	t.Helper()
+	invokeOK(t, invoices, flextronics, "submitInvoice", "INV1", "4500001", "2026-01-05", "EUR", "10", "40", "12.50", "500.00")
+	invokeOK(t, invoices, flextronics, "submitInvoice", "INV2", "4500001", "2026-01-05", "EUR", "10", "60", "12.50", "750.00")
+}
+
+func TestRecordPaymentOverSeveralInvoices(t *testing.T) {
+	invoices, _ := newInvoiceChannel()
+	submitTestInvoices(t, invoices)
+
+	invokeFails(t, invoices, flextronics, "expecting SchneiderMSP",
+		"recordPayment", "PAY1", "SEPA-1", "2026-01-20", "EUR", "FlextronicsMSP", "INV1", "500.00")
+	invokeOK(t, invoices, schneider, "recordPayment", "PAY1", "SEPA-1", "2026-01-20", "EUR", "FlextronicsMSP", "INV1", "500.00", "INV2", "300.00")
+	for _, test := range []struct {
+		InvoiceId   string
+		paid        int64
+		outstanding int64
+		status      string
+	}{{"INV1", 50000, 0, "PAID"}, {"INV2", 30000, 45000, "PARTIALLY_PAID"}} {
+		invoice := readInvoice(t, invoices, "FlextronicsMSP", test.InvoiceId)
+		if invoice.PaidAmount != test.paid || getOutstanding(invoice) != test.outstanding || invoice.SettlementStatus != test.status {
+			t.Errorf("%s paid %d with %d outstanding is %s, want %d, %d and %s", test.InvoiceId, invoice.PaidAmount, getOutstanding(invoice),
+				invoice.SettlementStatus, test.paid, test.outstanding, test.status)
+		}
+	}
+	payment := Payment{}
+	if err := json.Unmarshal(invokeOK(t, invoices, schneider, "getPayment", "PAY1"), &payment); err != nil {
+		t.Fatal(err)
+	}
+	if payment.Amount != 80000 || len(payment.Allocations) != 2 {
+		t.Fatalf("payment = %+v, expecting 800.00 EUR over two invoices", payment)
+	}
+	invokeFails(t, invoices, schneider, "This payment already exists: PAY1",
+		"recordPayment", "PAY1", "SEPA-2", "2026-01-21", "EUR", "FlextronicsMSP", "INV2", "450.00")
+}
+
+func TestRecordPaymentRefusesOverpayment(t *testing.T) {
+	invoices, _ := newInvoiceChannel()
+	submitTestInvoices(t, invoices)
+	invokeOK(t, invoices, schneider, "recordPayment", "PAY1", "SEPA-1", "2026-01-20", "EUR", "FlextronicsMSP", "INV2", "300.00")
+
+	// INV1 alone would be fine, the payment is refused as a whole
+	invokeFails(t, invoices, schneider, "invoice INV2 has 450.00 EUR outstanding, cannot pay 450.01 EUR",
+		"recordPayment", "PAY2", "SEPA-2", "2026-01-21", "EUR", "FlextronicsMSP", "INV1", "500.00", "INV2", "450.01")
+	if invoice := readInvoice(t, invoices, "FlextronicsMSP", "INV1"); invoice.PaidAmount != 0 {
+		t.Fatalf("INV1 shows %d paid by a refused payment", invoice.PaidAmount)
+	}
+	invokeFails(t, invoices, schneider, "is in EUR, not USD",
+		"recordPayment", "PAY2", "SEPA-2", "2026-01-21", "USD", "FlextronicsMSP", "INV2", "450.00")
+	invokeOK(t, invoices, schneider, "recordPayment", "PAY2", "SEPA-2", "2026-01-21", "EUR", "FlextronicsMSP", "INV1", "500.00", "INV2", "450.00")
+	invokeFails(t, invoices, schneider, "invoice INV2 has 0.00 EUR outstanding, cannot pay 0.01 EUR",
+		"recordPayment", "PAY3", "SEPA-3", "2026-01-22", "EUR", "FlextronicsMSP", "INV2", "0.01")
+}
+
+// ==== Credit and debit notes ====
+
+func readInvoicedQuantity(t *testing.T, invoices *chaincodetest.Stub) int64 {
+	t.Helper()
+	invoicedKey, _ := invoices.CreateCompositeKey("invoiced", []string{"4500001", "10"})
+	invoiced, err := strconv.ParseInt(string(invoices.State[invoicedKey]), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return invoiced
+}
+
+func TestAdjustmentNoteDecidedByCounterparty(t *testing.T) {
+	invoices, _ := newInvoiceChannel()
+	submitTestInvoices(t, invoices)
+
+	invokeOK(t, invoices, flextronics, "issueAdjustmentNote", "CREDIT", "CN1", "FlextronicsMSP", "INV1", "10", "PRICE_VARIANCE", "0", "20.00", "rebate")
+	invokeFails(t, invoices, flextronics, "expecting SchneiderMSP", "acceptAdjustmentNote", "FlextronicsMSP", "INV1", "CN1", "agreed")
+	invokeOK(t, invoices, schneider, "acceptAdjustmentNote", "FlextronicsMSP", "INV1", "CN1", "agreed")
+	invokeFails(t, invoices, schneider, "note CN1 was already accepted", "rejectAdjustmentNote", "FlextronicsMSP", "INV1", "CN1", "changed my mind")
+
+	invokeOK(t, invoices, schneider, "issueAdjustmentNote", "DEBIT", "DN1", "FlextronicsMSP", "INV1", "10", "OTHER", "0", "5.00", "freight")
+	invokeFails(t, invoices, schneider, "expecting FlextronicsMSP", "rejectAdjustmentNote", "FlextronicsMSP", "INV1", "DN1", "not agreed")
+	invokeOK(t, invoices, flextronics, "rejectAdjustmentNote", "FlextronicsMSP", "INV1", "DN1", "freight is on the buyer")
+
+	invoice := readInvoice(t, invoices, "FlextronicsMSP", "INV1")
+	if invoice.CreditedAmount != 2000 || invoice.DebitedAmount != 0 || getOutstanding(invoice) != 48000 {
+		t.Fatalf("INV1 credited %d and debited %d with %d outstanding, want 2000, 0 and 48000", invoice.CreditedAmount,
+			invoice.DebitedAmount, getOutstanding(invoice))
+	}
+}
+
+func TestQuantityNoteAdjustsInvoicedQuantity(t *testing.T) {
+	invoices, _ := newInvoiceChannel()
+	submitTestInvoices(t, invoices)
+	if invoiced := readInvoicedQuantity(t, invoices); invoiced != 100 {
+		t.Fatalf("%d of line 10 invoiced, want 100", invoiced)
+	}
+
+	invokeFails(t, invoices, schneider, "amount must be 10 times the invoiced unit price of 12.50 EUR",
+		"issueAdjustmentNote", "CREDIT", "CN1", "FlextronicsMSP", "INV1", "10", "SHORT_DELIVERY", "10", "120.00", "10 short")
+	invokeFails(t, invoices, schneider, "invoice INV1 has 500.00 EUR billed, cannot credit 512.50 EUR",
+		"issueAdjustmentNote", "CREDIT", "CN1", "FlextronicsMSP", "INV1", "10", "SHORT_DELIVERY", "41", "512.50", "41 short")
+	invokeOK(t, invoices, schneider, "issueAdjustmentNote", "CREDIT", "CN1", "FlextronicsMSP", "INV1", "10", "SHORT_DELIVERY", "10", "125.00", "10 short")
+	invokeOK(t, invoices, flextronics, "acceptAdjustmentNote", "FlextronicsMSP", "INV1", "CN1", "agreed")
+	if invoiced := readInvoicedQuantity(t, invoices); invoiced != 90 {
+		t.Fatalf("%d of line 10 invoiced after crediting 10, want 90", invoiced)
+	}
+	if line := readInvoice(t, invoices, "FlextronicsMSP", "INV1").Lines[0]; line.CreditedQuantity != 10 {
+		t.Fatalf("line 10 of INV1 credited %d, want 10", line.CreditedQuantity)
+	}
+
+	// the 10 credited are received and no longer billed, so they can be debited again but no more
+	invokeFails(t, invoices, flextronics, "only 10 received on line 10 is not billed yet",
+		"issueAdjustmentNote", "DEBIT", "DN1", "FlextronicsMSP", "INV2", "10", "ADDITIONAL_DELIVERY", "11", "137.50", "11 more")
+	invokeOK(t, invoices, flextronics, "issueAdjustmentNote", "DEBIT", "DN1", "FlextronicsMSP", "INV2", "10", "ADDITIONAL_DELIVERY", "10", "125.00", "10 more")
+	invokeOK(t, invoices, schneider, "acceptAdjustmentNote", "FlextronicsMSP", "INV2", "DN1", "agreed")
+	if invoiced := readInvoicedQuantity(t, invoices); invoiced != 100 {
+		t.Fatalf("%d of line 10 invoiced after debiting 10, want 100", invoiced)
+	}
+}
+
+// ==== Self-billing ====
+
+//a consignment order 4500002 of which 30 pieces were consumed in January
+func addConsignmentOrder(purchaseOrders *purchaseOrderStandIn, DeliveredQuantity int64) {
+	purchaseOrder := newPurchaseOrder()
+	purchaseOrder.PONumber = "4500002"
+	purchaseOrder.Consignment = true
+	purchaseOrder.Lines[0].DeliveredQuantity = DeliveredQuantity
+	purchaseOrders.purchaseOrders["4500002"] = purchaseOrder
+	purchaseOrders.consumptions["4500002"] = []ConsumptionRecord{{RecordId: "C1", LineNumber: "10", Quantity: 20},
+		{RecordId: "C2", LineNumber: "10", Quantity: 10}}
+}
+
+func TestSelfBillingBillsConsumptionOnce(t *testing.T) {
+	invoices, purchaseOrders := newInvoiceChannel()
+	addConsignmentOrder(purchaseOrders, 100)
+
+	invoice := Invoice{}
+	payload := invokeOK(t, invoices, schneider, "generateSelfBillingInvoice", "4500002", "2026-01-01", "2026-01-31")
+	if err := json.Unmarshal(payload, &invoice); err != nil {
+		t.Fatal(err)
+	}
+	if invoice.InvoiceId != "SB-4500002-2026-01-01-2026-01-31" || invoice.Status != "MATCHED" || invoice.TotalQuantity != 30 ||
+		invoice.TotalAmount != 37500 {
+		t.Fatalf("self-billing invoice = %+v, expecting 30 pieces for 375.00 EUR matched", invoice)
+	}
+
+	invokeFails(t, invoices, flextronics, "This period was already billed on invoice SB-4500002-2026-01-01-2026-01-31",
+		"generateSelfBillingInvoice", "4500002", "2026-01-01", "2026-01-31")
+	invokeFails(t, invoices, schneider, "that is not billed yet",
+		"generateSelfBillingInvoice", "4500002", "2026-01-15", "2026-01-31")
+}
+
+func TestSelfBillingRebillsAfterReject(t *testing.T) {
+	invoices, purchaseOrders := newInvoiceChannel()
+	addConsignmentOrder(purchaseOrders, 20)
+
+	invokeOK(t, invoices, schneider, "generateSelfBillingInvoice", "4500002", "2026-01-01", "2026-01-31")
+	if invoice := readInvoice(t, invoices, "FlextronicsMSP", "SB-4500002-2026-01-01-2026-01-31"); invoice.Status != "ON_HOLD" {
+		t.Fatalf("invoice billing 30 of 20 received is %s, expecting ON_HOLD", invoice.Status)
+	}
+	invokeFails(t, invoices, schneider, "already billed", "generateSelfBillingInvoice", "4500002", "2026-01-01", "2026-01-31")
+
+	invokeOK(t, invoices, schneider, "rejectInvoice", "FlextronicsMSP", "SB-4500002-2026-01-01-2026-01-31", "counted again, 10 still on stock")
+	invoice := Invoice{}
+	payload := invokeOK(t, invoices, schneider, "generateSelfBillingInvoice", "4500002", "2026-01-01", "2026-01-31")
+	if err := json.Unmarshal(payload, &invoice); err != nil {
+		t.Fatal(err)
+	}
+	if invoice.InvoiceId != "SB-4500002-2026-01-01-2026-01-31-2" || !reflect.DeepEqual(invoice.ConsumptionIds, []string{"C1", "C2"}) {
+		t.Fatalf("rebilled invoice = %+v, expecting SB-4500002-2026-01-01-2026-01-31-2 covering C1 and C2", invoice)
+	}
+	invokeFails(t, invoices, schneider, "already billed on invoice SB-4500002-2026-01-01-2026-01-31-2",
+		"generateSelfBillingInvoice", "4500002", "2026-01-01", "2026-01-31")
+}
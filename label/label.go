@@ -0,0 +1,211 @@
+//the QR label shared by the product (tracktrace.go) and shipment (painting.go) chaincodes.
+//The chaincode hands out the unsigned payload and the organisation that prints the label
+//signs it with its own key, which never reaches a peer. The public key is registered on the
+//ledger per MSP, a scanner that holds it can check a label offline, and verify_label or
+//verifyLabel also check the labelled state against the ledger history.
+package label
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/common"
+)
+
+//compact label payload printed as a QR code, short keys keep the code small
+type Payload struct {
+	Type      string `json:"t"` //P for a product, S for a shipment
+	Id        string `json:"id"`
+	Batch     string `json:"b,omitempty"`
+	Expiry    string `json:"e,omitempty"`
+	TxId      string `json:"tx"` //transaction that wrote the labelled state
+	StateHash string `json:"h"`  //sha256 of the labelled state
+	Height    uint64 `json:"n"`  //ledger height when the label was printed
+	Issuer    string `json:"i"`  //MSP whose key signed the label
+	Signature string `json:"s"`  //base64 ECDSA signature over the payload without s
+}
+
+//outcome of checking a scanned label against the ledger
+type Verification struct {
+	Id      string `json:"Id"`
+	Signed  bool   `json:"Signed"`  //the signature matches the key registered for the issuer
+	Genuine bool   `json:"Genuine"` //the label matches a state the ledger really held
+	Current bool   `json:"Current"` //and that state has not changed since the label was printed
+	Status  string `json:"Status"`  //current status, so a recall or tampering shows on the scan
+	Reason  string `json:"Reason"`
+}
+
+//an ECDSA signature as ASN.1, the encoding Fabric itself uses
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+//the bytes a label signature covers: the payload as JSON with the signature left out
+func SignedBytes(payload Payload) ([]byte, error) {
+	payload.Signature = ""
+	return json.Marshal(payload)
+}
+
+//stamp the ledger height and the caller's MSP on an unsigned payload. The caller signs
+//SignedBytes of the result, which are the bytes the payload marshals to, with the key
+//registered for its MSP and puts the base64 ASN.1 signature in s
+func Stamp(stub shim.ChaincodeStubInterface, payload Payload) (Payload, error) {
+	Issuer, err := cid.GetMSPID(stub)
+	if err != nil {
+		return payload, fmt.Errorf("Failed to get caller MSP: %s", err.Error())
+	}
+	_, err = GetKey(stub, Issuer)
+	if err != nil {
+		return payload, err
+	}
+
+	payload.Height, err = getHeight(stub)
+	if err != nil {
+		return payload, err
+	}
+	payload.Issuer = Issuer
+	payload.Signature = ""
+	return payload, nil
+}
+
+//check the signature on a scanned label against the key registered for its issuer
+func Verify(stub shim.ChaincodeStubInterface, payload Payload) error {
+	if payload.Issuer == "" || payload.Signature == "" {
+		return fmt.Errorf("label is not signed")
+	}
+	publicKey, err := getPublicKey(stub, payload.Issuer)
+	if err != nil {
+		return err
+	}
+	signatureAsBytes, err := base64.StdEncoding.DecodeString(payload.Signature)
+	if err != nil {
+		return fmt.Errorf("label signature is not readable")
+	}
+	signature := ecdsaSignature{}
+	_, err = asn1.Unmarshal(signatureAsBytes, &signature)
+	if err != nil || signature.R == nil || signature.S == nil {
+		return fmt.Errorf("label signature is not readable")
+	}
+	signedBytes, err := SignedBytes(payload)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(signedBytes)
+	if !ecdsa.Verify(publicKey, digest[:], signature.R, signature.S) {
+		return fmt.Errorf("label signature does not match the key of %s", payload.Issuer)
+	}
+	return nil
+}
+
+//register the PEM public key the caller's MSP signs its labels with, replacing an earlier one
+func RegisterKey(stub shim.ChaincodeStubInterface, PublicKey string) error {
+	mspId, err := cid.GetMSPID(stub)
+	if err != nil {
+		return fmt.Errorf("Failed to get caller MSP: %s", err.Error())
+	}
+	_, err = parsePublicKey([]byte(PublicKey))
+	if err != nil {
+		return err
+	}
+	keyKey, err := stub.CreateCompositeKey("labelkey", []string{mspId})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(keyKey, []byte(PublicKey))
+}
+
+//the PEM public key an MSP signs its labels with, for scanners that verify offline
+func GetKey(stub shim.ChaincodeStubInterface, mspId string) ([]byte, error) {
+	keyKey, err := stub.CreateCompositeKey("labelkey", []string{mspId})
+	if err != nil {
+		return nil, err
+	}
+	keyAsBytes, err := stub.GetState(keyKey)
+	if err != nil {
+		return nil, err
+	} else if keyAsBytes == nil {
+		return nil, fmt.Errorf("No label key registered for %s", mspId)
+	}
+	return keyAsBytes, nil
+}
+
+func getPublicKey(stub shim.ChaincodeStubInterface, mspId string) (*ecdsa.PublicKey, error) {
+	keyAsBytes, err := GetKey(stub, mspId)
+	if err != nil {
+		return nil, err
+	}
+	return parsePublicKey(keyAsBytes)
+}
+
+func parsePublicKey(keyAsBytes []byte) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode(keyAsBytes)
+	if block == nil {
+		return nil, fmt.Errorf("Label key must be a PEM public key")
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("Label key must be a PEM public key: %s", err.Error())
+	}
+	ecdsaKey, ok := publicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("Label key must be an ECDSA key")
+	}
+	return ecdsaKey, nil
+}
+
+//the height of the channel's ledger, read from the query system chaincode
+func getHeight(stub shim.ChaincodeStubInterface) (uint64, error) {
+	response := stub.InvokeChaincode("qscc", util.ToChaincodeArgs("GetChainInfo", stub.GetChannelID()), "")
+	if response.Status != shim.OK {
+		return 0, fmt.Errorf("Failed to get the ledger height: %s", response.Message)
+	}
+	chainInfo := common.BlockchainInfo{}
+	err := proto.Unmarshal(response.Payload, &chainInfo)
+	if err != nil {
+		return 0, err
+	}
+	return chainInfo.Height, nil
+}
+
+//the state a key held after transaction TxId, and the id of the transaction that wrote the current state
+func GetLabelledState(stub shim.ChaincodeStubInterface, key string, TxId string) ([]byte, string, bool, error) {
+	resultsIterator, err := stub.GetHistoryForKey(key)
+	if err != nil {
+		return nil, "", false, err
+	}
+	defer resultsIterator.Close()
+
+	// do not rely on the order the history comes back in
+	var value []byte
+	var latest time.Time
+	latestTxId := ""
+	found := false
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, "", false, err
+		}
+		if TxId != "" && response.TxId == TxId && !response.IsDelete {
+			value = response.Value
+			found = true
+		}
+		modified := time.Unix(response.Timestamp.Seconds, int64(response.Timestamp.Nanos))
+		if latestTxId == "" || !modified.Before(latest) {
+			latest = modified
+			latestTxId = response.TxId
+		}
+	}
+	return value, latestTxId, found, nil
+}
@@ -0,0 +1,141 @@
+package label
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/RinuT/chaincode/chaincodetest"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+//registers label keys, stamps payloads and verifies scanned labels
+type labelChaincode struct{}
+
+func (cc *labelChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (cc *labelChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	function, args := stub.GetFunctionAndParameters()
+	switch function {
+	case "register":
+		err := RegisterKey(stub, args[0])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		return shim.Success(nil)
+	case "stamp":
+		payload, err := Stamp(stub, Payload{Type: "P", Id: args[0], TxId: "tx1", StateHash: "00"})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		payloadAsBytes, err := json.Marshal(payload)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		return shim.Success(payloadAsBytes)
+	case "verify":
+		payload := Payload{}
+		err := json.Unmarshal([]byte(args[0]), &payload)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = Verify(stub, payload)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		return shim.Success(nil)
+	}
+	return shim.Error("unknown function " + function)
+}
+
+//what a printing client does with the stamped payload: sign the bytes it got and fill in s
+func signLabel(t *testing.T, key *ecdsa.PrivateKey, payloadAsBytes []byte) string {
+	t.Helper()
+	digest := sha256.Sum256(payloadAsBytes)
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := asn1.Marshal(ecdsaSignature{R: r, S: s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := Payload{}
+	if err = json.Unmarshal(payloadAsBytes, &payload); err != nil {
+		t.Fatal(err)
+	}
+	payload.Signature = base64.StdEncoding.EncodeToString(signature)
+	labelAsBytes, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(labelAsBytes)
+}
+
+func newKey(t *testing.T) (*ecdsa.PrivateKey, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyAsBytes, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyAsBytes}))
+}
+
+func TestClientSignsStampedPayload(t *testing.T) {
+	channel := chaincodetest.NewChannel()
+	stub := channel.Install("labels", new(labelChaincode))
+	printer := chaincodetest.Identity("Org1MSP", "")
+	key, publicKey := newKey(t)
+
+	response := stub.Query(printer, "stamp", "P1")
+	if response.Status == shim.OK || !strings.Contains(response.Message, "No label key registered for Org1MSP") {
+		t.Fatalf("stamped a label without a registered key: %+v", response)
+	}
+	if response = stub.Invoke(printer, "register", publicKey); response.Status != shim.OK {
+		t.Fatal(response.Message)
+	}
+
+	response = stub.Query(printer, "stamp", "P1")
+	if response.Status != shim.OK {
+		t.Fatal(response.Message)
+	}
+	payload := Payload{}
+	if err := json.Unmarshal(response.Payload, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Issuer != "Org1MSP" || payload.Height == 0 || payload.Signature != "" {
+		t.Fatalf("stamped payload = %+v, expecting an unsigned payload issued by Org1MSP at the ledger height", payload)
+	}
+	signedBytes, err := SignedBytes(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(signedBytes) != string(response.Payload) {
+		t.Fatalf("the stamped payload %s is not the bytes a signature covers, %s", response.Payload, signedBytes)
+	}
+
+	labelAsString := signLabel(t, key, response.Payload)
+	if response = stub.Query(printer, "verify", labelAsString); response.Status != shim.OK {
+		t.Fatalf("a label signed by the client does not verify: %s", response.Message)
+	}
+	otherKey, _ := newKey(t)
+	response = stub.Query(printer, "verify", signLabel(t, otherKey, signedBytes))
+	if response.Status == shim.OK || !strings.Contains(response.Message, "does not match the key of Org1MSP") {
+		t.Fatalf("a label signed with another key verified: %+v", response)
+	}
+}
@@ -0,0 +1,286 @@
+//peer chaincode instantiate -n notification -v 0 -c '{"Args":["init"]}' -C myc
+//peer chaincode query -n notification -c '{"Args":["getUnreadNotifications"]}' -C myc
+//peer chaincode invoke -n notification -c '{"Args":["markNotificationsRead","<notification id>"]}' -C myc
+
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/RinuT/chaincode/caller"
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+type NotificationChaincode struct {
+}
+
+//an entry in the inbox of a participant, written by the other chaincodes when something
+//needs its attention
+type Notification struct {
+	ObjectType     string `json:"docType"`
+	NotificationId string `json:"NotificationId"`
+	Recipient      string `json:"Recipient"` //MSP id of the participant
+	Type           string `json:"Type"`
+	Reference      string `json:"Reference"` //PO number, invoice id or shipment id it is about
+	Message        string `json:"Message"`
+	Sender         string `json:"Sender"` //MSP id of the caller of the transaction
+	CreateDate     string `json:"CreateDate"`
+	TxId           string `json:"TxId"`
+	Read           bool   `json:"Read"`
+	ReadBy         string `json:"ReadBy"`
+	ReadDate       string `json:"ReadDate"`
+}
+
+//the purchase order chaincode (purchaseorder.go) as installed on the same channel
+const purchaseOrderChaincode = "purchaseorder"
+
+//the invoice chaincode (invoice.go) as installed on the same channel
+const invoiceChaincode = "invoice"
+
+//the shipment chaincode (painting.go) as installed on the same channel
+const shipmentChaincode = "mycc"
+
+//the kinds of notification, with the chaincode that may send each
+var notificationTypes = map[string]string{
+	"NEW_PO":               purchaseOrderChaincode,
+	"CHANGE_PROPOSED":      purchaseOrderChaincode,
+	"ASN_RECEIVED":         purchaseOrderChaincode,
+	"GOODS_RECEIVED":       purchaseOrderChaincode,
+	"DISCREPANCY_RESOLVED": purchaseOrderChaincode,
+	"INVOICE_ON_HOLD":      invoiceChaincode,
+	"INVOICE_REJECTED":     invoiceChaincode,
+	"PAYMENT_RECORDED":     invoiceChaincode,
+	"ADJUSTMENT_NOTE":      invoiceChaincode,
+	"EXCURSION":            shipmentChaincode,
+}
+
+func main() {
+	err := shim.Start(new(NotificationChaincode))
+	if err != nil {
+		fmt.Printf("Error starting Notification chaincode: %s", err)
+	}
+}
+
+func (t *NotificationChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	fmt.Println("- init of notification chaincode")
+	return shim.Success(nil)
+}
+
+//invoke function
+
+func (t *NotificationChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	function, args := stub.GetFunctionAndParameters()
+	fmt.Println("invoke is running " + function)
+
+	// Handle different functions
+	if function == "notify" {
+		return t.notify(stub, args)
+	} else if function == "getUnreadNotifications" {
+		return t.getUnreadNotifications(stub, args)
+	} else if function == "markNotificationsRead" {
+		return t.markNotificationsRead(stub, args)
+	}
+
+	fmt.Println("invoke did not find func: " + function) //error
+	return shim.Error("Received unknown function invocation")
+}
+
+//leave a notification in the inbox of each recipient. Called by the other chaincodes,
+//which emit the returned notifications as their chaincode event: events set by a called
+//chaincode do not reach the client. Only the chaincode a type belongs to may send it. Every
+//recipient gets its entry, which waits until its MSP reads it.
+//args are type, reference, message and one or more recipient MSP ids
+func (t *NotificationChaincode) notify(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 4 {
+		return shim.Error("Incorrect number of arguments. Expecting type, reference, message and recipients")
+	}
+
+	Type := strings.ToUpper(strings.TrimSpace(args[0]))
+	Reference := args[1]
+	Message := args[2]
+	fmt.Println("- start notify ", Type, Reference)
+
+	Chaincode, known := notificationTypes[Type]
+	if !known {
+		return shim.Error("Unknown notification type " + Type)
+	}
+	err := caller.RequireChaincode(stub, Chaincode)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	Sender, err := cid.GetMSPID(stub)
+	if err != nil {
+		return shim.Error("Failed to get caller MSP: " + err.Error())
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// a transaction may notify more than once and the chaincode cannot read its own writes,
+	// so the id carries a digest of the call. Identical calls leave the same notification
+	digest := sha256.Sum256([]byte(strings.Join(args, "\x00")))
+	NotificationId := stub.GetTxID() + "-" + Type + "-" + hex.EncodeToString(digest[:8])
+	notifications := []Notification{}
+	for _, Recipient := range args[3:] {
+		Recipient = strings.TrimSpace(Recipient)
+		if Recipient == "" {
+			continue
+		}
+		listed := false
+		for _, notification := range notifications {
+			listed = listed || notification.Recipient == Recipient
+		}
+		if listed {
+			continue
+		}
+		notification := Notification{ObjectType: "notification", NotificationId: NotificationId, Recipient: Recipient, Type: Type,
+			Reference: Reference, Message: Message, Sender: Sender, CreateDate: txTime.Format(time.RFC3339), TxId: stub.GetTxID()}
+		err = putNotification(stub, notification)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		notifications = append(notifications, notification)
+	}
+	notificationsAsBytes, err := json.Marshal(notifications)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end notify (success)")
+	return shim.Success(notificationsAsBytes)
+}
+
+//the unread notifications of the caller's organisation, oldest first
+func (t *NotificationChaincode) getUnreadNotifications(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 0 {
+		return shim.Error("Incorrect number of arguments. Expecting none")
+	}
+
+	Recipient, err := cid.GetMSPID(stub)
+	if err != nil {
+		return shim.Error("Failed to get caller MSP: " + err.Error())
+	}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("notification", []string{Recipient})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	notifications := []Notification{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		notification := Notification{}
+		err = json.Unmarshal(queryResponse.Value, &notification)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if !notification.Read {
+			notifications = append(notifications, notification)
+		}
+	}
+	// keys are ordered by tx id, not by time
+	for i := 1; i < len(notifications); i++ {
+		for j := i; j > 0 && notifications[j].CreateDate < notifications[j-1].CreateDate; j-- {
+			notifications[j], notifications[j-1] = notifications[j-1], notifications[j]
+		}
+	}
+
+	notificationsAsBytes, err := json.Marshal(notifications)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(notificationsAsBytes)
+}
+
+//the caller marks notifications in its own inbox as read, args are notification ids
+func (t *NotificationChaincode) markNotificationsRead(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 1 {
+		return shim.Error("Incorrect number of arguments. Expecting notification ids")
+	}
+
+	Recipient, err := cid.GetMSPID(stub)
+	if err != nil {
+		return shim.Error("Failed to get caller MSP: " + err.Error())
+	}
+	ReadBy, err := caller.Id(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("- start markNotificationsRead ", Recipient, len(args))
+
+	marked := map[string]bool{}
+	for _, NotificationId := range args {
+		if marked[NotificationId] {
+			continue
+		}
+		marked[NotificationId] = true
+		notificationKey, err := stub.CreateCompositeKey("notification", []string{Recipient, NotificationId})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		notificationAsBytes, err := stub.GetState(notificationKey)
+		if err != nil {
+			return shim.Error("Failed to get notification: " + err.Error())
+		} else if notificationAsBytes == nil {
+			return shim.Error("notification does not exist: " + NotificationId)
+		}
+		notification := Notification{}
+		err = json.Unmarshal(notificationAsBytes, &notification)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if notification.Read {
+			continue
+		}
+		notification.Read = true
+		notification.ReadBy = ReadBy
+		notification.ReadDate = txTime.Format(time.RFC3339)
+		err = putNotification(stub, notification)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	fmt.Println("- end markNotificationsRead (success)")
+	return shim.Success(nil)
+}
+
+// ==== Helpers ====
+
+//notifications are kept per recipient, so an inbox is read with one partial key
+func putNotification(stub shim.ChaincodeStubInterface, notification Notification) error {
+	notificationKey, err := stub.CreateCompositeKey("notification", []string{notification.Recipient, notification.NotificationId})
+	if err != nil {
+		return err
+	}
+	notificationJSONasBytes, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(notificationKey, notificationJSONasBytes)
+}
+
+//the transaction timestamp is the same on every endorser, unlike time.Now()
+func getTxTime(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos)).UTC(), nil
+}
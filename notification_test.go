@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/RinuT/chaincode/chaincodetest"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+var (
+	buyer    = chaincodetest.Identity("SchneiderMSP", "")
+	supplier = chaincodetest.Identity("FlextronicsMSP", "")
+)
+
+//stands in for a chaincode that notifies, and passes its args on to the notification
+//chaincode in the same transaction
+type notifyingChaincode struct{}
+
+func (cc *notifyingChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (cc *notifyingChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	return stub.InvokeChaincode(notificationChaincode, stub.GetArgs(), "")
+}
+
+const notificationChaincode = "notification"
+
+//the notification chaincode next to stand-ins for the invoice and purchase order chaincodes
+func newNotificationChannel() (*chaincodetest.Stub, *chaincodetest.Stub, *chaincodetest.Stub) {
+	channel := chaincodetest.NewChannel()
+	notifications := channel.Install(notificationChaincode, new(NotificationChaincode))
+	invoices := channel.Install(invoiceChaincode, new(notifyingChaincode))
+	purchaseOrders := channel.Install(purchaseOrderChaincode, new(notifyingChaincode))
+	return notifications, invoices, purchaseOrders
+}
+
+func unread(t *testing.T, notifications *chaincodetest.Stub, creator []byte) []Notification {
+	t.Helper()
+	response := notifications.Query(creator, "getUnreadNotifications")
+	if response.Status != shim.OK {
+		t.Fatal(response.Message)
+	}
+	unread := []Notification{}
+	if err := json.Unmarshal(response.Payload, &unread); err != nil {
+		t.Fatal(err)
+	}
+	return unread
+}
+
+func TestNotifyOnlyFromOwningChaincode(t *testing.T) {
+	notifications, invoices, purchaseOrders := newNotificationChannel()
+
+	response := notifications.Invoke(buyer, "notify", "INVOICE_ON_HOLD", "INV1", "invoice INV1 is on hold", "SchneiderMSP")
+	if response.Status == shim.OK || !strings.Contains(response.Message, "only the invoice chaincode can call this") {
+		t.Fatalf("a client sent a notification directly: %+v", response)
+	}
+	response = purchaseOrders.Invoke(supplier, "notify", "INVOICE_ON_HOLD", "INV1", "invoice INV1 is on hold", "SchneiderMSP")
+	if response.Status == shim.OK || !strings.Contains(response.Message, "only the invoice chaincode can call this") {
+		t.Fatalf("the purchase order chaincode sent an invoice notification: %+v", response)
+	}
+	if got := unread(t, notifications, buyer); len(got) != 0 {
+		t.Fatalf("refused notifications were left: %+v", got)
+	}
+
+	// the buyer never did anything on the notification chaincode and still gets its entry
+	response = invoices.Invoke(supplier, "notify", "INVOICE_ON_HOLD", "INV1", "invoice INV1 is on hold", "SchneiderMSP")
+	if response.Status != shim.OK {
+		t.Fatal(response.Message)
+	}
+	got := unread(t, notifications, buyer)
+	if len(got) != 1 || got[0].Reference != "INV1" || got[0].Sender != "FlextronicsMSP" {
+		t.Fatalf("unread notifications of SchneiderMSP = %+v, expecting INV1 from FlextronicsMSP", got)
+	}
+}
+
+func TestMarkNotificationsRead(t *testing.T) {
+	notifications, _, purchaseOrders := newNotificationChannel()
+	response := purchaseOrders.Invoke(buyer, "notify", "NEW_PO", "4500001", "new purchase order 4500001", "FlextronicsMSP")
+	if response.Status != shim.OK {
+		t.Fatal(response.Message)
+	}
+	NotificationId := unread(t, notifications, supplier)[0].NotificationId
+
+	response = notifications.Invoke(buyer, "markNotificationsRead", NotificationId)
+	if response.Status == shim.OK || !strings.Contains(response.Message, "notification does not exist") {
+		t.Fatalf("SchneiderMSP marked a notification of FlextronicsMSP read: %+v", response)
+	}
+	if response = notifications.Invoke(supplier, "markNotificationsRead", NotificationId, NotificationId); response.Status != shim.OK {
+		t.Fatal(response.Message)
+	}
+	if got := unread(t, notifications, supplier); len(got) != 0 {
+		t.Fatalf("unread notifications of FlextronicsMSP = %+v after marking them read", got)
+	}
+	notificationKey, _ := notifications.CreateCompositeKey("notification", []string{"FlextronicsMSP", NotificationId})
+	notification := Notification{}
+	if err := json.Unmarshal(notifications.State[notificationKey], &notification); err != nil {
+		t.Fatal(err)
+	}
+	if !notification.Read || !strings.HasPrefix(notification.ReadBy, "FlextronicsMSP/") || notification.ReadDate == "" {
+		t.Fatalf("notification = %+v, expecting it read by the FlextronicsMSP caller", notification)
+	}
+}
@@ -1,487 +1,1001 @@
-//peer chaincode instantiate -n mycc -v 0 -c '{"Args":["Shipment","1","Buyer","Seller","CurrentLocation", "DestinationCity", "OriginCity", "ShipmentCondition", "Temperature", "Humidity", "Luminosity"]}' -C myc
-//peer chaincode invoke -n mycc -c '{"Args":["registerShipment","2","abc","xyz","NY","CA","NY","good_condition","100","",""]}' -C myc
-//peer chaincode invoke -n mycc -c '{"Args":["registerShipment","4","abc","xyz","kochi","Pune","Bangalore","good_condition","100","","28"]}' -C myc
-//peer chaincode invoke -n mycc -c '{"Args":["updateTemparature","2","100"]}' -C myc
-//peer chaincode invoke -n mycc -c '{"Args":["updateShipmentStatus","2","tampered"]}' -C myc
-//peer chaincode invoke -n mycc -c '{"Args":["updateHumidity","2","25"]}' -C myc
-//peer chaincode invoke -n mycc -c '{"Args":["updateLuminosity","2","18"]}' -C myc
-//peer chaincode invoke -n mycc -c '{"Args":["updateOriginCity","2","kochi"]}' -C myc
-// peer chaincode invoke -n mycc -c '{"Args":["updateCurrentLocation","2","Pune"]}' -C myc
-//peer chaincode invoke -n mycc -c '{"Args":["updateDestinationCity","2","Banagalore"]}' -C myc
-//peer chaincode query -n mycc -c '{"Args":["queryHistory","2"]}' -C myc
-//peer chaincode query -n mycc -c '{"Args":["getShipmentDetails","2"]}' -C myc
-
-
-package main
-
-import (
-	"bytes"
-	"encoding/json"
-	"fmt"
-	"strconv"
-	"time"
-
-	"github.com/hyperledger/fabric/core/chaincode/shim"
-	pb "github.com/hyperledger/fabric/protos/peer"
-)
-
-type ShipmentChaincode struct {
-}
-
-type Shipment struct {
-	ObjectType      string `json:"docType"` 
-	ShipmentId      string `json:"ShipmentId"` 
-	Buyer           string `json:"Buyer"`
-	Seller          string `json:"Seller"`
-	CurrentLocation string `json:"CurrentLocation"`
-	DestinationCity string `json:"DestinationCity"` 
-	OriginCity      string `json:"OriginCity"`
-	ShipmentCondition  string `json:"ShipmentCondition"`
-	Temperature     string `json:"Temperature"`
-	Humidity        string `json:"Humidity"`
-	Luminosity      string `json:"Luminosity"`
-}
-
-func main() {
-	err := shim.Start(new(ShipmentChaincode))
-	if err != nil {
-		fmt.Printf("Error starting Simple chaincode: %s", err)
-	}
-}
-
-//Initialization of the Shipment
-func (t *ShipmentChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
-	function, args := stub.GetFunctionAndParameters()
-	fmt.Println("init is running " + function)
-
-	ShipmentId := args[0]
-	Buyer := args[1]
-	Seller := args[2]
-	CurrentLocation := args[3]
-	DestinationCity := args[4]
-	OriginCity := args[5]
-	ShipmentCondition := args[6]
-	Temperature := args[7]
-	Humidity := args[8]
-	Luminosity := args[9]
-
-	// ==== Create Shipment object and marshal to JSON ====
-	objectType := "Shipment"
-	Shipment := &Shipment{objectType, ShipmentId, Buyer, Seller, CurrentLocation, DestinationCity, OriginCity, ShipmentCondition, Temperature, Humidity, Luminosity}
-	ShipmentJSONasBytes, err := json.Marshal(Shipment)
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-
-	err = stub.PutState(ShipmentId, ShipmentJSONasBytes)
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-
-	fmt.Println("- end init of shipment")
-
-	return shim.Success(nil)
-}
-
-//invoke function
-
-func (t *ShipmentChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
-	function, args := stub.GetFunctionAndParameters()
-	fmt.Println("invoke is running " + function)
-
-	// Handle different functions
-	if function == "registerShipment" {
-		return t.registerShipment(stub, args)
-	} else if function == "getShipmentDetails" {
-		return t.getShipmentDetails(stub, args)
-	} else if function == "updateTemparature" {
-		return t.updateTemparature(stub, args)
-	} else if function == "updateHumidity" {
-		return t.updateHumidity(stub, args)
-	} else if function == "updateLuminosity" {
-		return t.updateLuminosity(stub, args)
-	} else if function == "queryHistory" {
-		return t.queryHistory(stub, args)
-	} else if function == "updateOriginCity" {
-		return t.updateOriginCity(stub, args)
-	} else if function == "updateCurrentLocation" {
-		return t.updateCurrentLocation(stub, args)
-	} else if function == "updateDestinationCity" {
-		return t.updateDestinationCity(stub, args)
-	} else if function == "updateShipmentStatus" {
-		return t.updateShipmentStatus(stub, args)
-	}
-
-	fmt.Println("invoke did not find func: " + function) //error
-	return shim.Error("Received unknown function invocation")
-}
-
-//Create an shipment with unique shipment Id
-func (t *ShipmentChaincode) registerShipment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	var err error
-
-	// ==== Input sanitation ====
-	fmt.Println("- start registering shipment")
-
-	ShipmentId := args[0]
-	Buyer := args[1]
-	Seller := args[2]
-	CurrentLocation := args[3]
-	DestinationCity := args[4]
-	OriginCity := args[5]
-	ShipmentCondition := args[6]
-	Temperature := args[7]
-	Humidity := args[8]
-	Luminosity := args[9]
-
-	// ==== Check if shipment already exists ====
-	ShipmentAsBytes, err := stub.GetState(ShipmentId)
-	if err != nil {
-		return shim.Error("Failed to register shipment: " + err.Error())
-	} else if ShipmentAsBytes != nil {
-		fmt.Println("This shipment already exists: " + ShipmentId)
-		return shim.Error("This shipment already exists: " + ShipmentId)
-	}
-
-	// ==== Create Shipment object and marshal to JSON ====
-	if (Humidity == "undefined" || Humidity == "" || Humidity == "null" || Luminosity == "undefined" || Luminosity == "" || Luminosity == "null") {
-		objectType := "Shipment"
-		Shipment := &Shipment{objectType, ShipmentId, Buyer, Seller, CurrentLocation, DestinationCity, OriginCity, ShipmentCondition, Temperature, Humidity, Luminosity}
-		fmt.Println(Shipment)
-		ShipmentJSONasBytes, err := json.Marshal(Shipment)
-		fmt.Println(ShipmentJSONasBytes)
-		if err != nil {
-			return shim.Error(err.Error())
-		}
-
-		// === Save Shipment to state ===
-		err = stub.PutState(ShipmentId, ShipmentJSONasBytes)
-		if err != nil {
-			return shim.Error(err.Error())
-		}
-	}
-	fmt.Println("- end registering shimpment")
-	return shim.Success(nil)
-
-}
-
-//search the Shipment details using Shipment Id
-func (t *ShipmentChaincode) getShipmentDetails(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	var ShipmentId, jsonResp string
-	var err error
-
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting shipment Id to query")
-	}
-
-	ShipmentId = args[0]
-	valAsbytes, err := stub.GetState(ShipmentId)
-	if err != nil {
-		jsonResp = "{\"Error\":\"Failed to get state for " + ShipmentId + "\"}"
-		return shim.Error(jsonResp)
-	} else if valAsbytes == nil {
-		jsonResp = "{\"Error\":\"shipment does not exist: " + ShipmentId + "\"}"
-		return shim.Error(jsonResp)
-	}
-
-	return shim.Success(valAsbytes)
-}
-
-func (t *ShipmentChaincode) updateTemparature(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	if len(args) < 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
-	}
-
-	ShipmentId := args[0]
-	newStatus := args[1]
-	fmt.Println("- update temperature ", ShipmentId, newStatus)
-
-	ShipmentAsBytes, err := stub.GetState(ShipmentId)
-	if err != nil {
-		return shim.Error("Failed to get shipment details:" + err.Error())
-	} else if ShipmentAsBytes == nil {
-		return shim.Error("shipment does not exist")
-	}
-
-	ShipmentToUpdate := Shipment{}
-	err = json.Unmarshal(ShipmentAsBytes, &ShipmentToUpdate) //unmarshal it aka JSON.parse()
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	ShipmentToUpdate.Temperature = newStatus //change the temperature
-
-	ShipmentJSONasBytes, _ := json.Marshal(ShipmentToUpdate)
-	err = stub.PutState(ShipmentId, ShipmentJSONasBytes) 
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-
-	fmt.Println("- end updateTemperature (success)")
-	return shim.Success(nil)
-}
-
-func (t *ShipmentChaincode) updateHumidity(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	if len(args) < 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
-	}
-
-	ShipmentId := args[0]
-	newStatus := args[1]
-	fmt.Println("- update humidity ", ShipmentId, newStatus)
-
-	ShipmentAsBytes, err := stub.GetState(ShipmentId)
-	if err != nil {
-		return shim.Error("Failed to get shipment details:" + err.Error())
-	} else if ShipmentAsBytes == nil {
-		return shim.Error("shimoent does not exist")
-	}
-
-	ShipmentToUpdate := Shipment{}
-	err = json.Unmarshal(ShipmentAsBytes, &ShipmentToUpdate) //unmarshal it aka JSON.parse()
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	ShipmentToUpdate.Humidity = newStatus //change the humidity
-
-	ShipmentJSONasBytes, _ := json.Marshal(ShipmentToUpdate)
-	err = stub.PutState(ShipmentId, ShipmentJSONasBytes)
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-
-	fmt.Println("- end updateHumidity (success)")
-	return shim.Success(nil)
-}
-
-func (t *ShipmentChaincode) updateLuminosity(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	if len(args) < 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
-	}
-
-	ShipmentId := args[0]
-	newStatus := args[1]
-	fmt.Println("- update Luminosity ", ShipmentId, newStatus)
-
-	ShipmentAsBytes, err := stub.GetState(ShipmentId)
-	if err != nil {
-		return shim.Error("Failed to get shipment details:" + err.Error())
-	} else if ShipmentAsBytes == nil {
-		return shim.Error("shipment does not exist")
-	}
-
-	ShipmentToUpdate := Shipment{}
-	err = json.Unmarshal(ShipmentAsBytes, &ShipmentToUpdate) //unmarshal it aka JSON.parse()
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	ShipmentToUpdate.Luminosity = newStatus //change the Luminosity
-
-	ShipmentJSONasBytes, _ := json.Marshal(ShipmentToUpdate)
-	err = stub.PutState(ShipmentId, ShipmentJSONasBytes) //rewrite the shipment
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-
-	fmt.Println("- end updateLuminosity (success)")
-	return shim.Success(nil)
-}
-
-func (t *ShipmentChaincode) updateCurrentLocation(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	if len(args) < 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
-	}
-
-	ShipmentId := args[0]
-	newLocation := args[1]
-	fmt.Println("- update current location ", ShipmentId, newLocation)
-
-	ShipmentAsBytes, err := stub.GetState(ShipmentId)
-	if err != nil {
-		return shim.Error("Failed to get shipment details:" + err.Error())
-	} else if ShipmentAsBytes == nil {
-		return shim.Error("shipment does not exist")
-	}
-
-	ShipmentToUpdate := Shipment{}
-	err = json.Unmarshal(ShipmentAsBytes, &ShipmentToUpdate) //unmarshal it aka JSON.parse()
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	ShipmentToUpdate.CurrentLocation = newLocation 
-
-	ShipmentJSONasBytes, _ := json.Marshal(ShipmentToUpdate)
-	err = stub.PutState(ShipmentId, ShipmentJSONasBytes) 
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-
-	fmt.Println("- end updateCurrentlocation (success)")
-	return shim.Success(nil)
-}
-
-func (t *ShipmentChaincode) updateDestinationCity(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	if len(args) < 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
-	}
-
-	ShipmentId := args[0]
-	newDestinationCity := args[1]
-	fmt.Println("- update destination city ", ShipmentId, newDestinationCity)
-
-	ShipmentAsBytes, err := stub.GetState(ShipmentId)
-	if err != nil {
-		return shim.Error("Failed to get shipment details:" + err.Error())
-	} else if ShipmentAsBytes == nil {
-		return shim.Error("shipment does not exist")
-	}
-
-	ShipmentToUpdate := Shipment{}
-	err = json.Unmarshal(ShipmentAsBytes, &ShipmentToUpdate) 
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	ShipmentToUpdate.DestinationCity = newDestinationCity 
-
-	ShipmentJSONasBytes, _ := json.Marshal(ShipmentToUpdate)
-	err = stub.PutState(ShipmentId, ShipmentJSONasBytes) 
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-
-	fmt.Println("- end updateDestinationCity (success)")
-	return shim.Success(nil)
-}
-
-func (t *ShipmentChaincode) updateOriginCity(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	if len(args) < 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
-	}
-
-	ShipmentId := args[0]
-	newOriginCity := args[1]
-	fmt.Println("- update temperature ", ShipmentId, newOriginCity)
-
-	ShipmentAsBytes, err := stub.GetState(ShipmentId)
-	if err != nil {
-		return shim.Error("Failed to get shipment details:" + err.Error())
-	} else if ShipmentAsBytes == nil {
-		return shim.Error("shipment does not exist")
-	}
-
-	ShipmentToUpdate := Shipment{}
-	err = json.Unmarshal(ShipmentAsBytes, &ShipmentToUpdate) 
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	ShipmentToUpdate.OriginCity = newOriginCity 
-
-	ShipmentJSONasBytes, _ := json.Marshal(ShipmentToUpdate)
-	err = stub.PutState(ShipmentId, ShipmentJSONasBytes) 
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-
-	fmt.Println("- end updateOriginCity (success)")
-	return shim.Success(nil)
-}
-
-func (t *ShipmentChaincode) updateShipmentStatus(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	if len(args) < 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
-	}
-
-	ShipmentId := args[0]
-	newStatus := args[1]
-	fmt.Println("- update Shipment status ", ShipmentId, newStatus)
-
-	ShipmentAsBytes, err := stub.GetState(ShipmentId)
-	if err != nil {
-		return shim.Error("Failed to get shipment details:" + err.Error())
-	} else if ShipmentAsBytes == nil {
-		return shim.Error("shipment does not exist")
-	}
-
-	ShipmentToUpdate := Shipment{}
-	err = json.Unmarshal(ShipmentAsBytes, &ShipmentToUpdate) 
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	ShipmentToUpdate.ShipmentCondition = newStatus 
-
-	ShipmentJSONasBytes, _ := json.Marshal(ShipmentToUpdate)
-	err = stub.PutState(ShipmentId, ShipmentJSONasBytes) 
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-
-	fmt.Println("- end updateShipmentStatus (success)")
-	return shim.Success(nil)
-}
-
-func (t *ShipmentChaincode) queryHistory(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-
-	if len(args) < 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
-	}
-
-	ShipmentId := args[0]
-
-	fmt.Printf("- start getHistoryForShipment: %s\n", ShipmentId)
-
-	resultsIterator, err := stub.GetHistoryForKey(ShipmentId)
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	defer resultsIterator.Close()
-
-	// buffer is a JSON array containing historic values for the shipment
-	var buffer bytes.Buffer
-	buffer.WriteString("[")
-
-	bArrayMemberAlreadyWritten := false
-	for resultsIterator.HasNext() {
-		response, err := resultsIterator.Next()
-		fmt.Println(response)
-		
-
-		if err != nil {
-			return shim.Error(err.Error())
-		}
-		// Add a comma before array members, suppress it for the first array member
-		if bArrayMemberAlreadyWritten == true {
-			buffer.WriteString(",")
-		}
-		buffer.WriteString("{\"TxId\":")
-		buffer.WriteString("\"")
-		buffer.WriteString(response.TxId)
-		buffer.WriteString("\"")
-
-		buffer.WriteString(", \"Value\":")
-		// if it was a delete operation on given key, then we need to set the
-		//corresponding value null. Else, we will write the response.Value
-		//as-is (as the Value itself a JSON )
-		if response.IsDelete {
-			buffer.WriteString("null")
-		} else {
-			buffer.WriteString(string(response.Value))
-		}
-		buffer.WriteString(", \"Timestamp\":")
-		buffer.WriteString("\"")
-		buffer.WriteString(time.Unix(response.Timestamp.Seconds, int64(response.Timestamp.Nanos)).String())
-		buffer.WriteString("\"")
-
-		buffer.WriteString(", \"IsDelete\":")
-		buffer.WriteString("\"")
-		buffer.WriteString(strconv.FormatBool(response.IsDelete))
-		buffer.WriteString("\"")
-
-		buffer.WriteString("}")
-		bArrayMemberAlreadyWritten = true
-
-	}
-	buffer.WriteString("]")
-
-	fmt.Printf("- returning history of the shipment:\n%s\n", buffer.String())
-
-	return shim.Success(buffer.Bytes())
-}
+//peer chaincode instantiate -n mycc -v 0 -c '{"Args":["Shipment","1","Buyer","Seller","CurrentLocation", "DestinationCity", "OriginCity", "ShipmentCondition", "Temperature", "Humidity", "Luminosity"]}' -C myc
+//peer chaincode invoke -n mycc -c '{"Args":["registerShipment","2","abc","xyz","NY","CA","NY","good_condition","100","",""]}' -C myc
+//peer chaincode invoke -n mycc -c '{"Args":["registerShipment","4","abc","xyz","kochi","Pune","Bangalore","good_condition","100","","28"]}' -C myc
+//peer chaincode invoke -n mycc -c '{"Args":["registerShipment","340123450000000017","abc","xyz","kochi","Pune","Bangalore","good_condition","100","",""]}' -C myc
+//peer chaincode invoke -n mycc -c '{"Args":["updateTemparature","2","100"]}' -C myc
+//peer chaincode invoke -n mycc -c '{"Args":["updateShipmentStatus","2","tampered","SEAL_BROKEN","seal broken on arrival at Pune"]}' -C myc
+//peer chaincode invoke -n mycc -c '{"Args":["updateHumidity","2","25"]}' -C myc
+//peer chaincode invoke -n mycc -c '{"Args":["updateLuminosity","2","18"]}' -C myc
+//peer chaincode invoke -n mycc -c '{"Args":["updateOriginCity","2","kochi"]}' -C myc
+// peer chaincode invoke -n mycc -c '{"Args":["updateCurrentLocation","2","Pune"]}' -C myc
+//peer chaincode invoke -n mycc -c '{"Args":["updateDestinationCity","2","Banagalore"]}' -C myc
+//peer chaincode query -n mycc -c '{"Args":["queryHistory","2"]}' -C myc
+//peer chaincode query -n mycc -c '{"Args":["getShipmentDetails","2"]}' -C myc
+//peer chaincode query -n mycc -c '{"Args":["getStatusChanges","2"]}' -C myc
+//peer chaincode query -n mycc -c '{"Args":["getShipmentProducts","2"]}' -C myc
+//peer chaincode invoke -n mycc -c '{"Args":["registerLabelKey","-----BEGIN PUBLIC KEY-----\n...\n-----END PUBLIC KEY-----\n"]}' -C myc
+//peer chaincode query -n mycc -c '{"Args":["getLabelKey","Org1MSP"]}' -C myc
+//peer chaincode query -n mycc -c '{"Args":["getLabelPayload","2"]}' -C myc
+//peer chaincode invoke -n mycc -c '{"Args":["decommission","2","LOST","not delivered, confirmed lost by carrier","true"]}' -C myc
+//peer chaincode query -n mycc -c '{"Args":["verifyLabel","{\"t\":\"S\",\"id\":\"2\",\"tx\":\"<txid>\",\"h\":\"<hash>\",\"n\":42,\"i\":\"Org1MSP\",\"s\":\"<signature>\"}"]}' -C myc
+
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RinuT/chaincode/caller"
+	"github.com/RinuT/chaincode/gs1"
+	"github.com/RinuT/chaincode/label"
+	"github.com/RinuT/chaincode/reason"
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+type ShipmentChaincode struct {
+}
+
+type Shipment struct {
+	ObjectType      string `json:"docType"` 
+	ShipmentId      string `json:"ShipmentId"` 
+	Buyer           string `json:"Buyer"`
+	Seller          string `json:"Seller"`
+	CurrentLocation string `json:"CurrentLocation"`
+	DestinationCity string `json:"DestinationCity"` 
+	OriginCity      string `json:"OriginCity"`
+	ShipmentCondition  string `json:"ShipmentCondition"`
+	Temperature     string `json:"Temperature"`
+	Humidity        string `json:"Humidity"`
+	Luminosity      string `json:"Luminosity"`
+	LastReadingDate string `json:"LastReadingDate"`
+	InExcursion     bool   `json:"InExcursion"`      //the last temperature reading was outside 2-8°C
+	ExcursionSeconds int64 `json:"ExcursionSeconds"` //total time spent outside 2-8°C
+	DecommissionReason string `json:"DecommissionReason"` //DESTROYED, SAMPLE, STOLEN or LOST
+	DecommissionDate   string `json:"DecommissionDate"`
+	DecommissionedBy   string `json:"DecommissionedBy"`
+	PurgedStateHash    string `json:"PurgedStateHash"` //sha256 of the record before its parties and places were purged
+}
+
+//why the shipment condition changed, who changed it and when
+type StatusChange struct {
+	ObjectType      string `json:"docType"`
+	ShipmentId      string `json:"ShipmentId"`
+	FromStatus      string `json:"FromStatus"`
+	ToStatus        string `json:"ToStatus"`
+	ReasonCode      string `json:"ReasonCode"`
+	Comment         string `json:"Comment"`
+	EvidenceHash    string `json:"EvidenceHash"` //hex SHA-256 of a supporting document
+	ChangedBy       string `json:"ChangedBy"`
+	ChangeDate      string `json:"ChangeDate"`
+}
+
+//the product chaincode (tracktrace.go) as installed on the same channel
+const productChaincode = "tracktrace"
+
+//the notification chaincode (notification.go) as installed on the same channel
+const notificationChaincode = "notification"
+
+//products on a shipment must stay within 2-8°C
+const (
+	minTemperature = 2.0
+	maxTemperature = 8.0
+)
+
+//why a shipment can be retired
+var decommissionReasons = map[string]bool{
+	"DESTROYED": true,
+	"SAMPLE":    true,
+	"STOLEN":    true,
+	"LOST":      true,
+}
+
+func main() {
+	err := shim.Start(new(ShipmentChaincode))
+	if err != nil {
+		fmt.Printf("Error starting Simple chaincode: %s", err)
+	}
+}
+
+//Initialization of the Shipment
+func (t *ShipmentChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	function, args := stub.GetFunctionAndParameters()
+	fmt.Println("init is running " + function)
+
+	ShipmentId := gs1.NormalizeSSCC(args[0])
+	Buyer := args[1]
+	Seller := args[2]
+	CurrentLocation := args[3]
+	DestinationCity := args[4]
+	OriginCity := args[5]
+	ShipmentCondition := args[6]
+	Temperature := args[7]
+	Humidity := args[8]
+	Luminosity := args[9]
+
+	// ==== Create Shipment object and marshal to JSON ====
+	objectType := "Shipment"
+	Shipment := &Shipment{ObjectType: objectType, ShipmentId: ShipmentId, Buyer: Buyer, Seller: Seller, CurrentLocation: CurrentLocation,
+		DestinationCity: DestinationCity, OriginCity: OriginCity, ShipmentCondition: ShipmentCondition, Temperature: Temperature, Humidity: Humidity, Luminosity: Luminosity}
+	ShipmentJSONasBytes, err := json.Marshal(Shipment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = stub.PutState(ShipmentId, ShipmentJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end init of shipment")
+
+	return shim.Success(nil)
+}
+
+//invoke function
+
+func (t *ShipmentChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	function, args := stub.GetFunctionAndParameters()
+	fmt.Println("invoke is running " + function)
+
+	// Handle different functions
+	if function == "registerShipment" {
+		return t.registerShipment(stub, args)
+	} else if function == "getShipmentDetails" {
+		return t.getShipmentDetails(stub, args)
+	} else if function == "updateTemparature" {
+		return t.updateTemparature(stub, args)
+	} else if function == "updateHumidity" {
+		return t.updateHumidity(stub, args)
+	} else if function == "updateLuminosity" {
+		return t.updateLuminosity(stub, args)
+	} else if function == "queryHistory" {
+		return t.queryHistory(stub, args)
+	} else if function == "updateOriginCity" {
+		return t.updateOriginCity(stub, args)
+	} else if function == "updateCurrentLocation" {
+		return t.updateCurrentLocation(stub, args)
+	} else if function == "updateDestinationCity" {
+		return t.updateDestinationCity(stub, args)
+	} else if function == "updateShipmentStatus" {
+		return t.updateShipmentStatus(stub, args)
+	} else if function == "getStatusChanges" {
+		return t.getStatusChanges(stub, args)
+	} else if function == "getShipmentProducts" {
+		return t.getShipmentProducts(stub, args)
+	} else if function == "getLabelPayload" {
+		return t.getLabelPayload(stub, args)
+	} else if function == "verifyLabel" {
+		return t.verifyLabel(stub, args)
+	} else if function == "decommission" {
+		return t.decommission(stub, args)
+	} else if function == "registerLabelKey" {
+		return t.registerLabelKey(stub, args)
+	} else if function == "getLabelKey" {
+		return t.getLabelKey(stub, args)
+	}
+
+	fmt.Println("invoke did not find func: " + function) //error
+	return shim.Error("Received unknown function invocation")
+}
+
+//Create an shipment with unique shipment Id
+func (t *ShipmentChaincode) registerShipment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+
+	// ==== Input sanitation ====
+	fmt.Println("- start registering shipment")
+
+	ShipmentId := args[0]
+	Buyer := args[1]
+	Seller := args[2]
+	CurrentLocation := args[3]
+	DestinationCity := args[4]
+	OriginCity := args[5]
+	ShipmentCondition := args[6]
+	Temperature := args[7]
+	Humidity := args[8]
+	Luminosity := args[9]
+
+	ShipmentId, err = normalizeShipmentId(ShipmentId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// ==== Check if shipment already exists ====
+	ShipmentAsBytes, err := stub.GetState(ShipmentId)
+	if err != nil {
+		return shim.Error("Failed to register shipment: " + err.Error())
+	} else if ShipmentAsBytes != nil {
+		fmt.Println("This shipment already exists: " + ShipmentId)
+		return shim.Error("This shipment already exists: " + ShipmentId)
+	}
+
+	// ==== Create Shipment object and marshal to JSON ====
+	if (Humidity == "undefined" || Humidity == "" || Humidity == "null" || Luminosity == "undefined" || Luminosity == "" || Luminosity == "null") {
+		objectType := "Shipment"
+		Shipment := &Shipment{ObjectType: objectType, ShipmentId: ShipmentId, Buyer: Buyer, Seller: Seller, CurrentLocation: CurrentLocation,
+			DestinationCity: DestinationCity, OriginCity: OriginCity, ShipmentCondition: ShipmentCondition, Temperature: Temperature, Humidity: Humidity, Luminosity: Luminosity}
+		fmt.Println(Shipment)
+		ShipmentJSONasBytes, err := json.Marshal(Shipment)
+		fmt.Println(ShipmentJSONasBytes)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		// === Save Shipment to state ===
+		err = stub.PutState(ShipmentId, ShipmentJSONasBytes)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	fmt.Println("- end registering shimpment")
+	return shim.Success(nil)
+
+}
+
+//search the Shipment details using Shipment Id
+func (t *ShipmentChaincode) getShipmentDetails(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var ShipmentId, jsonResp string
+	var err error
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting shipment Id to query")
+	}
+
+	ShipmentId = gs1.NormalizeSSCC(args[0])
+	valAsbytes, err := stub.GetState(ShipmentId)
+	if err != nil {
+		jsonResp = "{\"Error\":\"Failed to get state for " + ShipmentId + "\"}"
+		return shim.Error(jsonResp)
+	} else if valAsbytes == nil {
+		jsonResp = "{\"Error\":\"shipment does not exist: " + ShipmentId + "\"}"
+		return shim.Error(jsonResp)
+	}
+
+	return shim.Success(valAsbytes)
+}
+
+func (t *ShipmentChaincode) updateTemparature(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	ShipmentId := gs1.NormalizeSSCC(args[0])
+	newStatus := args[1]
+	fmt.Println("- update temperature ", ShipmentId, newStatus)
+
+	ShipmentAsBytes, err := stub.GetState(ShipmentId)
+	if err != nil {
+		return shim.Error("Failed to get shipment details:" + err.Error())
+	} else if ShipmentAsBytes == nil {
+		return shim.Error("shipment does not exist")
+	}
+
+	ShipmentToUpdate := Shipment{}
+	err = json.Unmarshal(ShipmentAsBytes, &ShipmentToUpdate) //unmarshal it aka JSON.parse()
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkDecommissioned(ShipmentToUpdate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	readingDate := time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos)).UTC()
+
+	// the time since the previous reading counts as excursion when that reading was out of range
+	excursionSeconds := int64(0)
+	if ShipmentToUpdate.InExcursion && ShipmentToUpdate.LastReadingDate != "" {
+		lastReadingDate, err := time.Parse(time.RFC3339, ShipmentToUpdate.LastReadingDate)
+		if err == nil && readingDate.After(lastReadingDate) {
+			excursionSeconds = int64(readingDate.Sub(lastReadingDate).Seconds())
+		}
+	}
+
+	// readings that are not numbers cannot be judged, they are stored as they came
+	wasInExcursion := ShipmentToUpdate.InExcursion
+	temperature, err := strconv.ParseFloat(newStatus, 64)
+	outOfRange := err == nil && (temperature < minTemperature || temperature > maxTemperature)
+	if err == nil {
+		ShipmentToUpdate.InExcursion = outOfRange
+	}
+
+	ShipmentToUpdate.Temperature = newStatus //change the temperature
+	ShipmentToUpdate.LastReadingDate = readingDate.Format(time.RFC3339)
+	ShipmentToUpdate.ExcursionSeconds += excursionSeconds
+
+	ShipmentJSONasBytes, _ := json.Marshal(ShipmentToUpdate)
+	err = stub.PutState(ShipmentId, ShipmentJSONasBytes) 
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// deduct the excursion from the stability budget of every product on board and quarantine
+	// them while out of range, in one call as the product chaincode cannot read its own writes.
+	// The buyer and seller go along, the product chaincode cannot call back for them
+	if excursionSeconds > 0 || outOfRange {
+		stabilityArgs := []string{"deduct_stability", ShipmentId, ShipmentToUpdate.Buyer, ShipmentToUpdate.Seller,
+			strconv.FormatInt(excursionSeconds, 10)}
+		if outOfRange {
+			stabilityArgs = append(stabilityArgs, "TEMPERATURE_EXCURSION", "temperature "+newStatus+" outside 2-8°C")
+		}
+		response := stub.InvokeChaincode(productChaincode, util.ToChaincodeArgs(stabilityArgs...), "")
+		if response.Status != shim.OK {
+			return shim.Error("Failed to update products on shipment " + ShipmentId + ": " + response.Message)
+		}
+	}
+	// buyer and seller hear of an excursion when it starts, not on every reading
+	if outOfRange && !wasInExcursion {
+		notify(stub, "EXCURSION", ShipmentId, "shipment "+ShipmentId+" reads "+newStatus+"°C, outside 2-8°C", ShipmentToUpdate.Buyer, ShipmentToUpdate.Seller)
+	}
+
+	fmt.Println("- end updateTemperature (success)")
+	return shim.Success(nil)
+}
+
+func (t *ShipmentChaincode) updateHumidity(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	ShipmentId := gs1.NormalizeSSCC(args[0])
+	newStatus := args[1]
+	fmt.Println("- update humidity ", ShipmentId, newStatus)
+
+	ShipmentAsBytes, err := stub.GetState(ShipmentId)
+	if err != nil {
+		return shim.Error("Failed to get shipment details:" + err.Error())
+	} else if ShipmentAsBytes == nil {
+		return shim.Error("shimoent does not exist")
+	}
+
+	ShipmentToUpdate := Shipment{}
+	err = json.Unmarshal(ShipmentAsBytes, &ShipmentToUpdate) //unmarshal it aka JSON.parse()
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkDecommissioned(ShipmentToUpdate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	ShipmentToUpdate.Humidity = newStatus //change the humidity
+
+	ShipmentJSONasBytes, _ := json.Marshal(ShipmentToUpdate)
+	err = stub.PutState(ShipmentId, ShipmentJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end updateHumidity (success)")
+	return shim.Success(nil)
+}
+
+func (t *ShipmentChaincode) updateLuminosity(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	ShipmentId := gs1.NormalizeSSCC(args[0])
+	newStatus := args[1]
+	fmt.Println("- update Luminosity ", ShipmentId, newStatus)
+
+	ShipmentAsBytes, err := stub.GetState(ShipmentId)
+	if err != nil {
+		return shim.Error("Failed to get shipment details:" + err.Error())
+	} else if ShipmentAsBytes == nil {
+		return shim.Error("shipment does not exist")
+	}
+
+	ShipmentToUpdate := Shipment{}
+	err = json.Unmarshal(ShipmentAsBytes, &ShipmentToUpdate) //unmarshal it aka JSON.parse()
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkDecommissioned(ShipmentToUpdate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	ShipmentToUpdate.Luminosity = newStatus //change the Luminosity
+
+	ShipmentJSONasBytes, _ := json.Marshal(ShipmentToUpdate)
+	err = stub.PutState(ShipmentId, ShipmentJSONasBytes) //rewrite the shipment
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end updateLuminosity (success)")
+	return shim.Success(nil)
+}
+
+func (t *ShipmentChaincode) updateCurrentLocation(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	ShipmentId := gs1.NormalizeSSCC(args[0])
+	newLocation := args[1]
+	fmt.Println("- update current location ", ShipmentId, newLocation)
+
+	ShipmentAsBytes, err := stub.GetState(ShipmentId)
+	if err != nil {
+		return shim.Error("Failed to get shipment details:" + err.Error())
+	} else if ShipmentAsBytes == nil {
+		return shim.Error("shipment does not exist")
+	}
+
+	ShipmentToUpdate := Shipment{}
+	err = json.Unmarshal(ShipmentAsBytes, &ShipmentToUpdate) //unmarshal it aka JSON.parse()
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkDecommissioned(ShipmentToUpdate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	ShipmentToUpdate.CurrentLocation = newLocation 
+
+	ShipmentJSONasBytes, _ := json.Marshal(ShipmentToUpdate)
+	err = stub.PutState(ShipmentId, ShipmentJSONasBytes) 
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end updateCurrentlocation (success)")
+	return shim.Success(nil)
+}
+
+func (t *ShipmentChaincode) updateDestinationCity(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	ShipmentId := gs1.NormalizeSSCC(args[0])
+	newDestinationCity := args[1]
+	fmt.Println("- update destination city ", ShipmentId, newDestinationCity)
+
+	ShipmentAsBytes, err := stub.GetState(ShipmentId)
+	if err != nil {
+		return shim.Error("Failed to get shipment details:" + err.Error())
+	} else if ShipmentAsBytes == nil {
+		return shim.Error("shipment does not exist")
+	}
+
+	ShipmentToUpdate := Shipment{}
+	err = json.Unmarshal(ShipmentAsBytes, &ShipmentToUpdate) 
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkDecommissioned(ShipmentToUpdate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	ShipmentToUpdate.DestinationCity = newDestinationCity 
+
+	ShipmentJSONasBytes, _ := json.Marshal(ShipmentToUpdate)
+	err = stub.PutState(ShipmentId, ShipmentJSONasBytes) 
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end updateDestinationCity (success)")
+	return shim.Success(nil)
+}
+
+func (t *ShipmentChaincode) updateOriginCity(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	ShipmentId := gs1.NormalizeSSCC(args[0])
+	newOriginCity := args[1]
+	fmt.Println("- update temperature ", ShipmentId, newOriginCity)
+
+	ShipmentAsBytes, err := stub.GetState(ShipmentId)
+	if err != nil {
+		return shim.Error("Failed to get shipment details:" + err.Error())
+	} else if ShipmentAsBytes == nil {
+		return shim.Error("shipment does not exist")
+	}
+
+	ShipmentToUpdate := Shipment{}
+	err = json.Unmarshal(ShipmentAsBytes, &ShipmentToUpdate) 
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkDecommissioned(ShipmentToUpdate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	ShipmentToUpdate.OriginCity = newOriginCity 
+
+	ShipmentJSONasBytes, _ := json.Marshal(ShipmentToUpdate)
+	err = stub.PutState(ShipmentId, ShipmentJSONasBytes) 
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end updateOriginCity (success)")
+	return shim.Success(nil)
+}
+
+//change the shipment condition with a reason code, optional comment and evidence hash
+func (t *ShipmentChaincode) updateShipmentStatus(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 3 || len(args) > 5 {
+		return shim.Error("Incorrect number of arguments. Expecting shipment id, status, reason code, optional comment and evidence hash")
+	}
+
+	ShipmentId := gs1.NormalizeSSCC(args[0])
+	newStatus := args[1]
+	ReasonCode := strings.ToUpper(args[2])
+	Comment := ""
+	if len(args) > 3 {
+		Comment = strings.TrimSpace(args[3])
+	}
+	EvidenceHash := ""
+	if len(args) > 4 {
+		EvidenceHash = strings.ToLower(args[4])
+	}
+	fmt.Println("- update Shipment status ", ShipmentId, newStatus, ReasonCode)
+
+	if !reason.IsShipmentCode(ReasonCode) {
+		return shim.Error("Unknown reason code: " + args[2])
+	}
+	if ReasonCode == "OTHER" && Comment == "" {
+		return shim.Error("Reason code OTHER needs a comment")
+	}
+	if EvidenceHash != "" {
+		hash, err := hex.DecodeString(EvidenceHash)
+		if err != nil || len(hash) != sha256.Size {
+			return shim.Error("Evidence hash must be a hex SHA-256 digest")
+		}
+	}
+
+	ShipmentAsBytes, err := stub.GetState(ShipmentId)
+	if err != nil {
+		return shim.Error("Failed to get shipment details:" + err.Error())
+	} else if ShipmentAsBytes == nil {
+		return shim.Error("shipment does not exist")
+	}
+
+	ShipmentToUpdate := Shipment{}
+	err = json.Unmarshal(ShipmentAsBytes, &ShipmentToUpdate) 
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkDecommissioned(ShipmentToUpdate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	ChangedBy, err := caller.Id(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	change := StatusChange{ObjectType: "statuschange", ShipmentId: ShipmentId, FromStatus: ShipmentToUpdate.ShipmentCondition, ToStatus: newStatus,
+		ReasonCode: ReasonCode, Comment: Comment, EvidenceHash: EvidenceHash, ChangedBy: ChangedBy,
+		ChangeDate: time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos)).UTC().Format(time.RFC3339)}
+	changeKey, err := stub.CreateCompositeKey("statuschange", []string{ShipmentId, stub.GetTxID()})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	changeJSONasBytes, err := json.Marshal(change)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(changeKey, changeJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	ShipmentToUpdate.ShipmentCondition = newStatus 
+
+	ShipmentJSONasBytes, _ := json.Marshal(ShipmentToUpdate)
+	err = stub.PutState(ShipmentId, ShipmentJSONasBytes) 
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if strings.ToUpper(newStatus) == "TAMPERED" {
+		err = notifyProducts(stub, ShipmentToUpdate, "TAMPERED", ReasonCode, Comment)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	fmt.Println("- end updateShipmentStatus (success)")
+	return shim.Success(nil)
+}
+
+func (t *ShipmentChaincode) queryHistory(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	if len(args) < 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	ShipmentId := gs1.NormalizeSSCC(args[0])
+
+	fmt.Printf("- start getHistoryForShipment: %s\n", ShipmentId)
+
+	resultsIterator, err := stub.GetHistoryForKey(ShipmentId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	// buffer is a JSON array containing historic values for the shipment
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+
+	bArrayMemberAlreadyWritten := false
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		fmt.Println(response)
+		
+
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		// Add a comma before array members, suppress it for the first array member
+		if bArrayMemberAlreadyWritten == true {
+			buffer.WriteString(",")
+		}
+		buffer.WriteString("{\"TxId\":")
+		buffer.WriteString("\"")
+		buffer.WriteString(response.TxId)
+		buffer.WriteString("\"")
+
+		buffer.WriteString(", \"Value\":")
+		// if it was a delete operation on given key, then we need to set the
+		//corresponding value null. Else, we will write the response.Value
+		//as-is (as the Value itself a JSON )
+		if response.IsDelete {
+			buffer.WriteString("null")
+		} else {
+			buffer.WriteString(string(response.Value))
+		}
+		buffer.WriteString(", \"Timestamp\":")
+		buffer.WriteString("\"")
+		buffer.WriteString(time.Unix(response.Timestamp.Seconds, int64(response.Timestamp.Nanos)).String())
+		buffer.WriteString("\"")
+
+		buffer.WriteString(", \"IsDelete\":")
+		buffer.WriteString("\"")
+		buffer.WriteString(strconv.FormatBool(response.IsDelete))
+		buffer.WriteString("\"")
+
+		buffer.WriteString("}")
+		bArrayMemberAlreadyWritten = true
+
+	}
+	buffer.WriteString("]")
+
+	fmt.Printf("- returning history of the shipment:\n%s\n", buffer.String())
+
+	return shim.Success(buffer.Bytes())
+}
+
+//every recorded status change of a shipment
+func (t *ShipmentChaincode) getStatusChanges(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting shipment Id to query")
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("statuschange", []string{gs1.NormalizeSSCC(args[0])})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	changes := []StatusChange{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		change := StatusChange{}
+		err = json.Unmarshal(queryResponse.Value, &change)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		changes = append(changes, change)
+	}
+
+	changesAsBytes, err := json.Marshal(changes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(changesAsBytes)
+}
+
+//which units are on a shipment, read from the product chaincode
+func (t *ShipmentChaincode) getShipmentProducts(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting shipment Id to query")
+	}
+
+	response := stub.InvokeChaincode(productChaincode, util.ToChaincodeArgs("products_on_shipment", gs1.NormalizeSSCC(args[0])), "")
+	if response.Status != shim.OK {
+		return shim.Error("Failed to get products on shipment: " + response.Message)
+	}
+	return shim.Success(response.Payload)
+}
+
+//pass a tampering or excursion on to the products the shipment carries. The buyer and seller
+//go along, the product chaincode checks the caller against them and cannot call back for them
+func notifyProducts(stub shim.ChaincodeStubInterface, shipment Shipment, Incident string, ReasonCode string, Comment string) error {
+	response := stub.InvokeChaincode(productChaincode, util.ToChaincodeArgs("shipment_incident", shipment.ShipmentId, shipment.Buyer, shipment.Seller,
+		Incident, ReasonCode, Comment), "")
+	if response.Status != shim.OK {
+		return fmt.Errorf("Failed to update products on shipment %s: %s", shipment.ShipmentId, response.Message)
+	}
+	return nil
+}
+
+//leave a notification in the inbox of each recipient and emit it as a chaincode event.
+//A transaction carries one event only, so call it once per transaction. Notifying is best
+//effort: a failure is logged and the reading it reports is still recorded
+func notify(stub shim.ChaincodeStubInterface, Type string, Reference string, Message string, Recipients ...string) {
+	notifyArgs := append([]string{"notify", Type, Reference, Message}, Recipients...)
+	response := stub.InvokeChaincode(notificationChaincode, util.ToChaincodeArgs(notifyArgs...), "")
+	if response.Status != shim.OK {
+		fmt.Println("- failed to notify " + strings.Join(Recipients, ", ") + ": " + response.Message)
+		return
+	}
+	err := stub.SetEvent("NotificationEvent", response.Payload)
+	if err != nil {
+		fmt.Println("- failed to emit notification event: " + err.Error())
+	}
+}
+
+//the unsigned payload to encode in the QR code of a shipment label. The caller signs the returned
+//bytes as they are with its label key and sets s. Call it as a query, the height changes per block
+func (t *ShipmentChaincode) getLabelPayload(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting shipment Id")
+	}
+
+	ShipmentId := gs1.NormalizeSSCC(args[0])
+	ShipmentAsBytes, err := stub.GetState(ShipmentId)
+	if err != nil {
+		return shim.Error("Failed to get shipment details:" + err.Error())
+	} else if ShipmentAsBytes == nil {
+		return shim.Error("shipment does not exist")
+	}
+
+	_, TxId, _, err := label.GetLabelledState(stub, ShipmentId, "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	stateHash := sha256.Sum256(ShipmentAsBytes)
+	payload, err := label.Stamp(stub, label.Payload{Type: "S", Id: ShipmentId, TxId: TxId, StateHash: hex.EncodeToString(stateHash[:])})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	payloadAsBytes, err := json.Marshal(payload)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(payloadAsBytes)
+}
+
+//check the signature of a scanned shipment label and the state it carries against the ledger
+func (t *ShipmentChaincode) verifyLabel(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting the scanned label payload")
+	}
+
+	payload := label.Payload{}
+	err := json.Unmarshal([]byte(args[0]), &payload)
+	if err != nil || payload.Id == "" || payload.TxId == "" || payload.StateHash == "" {
+		return shim.Error("Label payload is not readable")
+	}
+	if payload.Type != "S" {
+		return shim.Error("Label is not a shipment label")
+	}
+
+	verification := label.Verification{Id: payload.Id}
+	labelledAsBytes, latestTxId, found, err := label.GetLabelledState(stub, payload.Id, payload.TxId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	stateHash := sha256.Sum256(labelledAsBytes)
+	err = label.Verify(stub, payload)
+	verification.Signed = err == nil
+	if !verification.Signed {
+		verification.Reason = err.Error()
+	} else if !found {
+		verification.Reason = "no such shipment state on the ledger"
+	} else if hex.EncodeToString(stateHash[:]) != strings.ToLower(payload.StateHash) {
+		verification.Reason = "state hash does not match the ledger"
+	} else {
+		verification.Genuine = true
+		verification.Current = payload.TxId == latestTxId
+		if !verification.Current {
+			verification.Reason = "shipment record changed since the label was printed"
+		}
+	}
+
+	ShipmentAsBytes, err := stub.GetState(payload.Id)
+	if err == nil && ShipmentAsBytes != nil {
+		shipment := Shipment{}
+		if json.Unmarshal(ShipmentAsBytes, &shipment) == nil {
+			verification.Status = shipment.ShipmentCondition
+		}
+	}
+
+	verificationAsBytes, err := json.Marshal(verification)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(verificationAsBytes)
+}
+
+//register the PEM public key the caller's organisation signs shipment labels with
+func (t *ShipmentChaincode) registerLabelKey(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting PEM public key")
+	}
+
+	err := label.RegisterKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+//the PEM public key an MSP signs shipment labels with, for checking labels offline
+func (t *ShipmentChaincode) getLabelKey(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting MSP id")
+	}
+
+	keyAsBytes, err := label.GetKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(keyAsBytes)
+}
+
+//a shipment id given as an SSCC, either as 18 digits or with the (00) application
+//identifier in front, must carry a valid check digit and is kept as the bare 18 digits.
+//Other ids such as "2" are free references
+func normalizeShipmentId(ShipmentId string) (string, error) {
+	sscc := gs1.NormalizeSSCC(ShipmentId)
+	if sscc == ShipmentId && (len(ShipmentId) != 18 || strings.Trim(ShipmentId, "0123456789") != "") {
+		return ShipmentId, nil
+	}
+	if !gs1.IsValidSSCC(sscc) {
+		return "", fmt.Errorf("shipment id %s is not a valid SSCC", ShipmentId)
+	}
+	return sscc, nil
+}
+
+//a decommissioned shipment stays as it was retired
+func checkDecommissioned(shipment Shipment) error {
+	if shipment.DecommissionDate != "" {
+		return fmt.Errorf("shipment %s was decommissioned as %s and cannot be changed", shipment.ShipmentId, shipment.DecommissionReason)
+	}
+	return nil
+}
+
+//retire a shipment, regulator or QA only. The record stays readable as a tombstone and
+//can no longer be changed. With purge set to true the buyer, seller and places are cleared
+//from world state and only a hash of them is kept, the ledger history still holds the earlier values.
+//args are shipment id, reason, comment and an optional purge flag
+func (t *ShipmentChaincode) decommission(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 && len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting shipment id, reason, comment and optional purge flag")
+	}
+
+	ShipmentId := gs1.NormalizeSSCC(args[0])
+	Reason := strings.ToUpper(args[1])
+	Comment := strings.TrimSpace(args[2])
+	Purge := false
+	if len(args) == 4 && args[3] != "" {
+		var err error
+		Purge, err = strconv.ParseBool(args[3])
+		if err != nil {
+			return shim.Error("purge must be true or false")
+		}
+	}
+	fmt.Println("- start decommission ", ShipmentId, Reason, Purge)
+
+	if !decommissionReasons[Reason] {
+		return shim.Error("Unknown decommission reason " + Reason + ", expecting DESTROYED, SAMPLE, STOLEN or LOST")
+	}
+	if Comment == "" {
+		return shim.Error("A comment is required to decommission a shipment")
+	}
+	Role, err := caller.Role(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if Role != "regulator" && Role != "qa" {
+		return shim.Error("Only a regulator or QA identity can decommission a shipment")
+	}
+
+	ShipmentAsBytes, err := stub.GetState(ShipmentId)
+	if err != nil {
+		return shim.Error("Failed to get shipment details:" + err.Error())
+	} else if ShipmentAsBytes == nil {
+		return shim.Error("shipment does not exist")
+	}
+
+	ShipmentToUpdate := Shipment{}
+	err = json.Unmarshal(ShipmentAsBytes, &ShipmentToUpdate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkDecommissioned(ShipmentToUpdate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	DecommissionedBy, err := caller.Id(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	DecommissionDate := time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos)).UTC().Format(time.RFC3339)
+
+	change := StatusChange{ObjectType: "statuschange", ShipmentId: ShipmentId, FromStatus: ShipmentToUpdate.ShipmentCondition, ToStatus: "DECOMMISSIONED",
+		ReasonCode: "DECOMMISSION", Comment: Reason + ": " + Comment, ChangedBy: DecommissionedBy, ChangeDate: DecommissionDate}
+	changeKey, err := stub.CreateCompositeKey("statuschange", []string{ShipmentId, stub.GetTxID()})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	changeJSONasBytes, err := json.Marshal(change)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(changeKey, changeJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	ShipmentToUpdate.ShipmentCondition = "DECOMMISSIONED"
+	ShipmentToUpdate.DecommissionReason = Reason
+	ShipmentToUpdate.DecommissionDate = DecommissionDate
+	ShipmentToUpdate.DecommissionedBy = DecommissionedBy
+
+	if Purge {
+		ShipmentJSONasBytes, err := json.Marshal(ShipmentToUpdate)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		stateHash := sha256.Sum256(ShipmentJSONasBytes)
+		ShipmentToUpdate.PurgedStateHash = hex.EncodeToString(stateHash[:])
+		ShipmentToUpdate.Buyer = ""
+		ShipmentToUpdate.Seller = ""
+		ShipmentToUpdate.CurrentLocation = ""
+		ShipmentToUpdate.DestinationCity = ""
+		ShipmentToUpdate.OriginCity = ""
+	}
+
+	ShipmentJSONasBytes, _ := json.Marshal(ShipmentToUpdate)
+	err = stub.PutState(ShipmentId, ShipmentJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end decommission (success)")
+	return shim.Success(nil)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RinuT/chaincode/chaincodetest"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+var (
+	seller = chaincodetest.Identity("DistributorMSP", "")
+	buyer  = chaincodetest.Identity("HospitalMSP", "")
+)
+
+//stands in for the product chaincode (tracktrace.go) and keeps the args of every call
+type productChaincodeRecorder struct {
+	calls [][]string
+}
+
+func (r *productChaincodeRecorder) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (r *productChaincodeRecorder) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	r.calls = append(r.calls, stub.GetStringArgs())
+	return shim.Success(nil)
+}
+
+//the shipment chaincode next to a recording product chaincode
+func newShipmentChannel() (*chaincodetest.Channel, *chaincodetest.Stub, *productChaincodeRecorder) {
+	channel := chaincodetest.NewChannel()
+	shipments := channel.Install("mycc", new(ShipmentChaincode))
+	recorder := &productChaincodeRecorder{}
+	channel.Install(productChaincode, recorder)
+	return channel, shipments, recorder
+}
+
+func invokeOK(t *testing.T, stub *chaincodetest.Stub, creator []byte, args ...string) []byte {
+	t.Helper()
+	response := stub.Invoke(creator, args...)
+	if response.Status != shim.OK {
+		t.Fatalf("%s: %s", args[0], response.Message)
+	}
+	return response.Payload
+}
+
+//a shipment sold by the distributor to the hospital
+func registerTestShipment(t *testing.T, shipments *chaincodetest.Stub, ShipmentId string) {
+	t.Helper()
+	invokeOK(t, shipments, seller, "registerShipment", ShipmentId, "HospitalMSP", "DistributorMSP", "Kochi", "Pune", "Kochi",
+		"good_condition", "5", "", "")
+}
+
+func TestTamperingPassesPartiesToProducts(t *testing.T) {
+	_, shipments, recorder := newShipmentChannel()
+	registerTestShipment(t, shipments, "SHIP1")
+
+	invokeOK(t, shipments, buyer, "updateShipmentStatus", "SHIP1", "tampered", "SEAL_BROKEN", "seal broken on arrival")
+	want := "shipment_incident SHIP1 HospitalMSP DistributorMSP TAMPERED SEAL_BROKEN seal broken on arrival"
+	if len(recorder.calls) != 1 || strings.Join(recorder.calls[0], " ") != want {
+		t.Fatalf("product chaincode called with %q, expecting %q", recorder.calls, want)
+	}
+}
+
+func TestExcursionPassesPartiesToProducts(t *testing.T) {
+	channel, shipments, recorder := newShipmentChannel()
+	registerTestShipment(t, shipments, "SHIP1")
+
+	start := channel.Now
+	invokeOK(t, shipments, seller, "updateTemparature", "SHIP1", "12")
+	channel.Now = start.Add(10 * time.Minute)
+	invokeOK(t, shipments, seller, "updateTemparature", "SHIP1", "6")
+	want := []string{
+		"deduct_stability SHIP1 HospitalMSP DistributorMSP 0 TEMPERATURE_EXCURSION temperature 12 outside 2-8°C",
+		"deduct_stability SHIP1 HospitalMSP DistributorMSP 600",
+	}
+	if len(recorder.calls) != len(want) {
+		t.Fatalf("product chaincode called with %q, expecting %q", recorder.calls, want)
+	}
+	for i, call := range recorder.calls {
+		if strings.Join(call, " ") != want[i] {
+			t.Fatalf("product chaincode called with %q, expecting %q", strings.Join(call, " "), want[i])
+		}
+	}
+}
+
+func TestShipmentIdIsBareSSCC(t *testing.T) {
+	_, shipments, _ := newShipmentChannel()
+
+	response := shipments.Invoke(seller, "registerShipment", "(00)106141412345678909", "HospitalMSP", "DistributorMSP", "Kochi", "Pune",
+		"Kochi", "good_condition", "5", "", "")
+	if response.Status == shim.OK || !strings.Contains(response.Message, "is not a valid SSCC") {
+		t.Fatalf("registered an SSCC with a wrong check digit: %+v", response)
+	}
+	registerTestShipment(t, shipments, "(00)106141412345678908")
+	if _, found := shipments.State["106141412345678908"]; !found {
+		t.Fatal("the shipment is not kept under the bare 18 digits of its SSCC")
+	}
+	response = shipments.Invoke(seller, "registerShipment", "106141412345678908", "HospitalMSP", "DistributorMSP", "Kochi", "Pune",
+		"Kochi", "good_condition", "5", "", "")
+	if response.Status == shim.OK {
+		t.Fatal("registered the same SSCC twice, with and without (00)")
+	}
+	for _, ShipmentId := range []string{"106141412345678908", "(00)106141412345678908"} {
+		if response = shipments.Query(buyer, "getShipmentDetails", ShipmentId); response.Status != shim.OK {
+			t.Fatalf("getShipmentDetails %s: %s", ShipmentId, response.Message)
+		}
+	}
+}
+
+func TestDecommissionShipment(t *testing.T) {
+	_, shipments, recorder := newShipmentChannel()
+	registerTestShipment(t, shipments, "SHIP1")
+	regulator := chaincodetest.Identity("RegulatorMSP", "regulator")
+
+	response := shipments.Invoke(seller, "decommission", "SHIP1", "LOST", "not delivered")
+	if response.Status == shim.OK || !strings.Contains(response.Message, "Only a regulator or QA identity can decommission a shipment") {
+		t.Fatalf("the seller decommissioned a shipment: %+v", response)
+	}
+	response = shipments.Invoke(regulator, "decommission", "SHIP1", "LOST", " ")
+	if response.Status == shim.OK || !strings.Contains(response.Message, "A comment is required to decommission a shipment") {
+		t.Fatalf("decommissioned a shipment without a comment: %+v", response)
+	}
+	invokeOK(t, shipments, regulator, "decommission", "SHIP1", "lost", "not delivered, confirmed lost by carrier", "true")
+
+	shipment := Shipment{}
+	if err := json.Unmarshal(shipments.State["SHIP1"], &shipment); err != nil {
+		t.Fatal(err)
+	}
+	if shipment.ShipmentCondition != "DECOMMISSIONED" || shipment.DecommissionReason != "LOST" || shipment.Buyer != "" ||
+		shipment.Seller != "" || len(shipment.PurgedStateHash) != 64 {
+		t.Fatalf("shipment = %+v, expecting a LOST tombstone with its parties purged and a hash of them kept", shipment)
+	}
+	response = shipments.Invoke(seller, "updateShipmentStatus", "SHIP1", "tampered", "SEAL_BROKEN", "seal broken on arrival")
+	if response.Status == shim.OK || !strings.Contains(response.Message, "shipment SHIP1 was decommissioned as LOST and cannot be changed") {
+		t.Fatalf("changed a decommissioned shipment: %+v", response)
+	}
+	response = shipments.Invoke(regulator, "decommission", "SHIP1", "STOLEN", "again")
+	if response.Status == shim.OK || !strings.Contains(response.Message, "was decommissioned as LOST") {
+		t.Fatalf("decommissioned a shipment twice: %+v", response)
+	}
+	if len(recorder.calls) != 0 {
+		t.Fatalf("product chaincode called with %q for a decommissioned shipment", recorder.calls)
+	}
+}
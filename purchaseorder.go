@@ -0,0 +1,1872 @@
+//peer chaincode instantiate -n purchaseorder -v 0 -c '{"Args":["init"]}' -C myc
+//peer chaincode invoke -n purchaseorder -c '{"Args":["createPurchaseOrder","4500001","FlextronicsMSP","10","SE-100234","500","EA","12.50","EUR","2018-09-30"]}' -C myc
+//peer chaincode invoke -n purchaseorder -c '{"Args":["addPurchaseOrderLine","4500001","20","SE-100871","200","EA","3.10","EUR","2018-10-15"]}' -C myc
+//peer chaincode invoke -n purchaseorder -c '{"Args":["updateLineStatus","4500001","10","CLOSED","SHORT_CLOSED","remaining quantity no longer needed"]}' -C myc
+//peer chaincode query -n purchaseorder -c '{"Args":["getPurchaseOrder","4500001"]}' -C myc
+//peer chaincode query -n purchaseorder -c '{"Args":["queryPurchaseOrders","FlextronicsMSP","2018-09-01","2018-09-30"]}' -C myc
+//peer chaincode query -n purchaseorder -c '{"Args":["getStatusChanges","4500001"]}' -C myc
+//peer chaincode invoke -n purchaseorder -c '{"Args":["acknowledgePurchaseOrder","4500001","CONFIRM",""]}' -C myc
+//peer chaincode invoke -n purchaseorder -c '{"Args":["proposeChange","4500001","capacity limited until October","10","400","","2018-10-07"]}' -C myc
+//peer chaincode invoke -n purchaseorder -c '{"Args":["acceptChange","4500001","<change id>"]}' -C myc
+//peer chaincode invoke -n purchaseorder -c '{"Args":["rejectChange","4500001","<change id>","delivery date too late"]}' -C myc
+//peer chaincode query -n purchaseorder -c '{"Args":["getChangeOrders","4500001"]}' -C myc
+//peer chaincode query -n purchaseorder -c '{"Args":["getRevisions","4500001"]}' -C myc
+//peer chaincode invoke -n purchaseorder -c '{"Args":["createASN","DN-7781","4500001","SH-1001","2018-09-25","Chennai","Grenoble","10","250","B-20180901"]}' -C myc
+//peer chaincode query -n purchaseorder -c '{"Args":["getASN","4500001","DN-7781"]}' -C myc
+//peer chaincode query -n purchaseorder -c '{"Args":["getASNs","4500001"]}' -C myc
+//peer chaincode invoke -n purchaseorder -c '{"Args":["recordGoodsReceipt","GR-5001","4500001","DN-7781","2018-09-28","10","B-20180901","240"]}' -C myc
+//peer chaincode query -n purchaseorder -c '{"Args":["getGoodsReceipts","4500001"]}' -C myc
+//peer chaincode query -n purchaseorder -c '{"Args":["getDiscrepancies","FlextronicsMSP"]}' -C myc
+//peer chaincode invoke -n purchaseorder -c '{"Args":["resolveDiscrepancy","4500001","GR-5001","10","RESHIP"]}' -C myc
+//peer chaincode invoke -n purchaseorder -c '{"Args":["markConsignment","4500002"]}' -C myc
+//peer chaincode invoke -n purchaseorder -c '{"Args":["recordConsumption","CR-301","4500002","SE-100234","40","2018-10-03"]}' -C myc
+//peer chaincode query -n purchaseorder -c '{"Args":["getConsumptions","4500002","2018-10-01","2018-10-31"]}' -C myc
+//peer chaincode query -n purchaseorder -c '{"Args":["getConsignmentStock","SchneiderMSP","FlextronicsMSP"]}' -C myc
+
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RinuT/chaincode/caller"
+	"github.com/RinuT/chaincode/currency"
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+type PurchaseOrderChaincode struct {
+}
+
+//a purchase order as shown on the purchase screens, the buyer is the MSP that created it
+//and the supplier the MSP that delivers against it
+type PurchaseOrder struct {
+	ObjectType     string   `json:"docType"`
+	PONumber       string   `json:"PONumber"`
+	Buyer          string   `json:"Buyer"`
+	Supplier       string   `json:"Supplier"`
+	CreationDate   string   `json:"CreationDate"`
+	Status         string   `json:"Status"`         //worked out from the line statuses
+	Acknowledgment string   `json:"Acknowledgment"` //PENDING, CONFIRMED, REJECTED or CHANGES_PROPOSED
+	Revision       int      `json:"Revision"`       //bumped every time the agreed terms change
+	Consignment    bool     `json:"Consignment"`    //received goods stay the supplier's until consumed
+	Lines          []POLine `json:"Lines"`
+}
+
+//a proposed change to quantity, price or delivery date of PO lines.
+//it takes effect once the other side accepts it, the proposer accepts by proposing
+type ChangeOrder struct {
+	ObjectType      string       `json:"docType"`
+	ChangeId        string       `json:"ChangeId"`
+	PONumber        string       `json:"PONumber"`
+	BaseRevision    int          `json:"BaseRevision"` //the revision the change was proposed against
+	ProposedBy      string       `json:"ProposedBy"`
+	ProposeDate     string       `json:"ProposeDate"`
+	Comment         string       `json:"Comment"`
+	Lines           []LineChange `json:"Lines"`
+	Status          string       `json:"Status"` //PROPOSED, ACCEPTED or REJECTED
+	DecidedBy       string       `json:"DecidedBy"`
+	DecisionDate    string       `json:"DecisionDate"`
+	DecisionComment string       `json:"DecisionComment"`
+}
+
+//new values for a line, empty fields stay as they are
+type LineChange struct {
+	LineNumber   string `json:"LineNumber"`
+	Quantity     string `json:"Quantity"`
+	Price        string `json:"Price"`
+	DeliveryDate string `json:"DeliveryDate"`
+}
+
+type POLine struct {
+	LineNumber        string `json:"LineNumber"`
+	MaterialCode      string `json:"MaterialCode"` //SE material code
+	Quantity          int64  `json:"Quantity"`
+	UOP               string `json:"UOP"`      //unit of purchase
+	Price             string `json:"Price"`    //decimal text, may be finer than the minor unit
+	Currency          string `json:"Currency"` //ISO 4217 code
+	DeliveryDate      string `json:"DeliveryDate"`
+	ShippedQuantity   int64  `json:"ShippedQuantity"` //announced on shipping notices
+	DeliveredQuantity int64  `json:"DeliveredQuantity"`
+	Status            string `json:"Status"` //OPEN, PARTIALLY_DELIVERED, DELIVERED or CLOSED
+}
+
+//advance shipping notice, one per delivery note
+type ASN struct {
+	ObjectType         string    `json:"docType"`
+	DeliveryNoteNumber string    `json:"DeliveryNoteNumber"`
+	PONumber           string    `json:"PONumber"`
+	Supplier           string    `json:"Supplier"`
+	Buyer              string    `json:"Buyer"`
+	ShipmentId         string    `json:"ShipmentId"` //shipment in the shipment chaincode
+	ShipmentDate       string    `json:"ShipmentDate"`
+	Status             string    `json:"Status"` //SHIPPED or RECEIVED
+	Lines              []ASNLine `json:"Lines"`
+}
+
+type ASNLine struct {
+	LineNumber   string `json:"LineNumber"`
+	MaterialCode string `json:"MaterialCode"`
+	Quantity     int64  `json:"Quantity"`
+	BatchId      string `json:"BatchId"`
+}
+
+//what the buyer received for a shipping notice
+type GoodsReceipt struct {
+	ObjectType         string        `json:"docType"`
+	ReceiptId          string        `json:"ReceiptId"`
+	PONumber           string        `json:"PONumber"`
+	DeliveryNoteNumber string        `json:"DeliveryNoteNumber"`
+	Supplier           string        `json:"Supplier"`
+	ReceivedDate       string        `json:"ReceivedDate"`
+	RecordedBy         string        `json:"RecordedBy"`
+	Lines              []ReceiptLine `json:"Lines"`
+	Discrepancies      []Discrepancy `json:"Discrepancies"`
+	HasDiscrepancy     bool          `json:"HasDiscrepancy"`
+}
+
+type ReceiptLine struct {
+	LineNumber       string `json:"LineNumber"`
+	BatchId          string `json:"BatchId"`
+	ReceivedQuantity int64  `json:"ReceivedQuantity"`
+}
+
+//a receipt that does not match the shipping notice
+type Discrepancy struct {
+	LineNumber       string `json:"LineNumber"`
+	BatchId          string `json:"BatchId,omitempty"`
+	Type             string `json:"Type"` //OVER, SHORT or WRONG_BATCH
+	ExpectedQuantity int64  `json:"ExpectedQuantity"`
+	ReceivedQuantity int64  `json:"ReceivedQuantity"`
+	Resolution       string `json:"Resolution,omitempty"` //RESHIP or ACCEPTED once the supplier resolved it
+	ResolvedBy       string `json:"ResolvedBy,omitempty"`
+	ResolvedDate     string `json:"ResolvedDate,omitempty"`
+}
+
+//how the supplier settles a discrepancy. RESHIP reopens a short quantity to ship again,
+//ACCEPTED takes the receipt as it is
+var discrepancyResolutions = map[string]bool{
+	"RESHIP":   true,
+	"ACCEPTED": true,
+}
+
+//the supplier's stock of a material held at the buyer's site
+type ConsignmentStock struct {
+	ObjectType       string `json:"docType"`
+	Buyer            string `json:"Buyer"`
+	Supplier         string `json:"Supplier"`
+	MaterialCode     string `json:"MaterialCode"`
+	Quantity         int64  `json:"Quantity"` //on hand, still owned by the supplier
+	ReceivedQuantity int64  `json:"ReceivedQuantity"`
+	ConsumedQuantity int64  `json:"ConsumedQuantity"`
+}
+
+//consignment stock the buyer took into use, billed by a self-billing invoice
+type ConsumptionRecord struct {
+	ObjectType      string `json:"docType"`
+	RecordId        string `json:"RecordId"`
+	PONumber        string `json:"PONumber"`
+	LineNumber      string `json:"LineNumber"`
+	MaterialCode    string `json:"MaterialCode"`
+	Buyer           string `json:"Buyer"`
+	Supplier        string `json:"Supplier"`
+	Quantity        int64  `json:"Quantity"`
+	ConsumptionDate string `json:"ConsumptionDate"`
+	RecordedBy      string `json:"RecordedBy"`
+}
+
+//why a PO line changed status, who changed it and when
+type StatusChange struct {
+	ObjectType string `json:"docType"`
+	PONumber   string `json:"PONumber"`
+	LineNumber string `json:"LineNumber"`
+	FromStatus string `json:"FromStatus"`
+	ToStatus   string `json:"ToStatus"`
+	ReasonCode string `json:"ReasonCode"`
+	Comment    string `json:"Comment"`
+	ChangedBy  string `json:"ChangedBy"`
+	ChangeDate string `json:"ChangeDate"`
+}
+
+const dateLayout = "2006-01-02"
+
+//the shipment chaincode (painting.go) as installed on the same channel
+const shipmentChaincode = "mycc"
+
+//the notification chaincode (notification.go) as installed on the same channel
+const notificationChaincode = "notification"
+
+//the statuses a line can move to from each status, CLOSED is final
+var lineStatusTransitions = map[string][]string{
+	"OPEN":                {"PARTIALLY_DELIVERED", "DELIVERED", "CLOSED"},
+	"PARTIALLY_DELIVERED": {"DELIVERED", "CLOSED"},
+	"DELIVERED":           {"CLOSED"},
+	"CLOSED":              {},
+}
+
+//the controlled vocabulary for PO line status changes
+var lineReasonCodes = map[string]bool{
+	"GOODS_RECEIVED":  true,
+	"SHORT_CLOSED":    true,
+	"CANCELLED":       true,
+	"INVOICED":        true,
+	"DATA_CORRECTION": true,
+	"OTHER":           true, //needs a comment
+}
+
+func main() {
+	err := shim.Start(new(PurchaseOrderChaincode))
+	if err != nil {
+		fmt.Printf("Error starting Purchase order chaincode: %s", err)
+	}
+}
+
+func (t *PurchaseOrderChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	fmt.Println("- init of purchase order chaincode")
+	return shim.Success(nil)
+}
+
+//invoke function
+
+func (t *PurchaseOrderChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	function, args := stub.GetFunctionAndParameters()
+	fmt.Println("invoke is running " + function)
+
+	// Handle different functions
+	if function == "createPurchaseOrder" {
+		return t.createPurchaseOrder(stub, args)
+	} else if function == "addPurchaseOrderLine" {
+		return t.addPurchaseOrderLine(stub, args)
+	} else if function == "getPurchaseOrder" {
+		return t.getPurchaseOrder(stub, args)
+	} else if function == "queryPurchaseOrders" {
+		return t.queryPurchaseOrders(stub, args)
+	} else if function == "updateLineStatus" {
+		return t.updateLineStatus(stub, args)
+	} else if function == "getStatusChanges" {
+		return t.getStatusChanges(stub, args)
+	} else if function == "acknowledgePurchaseOrder" {
+		return t.acknowledgePurchaseOrder(stub, args)
+	} else if function == "proposeChange" {
+		return t.proposeChange(stub, args)
+	} else if function == "acceptChange" {
+		return t.acceptChange(stub, args)
+	} else if function == "rejectChange" {
+		return t.rejectChange(stub, args)
+	} else if function == "getChangeOrders" {
+		return t.getChangeOrders(stub, args)
+	} else if function == "getRevisions" {
+		return t.getRevisions(stub, args)
+	} else if function == "createASN" {
+		return t.createASN(stub, args)
+	} else if function == "getASN" {
+		return t.getASN(stub, args)
+	} else if function == "getASNs" {
+		return t.getASNs(stub, args)
+	} else if function == "recordGoodsReceipt" {
+		return t.recordGoodsReceipt(stub, args)
+	} else if function == "getGoodsReceipts" {
+		return t.getGoodsReceipts(stub, args)
+	} else if function == "getDiscrepancies" {
+		return t.getDiscrepancies(stub, args)
+	} else if function == "resolveDiscrepancy" {
+		return t.resolveDiscrepancy(stub, args)
+	} else if function == "markConsignment" {
+		return t.markConsignment(stub, args)
+	} else if function == "recordConsumption" {
+		return t.recordConsumption(stub, args)
+	} else if function == "getConsumptions" {
+		return t.getConsumptions(stub, args)
+	} else if function == "getConsignmentStock" {
+		return t.getConsignmentStock(stub, args)
+	}
+
+	fmt.Println("invoke did not find func: " + function) //error
+	return shim.Error("Received unknown function invocation")
+}
+
+//Create a purchase order with unique PO number, issued by the caller's organisation.
+//args are PO number, supplier MSP and one or more lines of line number, material code,
+//quantity, UOP, price, currency and delivery date
+func (t *PurchaseOrderChaincode) createPurchaseOrder(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 9 || (len(args)-2)%7 != 0 {
+		return shim.Error("Incorrect number of arguments. Expecting PO number, supplier and lines of 7 fields")
+	}
+
+	PONumber := strings.TrimSpace(args[0])
+	Supplier := strings.TrimSpace(args[1])
+	fmt.Println("- start createPurchaseOrder ", PONumber, Supplier)
+
+	if PONumber == "" || Supplier == "" {
+		return shim.Error("PO number and supplier must not be empty")
+	}
+
+	// ==== Check if purchase order already exists ====
+	POAsBytes, err := stub.GetState(PONumber)
+	if err != nil {
+		return shim.Error("Failed to create purchase order: " + err.Error())
+	} else if POAsBytes != nil {
+		return shim.Error("This purchase order already exists: " + PONumber)
+	}
+
+	Buyer, err := cid.GetMSPID(stub)
+	if err != nil {
+		return shim.Error("Failed to get caller MSP: " + err.Error())
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	purchaseOrder := PurchaseOrder{ObjectType: "purchaseorder", PONumber: PONumber, Buyer: Buyer, Supplier: Supplier,
+		CreationDate: txTime.Format(dateLayout), Acknowledgment: "PENDING", Lines: []POLine{}}
+	for i := 2; i < len(args); i += 7 {
+		line, err := getPOLine(args[i : i+7])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if findLine(purchaseOrder, line.LineNumber) >= 0 {
+			return shim.Error("Line " + line.LineNumber + " is listed more than once")
+		}
+		purchaseOrder.Lines = append(purchaseOrder.Lines, line)
+	}
+
+	err = putRevision(stub, &purchaseOrder)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putPurchaseOrder(stub, purchaseOrder)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	notify(stub, "NEW_PO", PONumber, "new purchase order "+PONumber+" from "+Buyer, Supplier)
+
+	fmt.Println("- end createPurchaseOrder (success)")
+	return shim.Success(nil)
+}
+
+//add a line to a purchase order the supplier has not answered yet, buyer only.
+//once acknowledged, the terms only change through change orders.
+//args are PO number, line number, material code, quantity, UOP, price, currency and delivery date
+func (t *PurchaseOrderChaincode) addPurchaseOrderLine(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 8 {
+		return shim.Error("Incorrect number of arguments. Expecting PO number and 7 line fields")
+	}
+
+	PONumber := args[0]
+	fmt.Println("- start addPurchaseOrderLine ", PONumber, args[1])
+
+	purchaseOrder, err := getPurchaseOrder(stub, PONumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = caller.RequireMSP(stub, purchaseOrder.Buyer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if purchaseOrder.Acknowledgment != "PENDING" {
+		return shim.Error("purchase order " + PONumber + " was already answered by the supplier, propose a change instead")
+	}
+
+	line, err := getPOLine(args[1:])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if findLine(purchaseOrder, line.LineNumber) >= 0 {
+		return shim.Error("Line " + line.LineNumber + " already exists on purchase order " + PONumber)
+	}
+	purchaseOrder.Lines = append(purchaseOrder.Lines, line)
+
+	err = putRevision(stub, &purchaseOrder)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putPurchaseOrder(stub, purchaseOrder)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end addPurchaseOrderLine (success)")
+	return shim.Success(nil)
+}
+
+func (t *PurchaseOrderChaincode) getPurchaseOrder(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting PO number to query")
+	}
+
+	POAsBytes, err := stub.GetState(args[0])
+	if err != nil {
+		return shim.Error("{\"Error\":\"Failed to get state for " + args[0] + "\"}")
+	} else if POAsBytes == nil {
+		return shim.Error("{\"Error\":\"purchase order does not exist: " + args[0] + "\"}")
+	}
+
+	return shim.Success(POAsBytes)
+}
+
+//purchase orders of a supplier created between two dates (YYYY-MM-DD, both included),
+//either date may be left empty
+func (t *PurchaseOrderChaincode) queryPurchaseOrders(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting supplier, from date and to date")
+	}
+
+	Supplier := args[0]
+	FromDate := args[1]
+	ToDate := args[2]
+	for _, date := range []string{FromDate, ToDate} {
+		if date == "" {
+			continue
+		}
+		_, err := time.Parse(dateLayout, date)
+		if err != nil {
+			return shim.Error("Dates must be YYYY-MM-DD: " + err.Error())
+		}
+	}
+
+	selector := map[string]interface{}{"docType": "purchaseorder", "Supplier": Supplier}
+	creationDate := map[string]string{}
+	if FromDate != "" {
+		creationDate["$gte"] = FromDate
+	}
+	if ToDate != "" {
+		creationDate["$lte"] = ToDate
+	}
+	if len(creationDate) > 0 {
+		selector["CreationDate"] = creationDate
+	}
+	queryString, err := json.Marshal(map[string]interface{}{"selector": selector})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	purchaseOrders, err := getPurchaseOrdersForQueryString(stub, string(queryString))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	purchaseOrdersAsBytes, err := json.Marshal(purchaseOrders)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(purchaseOrdersAsBytes)
+}
+
+//close a PO line by hand with a reason code and an optional comment. Delivery statuses
+//follow from goods receipts, so CLOSED is the only status a party can set.
+//args are PO number, line number, CLOSED, reason code and comment
+func (t *PurchaseOrderChaincode) updateLineStatus(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 4 && len(args) != 5 {
+		return shim.Error("Incorrect number of arguments. Expecting PO number, line number, status, reason code and optional comment")
+	}
+
+	PONumber := args[0]
+	LineNumber := args[1]
+	newStatus := strings.ToUpper(args[2])
+	ReasonCode := strings.ToUpper(args[3])
+	Comment := ""
+	if len(args) > 4 {
+		Comment = strings.TrimSpace(args[4])
+	}
+	fmt.Println("- start updateLineStatus ", PONumber, LineNumber, newStatus, ReasonCode)
+
+	if newStatus != "CLOSED" {
+		return shim.Error("Only CLOSED can be set on a line, delivery statuses follow from goods receipts")
+	}
+	if !lineReasonCodes[ReasonCode] {
+		return shim.Error("Unknown reason code: " + args[3])
+	}
+	if ReasonCode == "OTHER" && Comment == "" {
+		return shim.Error("Reason code OTHER needs a comment")
+	}
+
+	purchaseOrder, err := getPurchaseOrder(stub, PONumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = caller.RequireMSP(stub, purchaseOrder.Buyer, purchaseOrder.Supplier)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	i := findLine(purchaseOrder, LineNumber)
+	if i < 0 {
+		return shim.Error("Line " + LineNumber + " does not exist on purchase order " + PONumber)
+	}
+
+	err = setLineStatus(stub, &purchaseOrder, i, newStatus, ReasonCode, Comment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putPurchaseOrder(stub, purchaseOrder)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end updateLineStatus (success)")
+	return shim.Success(nil)
+}
+
+//every recorded status change of the lines of a purchase order
+func (t *PurchaseOrderChaincode) getStatusChanges(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting PO number to query")
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("statuschange", []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	changes := []StatusChange{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		change := StatusChange{}
+		err = json.Unmarshal(queryResponse.Value, &change)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		changes = append(changes, change)
+	}
+
+	changesAsBytes, err := json.Marshal(changes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(changesAsBytes)
+}
+
+// ==== Acknowledgment and change orders ====
+
+//the supplier confirms or rejects a purchase order as issued.
+//args are PO number, CONFIRM or REJECT and a comment, required for REJECT
+func (t *PurchaseOrderChaincode) acknowledgePurchaseOrder(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting PO number, CONFIRM or REJECT and comment")
+	}
+
+	PONumber := args[0]
+	Answer := strings.ToUpper(args[1])
+	Comment := strings.TrimSpace(args[2])
+	fmt.Println("- start acknowledgePurchaseOrder ", PONumber, Answer)
+
+	purchaseOrder, err := getPurchaseOrder(stub, PONumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = caller.RequireMSP(stub, purchaseOrder.Supplier)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if purchaseOrder.Acknowledgment != "PENDING" && purchaseOrder.Acknowledgment != "CHANGES_PROPOSED" {
+		return shim.Error("purchase order " + PONumber + " is already " + purchaseOrder.Acknowledgment)
+	}
+
+	switch Answer {
+	case "CONFIRM":
+		purchaseOrder.Acknowledgment = "CONFIRMED"
+	case "REJECT":
+		if Comment == "" {
+			return shim.Error("A comment is required to reject a purchase order")
+		}
+		purchaseOrder.Acknowledgment = "REJECTED"
+	default:
+		return shim.Error("Answer must be CONFIRM or REJECT")
+	}
+
+	err = putPurchaseOrder(stub, purchaseOrder)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end acknowledgePurchaseOrder (success)")
+	return shim.Success(nil)
+}
+
+//buyer or supplier proposes new quantity, price or delivery date for some lines.
+//args are PO number, comment and groups of line number, quantity, price and delivery date,
+//leave a field empty to keep it. Returns the change id
+func (t *PurchaseOrderChaincode) proposeChange(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 6 || (len(args)-2)%4 != 0 {
+		return shim.Error("Incorrect number of arguments. Expecting PO number, comment and groups of line number, quantity, price and delivery date")
+	}
+
+	PONumber := args[0]
+	Comment := strings.TrimSpace(args[1])
+	fmt.Println("- start proposeChange ", PONumber)
+
+	purchaseOrder, err := getPurchaseOrder(stub, PONumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = caller.RequireMSP(stub, purchaseOrder.Buyer, purchaseOrder.Supplier)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	changes := []LineChange{}
+	listed := map[string]bool{}
+	for i := 2; i < len(args); i += 4 {
+		change := LineChange{LineNumber: args[i], Quantity: strings.TrimSpace(args[i+1]), Price: strings.TrimSpace(args[i+2]),
+			DeliveryDate: strings.TrimSpace(args[i+3])}
+		if listed[change.LineNumber] {
+			return shim.Error("Line " + change.LineNumber + " is listed more than once")
+		}
+		listed[change.LineNumber] = true
+		if change.Quantity == "" && change.Price == "" && change.DeliveryDate == "" {
+			return shim.Error("Line " + change.LineNumber + " has nothing to change")
+		}
+		// check the change applies now, it is checked again when accepted
+		_, err = applyLineChange(purchaseOrder, change)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		changes = append(changes, change)
+	}
+
+	ProposedBy, err := cid.GetMSPID(stub)
+	if err != nil {
+		return shim.Error("Failed to get caller MSP: " + err.Error())
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	changeOrder := ChangeOrder{ObjectType: "changeorder", ChangeId: stub.GetTxID(), PONumber: PONumber, BaseRevision: purchaseOrder.Revision,
+		ProposedBy: ProposedBy, ProposeDate: txTime.Format(time.RFC3339), Comment: Comment, Lines: changes, Status: "PROPOSED"}
+	err = putChangeOrder(stub, changeOrder)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if ProposedBy == purchaseOrder.Supplier && purchaseOrder.Acknowledgment == "PENDING" {
+		purchaseOrder.Acknowledgment = "CHANGES_PROPOSED"
+		err = putPurchaseOrder(stub, purchaseOrder)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	counterparty := purchaseOrder.Supplier
+	if ProposedBy == purchaseOrder.Supplier {
+		counterparty = purchaseOrder.Buyer
+	}
+	notify(stub, "CHANGE_PROPOSED", PONumber, ProposedBy+" proposed change "+changeOrder.ChangeId+" to purchase order "+PONumber, counterparty)
+
+	fmt.Println("- end proposeChange (success)")
+	return shim.Success([]byte(changeOrder.ChangeId))
+}
+
+//the other side accepts a change, which then becomes a new revision of the purchase order
+func (t *PurchaseOrderChaincode) acceptChange(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting PO number and change id")
+	}
+
+	PONumber := args[0]
+	ChangeId := args[1]
+	fmt.Println("- start acceptChange ", PONumber, ChangeId)
+
+	purchaseOrder, changeOrder, err := getOpenChange(stub, PONumber, ChangeId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if changeOrder.BaseRevision != purchaseOrder.Revision {
+		return shim.Error("change " + ChangeId + " was proposed against revision " + strconv.Itoa(changeOrder.BaseRevision) +
+			" but the purchase order is at revision " + strconv.Itoa(purchaseOrder.Revision) + ", propose it again")
+	}
+
+	for _, change := range changeOrder.Lines {
+		purchaseOrder, err = applyLineChange(purchaseOrder, change)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	// both sides agreed on the changed terms
+	purchaseOrder.Acknowledgment = "CONFIRMED"
+	err = putRevision(stub, &purchaseOrder)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putPurchaseOrder(stub, purchaseOrder)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = decideChange(stub, changeOrder, "ACCEPTED", "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end acceptChange (success)")
+	return shim.Success(nil)
+}
+
+//the other side turns a change down, the purchase order stays as it is
+func (t *PurchaseOrderChaincode) rejectChange(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting PO number, change id and comment")
+	}
+
+	PONumber := args[0]
+	ChangeId := args[1]
+	Comment := strings.TrimSpace(args[2])
+	fmt.Println("- start rejectChange ", PONumber, ChangeId)
+
+	if Comment == "" {
+		return shim.Error("A comment is required to reject a change")
+	}
+	_, changeOrder, err := getOpenChange(stub, PONumber, ChangeId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = decideChange(stub, changeOrder, "REJECTED", Comment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end rejectChange (success)")
+	return shim.Success(nil)
+}
+
+//every change order proposed on a purchase order
+func (t *PurchaseOrderChaincode) getChangeOrders(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting PO number to query")
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("changeorder", []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	changeOrders := []ChangeOrder{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		changeOrder := ChangeOrder{}
+		err = json.Unmarshal(queryResponse.Value, &changeOrder)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		changeOrders = append(changeOrders, changeOrder)
+	}
+
+	changeOrdersAsBytes, err := json.Marshal(changeOrders)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(changeOrdersAsBytes)
+}
+
+//the purchase order as it stood at every revision, oldest first
+func (t *PurchaseOrderChaincode) getRevisions(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting PO number to query")
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("porevision", []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	revisions := []PurchaseOrder{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		revision := PurchaseOrder{}
+		err = json.Unmarshal(queryResponse.Value, &revision)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		revisions = append(revisions, revision)
+	}
+
+	revisionsAsBytes, err := json.Marshal(revisions)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(revisionsAsBytes)
+}
+
+//the purchase order with one line change applied
+func applyLineChange(purchaseOrder PurchaseOrder, change LineChange) (PurchaseOrder, error) {
+	i := findLine(purchaseOrder, change.LineNumber)
+	if i < 0 {
+		return purchaseOrder, fmt.Errorf("Line %s does not exist on purchase order %s", change.LineNumber, purchaseOrder.PONumber)
+	}
+	// copy the lines so the caller's purchase order is left alone
+	purchaseOrder.Lines = append([]POLine{}, purchaseOrder.Lines...)
+	line := &purchaseOrder.Lines[i]
+	if line.Status == "CLOSED" {
+		return purchaseOrder, fmt.Errorf("line %s is closed and cannot be changed", line.LineNumber)
+	}
+	if change.Quantity != "" {
+		Quantity, err := strconv.ParseInt(change.Quantity, 10, 64)
+		if err != nil || Quantity <= 0 {
+			return purchaseOrder, fmt.Errorf("quantity of line %s must be a positive whole number", line.LineNumber)
+		}
+		if Quantity < line.ShippedQuantity {
+			return purchaseOrder, fmt.Errorf("quantity of line %s cannot go below the %d already shipped", line.LineNumber, line.ShippedQuantity)
+		}
+		line.Quantity = Quantity
+	}
+	if change.Price != "" {
+		Price, err := currency.ParsePrice(change.Price, line.Currency)
+		if err != nil {
+			return purchaseOrder, fmt.Errorf("price of line %s: %s", line.LineNumber, err.Error())
+		}
+		line.Price = Price
+	}
+	if change.DeliveryDate != "" {
+		_, err := time.Parse(dateLayout, change.DeliveryDate)
+		if err != nil {
+			return purchaseOrder, fmt.Errorf("delivery date of line %s must be YYYY-MM-DD", line.LineNumber)
+		}
+		line.DeliveryDate = change.DeliveryDate
+	}
+	return purchaseOrder, nil
+}
+
+//a change still waiting for an answer, and its purchase order. Only the side that
+//did not propose it may answer
+func getOpenChange(stub shim.ChaincodeStubInterface, PONumber string, ChangeId string) (PurchaseOrder, ChangeOrder, error) {
+	changeOrder := ChangeOrder{}
+	purchaseOrder, err := getPurchaseOrder(stub, PONumber)
+	if err != nil {
+		return purchaseOrder, changeOrder, err
+	}
+	changeKey, err := stub.CreateCompositeKey("changeorder", []string{PONumber, ChangeId})
+	if err != nil {
+		return purchaseOrder, changeOrder, err
+	}
+	changeAsBytes, err := stub.GetState(changeKey)
+	if err != nil {
+		return purchaseOrder, changeOrder, fmt.Errorf("Failed to get change order: %s", err.Error())
+	} else if changeAsBytes == nil {
+		return purchaseOrder, changeOrder, fmt.Errorf("change order does not exist: %s", ChangeId)
+	}
+	err = json.Unmarshal(changeAsBytes, &changeOrder)
+	if err != nil {
+		return purchaseOrder, changeOrder, err
+	}
+	if changeOrder.Status != "PROPOSED" {
+		return purchaseOrder, changeOrder, fmt.Errorf("change %s was already %s", ChangeId, strings.ToLower(changeOrder.Status))
+	}
+
+	counterparty := purchaseOrder.Supplier
+	if changeOrder.ProposedBy == purchaseOrder.Supplier {
+		counterparty = purchaseOrder.Buyer
+	}
+	err = caller.RequireMSP(stub, counterparty)
+	return purchaseOrder, changeOrder, err
+}
+
+func decideChange(stub shim.ChaincodeStubInterface, changeOrder ChangeOrder, Status string, Comment string) error {
+	DecidedBy, err := caller.Id(stub)
+	if err != nil {
+		return err
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return err
+	}
+	changeOrder.Status = Status
+	changeOrder.DecidedBy = DecidedBy
+	changeOrder.DecisionDate = txTime.Format(time.RFC3339)
+	changeOrder.DecisionComment = Comment
+	return putChangeOrder(stub, changeOrder)
+}
+
+func putChangeOrder(stub shim.ChaincodeStubInterface, changeOrder ChangeOrder) error {
+	changeKey, err := stub.CreateCompositeKey("changeorder", []string{changeOrder.PONumber, changeOrder.ChangeId})
+	if err != nil {
+		return err
+	}
+	changeJSONasBytes, err := json.Marshal(changeOrder)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(changeKey, changeJSONasBytes)
+}
+
+//bump the revision and keep a copy of the purchase order as it now stands.
+//revisions are zero padded in the key so they come back in order
+func putRevision(stub shim.ChaincodeStubInterface, purchaseOrder *PurchaseOrder) error {
+	purchaseOrder.Revision++
+	purchaseOrder.Status = getOrderStatus(*purchaseOrder)
+	revisionKey, err := stub.CreateCompositeKey("porevision", []string{purchaseOrder.PONumber, fmt.Sprintf("%06d", purchaseOrder.Revision)})
+	if err != nil {
+		return err
+	}
+	revisionJSONasBytes, err := json.Marshal(purchaseOrder)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(revisionKey, revisionJSONasBytes)
+}
+
+// ==== Advance shipping notices ====
+
+//the supplier announces a delivery against lines of a confirmed purchase order and
+//links it to a shipment in the shipment chaincode, registering the shipment if it is new.
+//args are delivery note number, PO number, shipment id, shipment date, origin city,
+//destination city and groups of line number, quantity and batch id
+func (t *PurchaseOrderChaincode) createASN(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 9 || (len(args)-6)%3 != 0 {
+		return shim.Error("Incorrect number of arguments. Expecting delivery note number, PO number, shipment id, shipment date, origin, destination and groups of line number, quantity and batch id")
+	}
+
+	DeliveryNoteNumber := strings.TrimSpace(args[0])
+	PONumber := args[1]
+	ShipmentId := strings.TrimSpace(args[2])
+	ShipmentDate := args[3]
+	OriginCity := args[4]
+	DestinationCity := args[5]
+	fmt.Println("- start createASN ", DeliveryNoteNumber, PONumber, ShipmentId)
+
+	if DeliveryNoteNumber == "" || ShipmentId == "" {
+		return shim.Error("Delivery note number and shipment id must not be empty")
+	}
+	_, err := time.Parse(dateLayout, ShipmentDate)
+	if err != nil {
+		return shim.Error("Shipment date must be YYYY-MM-DD")
+	}
+
+	purchaseOrder, err := getPurchaseOrder(stub, PONumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = caller.RequireMSP(stub, purchaseOrder.Supplier)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if purchaseOrder.Acknowledgment != "CONFIRMED" {
+		return shim.Error("purchase order " + PONumber + " is " + purchaseOrder.Acknowledgment + ", only confirmed orders can be shipped")
+	}
+
+	_, found, err := findASN(stub, PONumber, DeliveryNoteNumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if found {
+		return shim.Error("This delivery note already exists: " + DeliveryNoteNumber)
+	}
+
+	asn := ASN{ObjectType: "asn", DeliveryNoteNumber: DeliveryNoteNumber, PONumber: PONumber, Supplier: purchaseOrder.Supplier,
+		Buyer: purchaseOrder.Buyer, ShipmentId: ShipmentId, ShipmentDate: ShipmentDate, Status: "SHIPPED", Lines: []ASNLine{}}
+	for i := 6; i < len(args); i += 3 {
+		LineNumber := args[i]
+		BatchId := strings.TrimSpace(args[i+2])
+		Quantity, err := strconv.ParseInt(args[i+1], 10, 64)
+		if err != nil || Quantity <= 0 {
+			return shim.Error("quantity of line " + LineNumber + " must be a positive whole number")
+		}
+		if BatchId == "" {
+			return shim.Error("batch id of line " + LineNumber + " must not be empty")
+		}
+		j := findLine(purchaseOrder, LineNumber)
+		if j < 0 {
+			return shim.Error("Line " + LineNumber + " does not exist on purchase order " + PONumber)
+		}
+		line := &purchaseOrder.Lines[j]
+		if line.Status == "CLOSED" {
+			return shim.Error("line " + LineNumber + " is closed")
+		}
+		// a line may go out in several batches, together they cannot exceed what is still open
+		if Quantity > line.Quantity-line.ShippedQuantity {
+			return shim.Error(fmt.Sprintf("line %s has %d open, cannot ship %d", LineNumber, line.Quantity-line.ShippedQuantity, Quantity))
+		}
+		line.ShippedQuantity += Quantity
+		asn.Lines = append(asn.Lines, ASNLine{LineNumber: LineNumber, MaterialCode: line.MaterialCode, Quantity: Quantity, BatchId: BatchId})
+	}
+
+	response := stub.InvokeChaincode(shipmentChaincode, util.ToChaincodeArgs("getShipmentDetails", ShipmentId), "")
+	if response.Status != shim.OK {
+		if OriginCity == "" || DestinationCity == "" {
+			return shim.Error("shipment " + ShipmentId + " does not exist yet, origin and destination are needed to register it")
+		}
+		response = stub.InvokeChaincode(shipmentChaincode, util.ToChaincodeArgs("registerShipment", ShipmentId, purchaseOrder.Buyer,
+			purchaseOrder.Supplier, OriginCity, DestinationCity, OriginCity, "good_condition", "", "", ""), "")
+		if response.Status != shim.OK {
+			return shim.Error("Failed to register shipment " + ShipmentId + ": " + response.Message)
+		}
+	}
+
+	err = putASN(stub, asn)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putPurchaseOrder(stub, purchaseOrder)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	notify(stub, "ASN_RECEIVED", PONumber, "delivery note "+DeliveryNoteNumber+" on purchase order "+PONumber+" shipped as shipment "+ShipmentId, purchaseOrder.Buyer)
+
+	fmt.Println("- end createASN (success)")
+	return shim.Success(nil)
+}
+
+func (t *PurchaseOrderChaincode) getASN(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting PO number and delivery note number")
+	}
+
+	asn, found, err := findASN(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if !found {
+		return shim.Error("delivery note does not exist: " + args[1])
+	}
+	asnAsBytes, err := json.Marshal(asn)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(asnAsBytes)
+}
+
+//every shipping notice sent against a purchase order
+func (t *PurchaseOrderChaincode) getASNs(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting PO number to query")
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("asn", []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	asns := []ASN{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		asn := ASN{}
+		err = json.Unmarshal(queryResponse.Value, &asn)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		asns = append(asns, asn)
+	}
+
+	asnsAsBytes, err := json.Marshal(asns)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(asnsAsBytes)
+}
+
+//like getASN, but a missing notice is not an error
+func findASN(stub shim.ChaincodeStubInterface, PONumber string, DeliveryNoteNumber string) (ASN, bool, error) {
+	asn := ASN{}
+	asnKey, err := stub.CreateCompositeKey("asn", []string{PONumber, DeliveryNoteNumber})
+	if err != nil {
+		return asn, false, err
+	}
+	asnAsBytes, err := stub.GetState(asnKey)
+	if err != nil {
+		return asn, false, fmt.Errorf("Failed to get delivery note: %s", err.Error())
+	} else if asnAsBytes == nil {
+		return asn, false, nil
+	}
+	err = json.Unmarshal(asnAsBytes, &asn)
+	return asn, err == nil, err
+}
+
+func putASN(stub shim.ChaincodeStubInterface, asn ASN) error {
+	asnKey, err := stub.CreateCompositeKey("asn", []string{asn.PONumber, asn.DeliveryNoteNumber})
+	if err != nil {
+		return err
+	}
+	asnJSONasBytes, err := json.Marshal(asn)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(asnKey, asnJSONasBytes)
+}
+
+// ==== Goods receipts ====
+
+//the buyer records what arrived for a shipping notice. Received quantities count as
+//delivered on the PO lines, and over, short and wrong batch receipts are kept as
+//discrepancies the supplier can see. A short quantity stays counted as shipped until
+//the supplier resolves the discrepancy with resolveDiscrepancy.
+//args are receipt id, PO number, delivery note number, received date and groups
+//of line number, batch id and received quantity
+func (t *PurchaseOrderChaincode) recordGoodsReceipt(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 7 || (len(args)-4)%3 != 0 {
+		return shim.Error("Incorrect number of arguments. Expecting receipt id, PO number, delivery note number, received date and groups of line number, batch id and quantity")
+	}
+
+	ReceiptId := strings.TrimSpace(args[0])
+	PONumber := args[1]
+	DeliveryNoteNumber := args[2]
+	ReceivedDate := args[3]
+	fmt.Println("- start recordGoodsReceipt ", ReceiptId, PONumber, DeliveryNoteNumber)
+
+	if ReceiptId == "" {
+		return shim.Error("Receipt id must not be empty")
+	}
+	_, err := time.Parse(dateLayout, ReceivedDate)
+	if err != nil {
+		return shim.Error("Received date must be YYYY-MM-DD")
+	}
+
+	purchaseOrder, err := getPurchaseOrder(stub, PONumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = caller.RequireMSP(stub, purchaseOrder.Buyer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	asn, found, err := findASN(stub, PONumber, DeliveryNoteNumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if !found {
+		return shim.Error("delivery note does not exist: " + DeliveryNoteNumber)
+	}
+	if asn.Status != "SHIPPED" {
+		return shim.Error("delivery note " + DeliveryNoteNumber + " was already received")
+	}
+	receiptKey, err := stub.CreateCompositeKey("goodsreceipt", []string{PONumber, ReceiptId})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	receiptAsBytes, err := stub.GetState(receiptKey)
+	if err != nil {
+		return shim.Error("Failed to get goods receipt: " + err.Error())
+	} else if receiptAsBytes != nil {
+		return shim.Error("This goods receipt already exists: " + ReceiptId)
+	}
+
+	RecordedBy, err := caller.Id(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	receipt := GoodsReceipt{ObjectType: "goodsreceipt", ReceiptId: ReceiptId, PONumber: PONumber, DeliveryNoteNumber: DeliveryNoteNumber,
+		Supplier: purchaseOrder.Supplier, ReceivedDate: ReceivedDate, RecordedBy: RecordedBy, Lines: []ReceiptLine{}, Discrepancies: []Discrepancy{}}
+
+	// what the notice announced per line and batch
+	expected := map[string]map[string]int64{}
+	for _, asnLine := range asn.Lines {
+		if expected[asnLine.LineNumber] == nil {
+			expected[asnLine.LineNumber] = map[string]int64{}
+		}
+		expected[asnLine.LineNumber][asnLine.BatchId] += asnLine.Quantity
+	}
+	for i := 4; i < len(args); i += 3 {
+		LineNumber := args[i]
+		BatchId := strings.TrimSpace(args[i+1])
+		Quantity, err := strconv.ParseInt(args[i+2], 10, 64)
+		if err != nil || Quantity < 0 {
+			return shim.Error("received quantity of line " + LineNumber + " must be a whole number")
+		}
+		if expected[LineNumber] == nil {
+			return shim.Error("Line " + LineNumber + " is not on delivery note " + DeliveryNoteNumber)
+		}
+		receipt.Lines = append(receipt.Lines, ReceiptLine{LineNumber: LineNumber, BatchId: BatchId, ReceivedQuantity: Quantity})
+	}
+
+	// consignment stock per material, written once after the loop
+	consigned := map[string]int64{}
+	materials := []string{}
+	// compare per line in notice order so the discrepancies come out the same on every peer
+	for _, asnLine := range asn.Lines {
+		LineNumber := asnLine.LineNumber
+		if expected[LineNumber] == nil {
+			continue
+		}
+		var expectedTotal, receivedTotal int64
+		for _, receiptLine := range receipt.Lines {
+			if receiptLine.LineNumber != LineNumber {
+				continue
+			}
+			receivedTotal += receiptLine.ReceivedQuantity
+			if _, announced := expected[LineNumber][receiptLine.BatchId]; !announced {
+				receipt.Discrepancies = append(receipt.Discrepancies, Discrepancy{LineNumber: LineNumber, BatchId: receiptLine.BatchId,
+					Type: "WRONG_BATCH", ReceivedQuantity: receiptLine.ReceivedQuantity})
+			}
+		}
+		for _, batchLine := range asn.Lines {
+			if batchLine.LineNumber == LineNumber {
+				expectedTotal += batchLine.Quantity
+			}
+		}
+		if receivedTotal > expectedTotal {
+			receipt.Discrepancies = append(receipt.Discrepancies, Discrepancy{LineNumber: LineNumber, Type: "OVER",
+				ExpectedQuantity: expectedTotal, ReceivedQuantity: receivedTotal})
+		} else if receivedTotal < expectedTotal {
+			receipt.Discrepancies = append(receipt.Discrepancies, Discrepancy{LineNumber: LineNumber, Type: "SHORT",
+				ExpectedQuantity: expectedTotal, ReceivedQuantity: receivedTotal})
+		}
+		delete(expected, LineNumber)
+
+		j := findLine(purchaseOrder, LineNumber)
+		if j < 0 {
+			return shim.Error("Line " + LineNumber + " does not exist on purchase order " + PONumber)
+		}
+		line := &purchaseOrder.Lines[j]
+		line.DeliveredQuantity += receivedTotal
+		if purchaseOrder.Consignment && receivedTotal > 0 {
+			if _, seen := consigned[line.MaterialCode]; !seen {
+				materials = append(materials, line.MaterialCode)
+			}
+			consigned[line.MaterialCode] += receivedTotal
+		}
+		// what arrived on top counts as shipped, what did not arrive is reopened once the
+		// supplier resolves the shortage
+		if receivedTotal > expectedTotal {
+			line.ShippedQuantity += receivedTotal - expectedTotal
+		}
+		if line.Status == "CLOSED" {
+			continue
+		}
+		newStatus := "PARTIALLY_DELIVERED"
+		if line.DeliveredQuantity >= line.Quantity {
+			newStatus = "DELIVERED"
+		} else if line.DeliveredQuantity == 0 {
+			newStatus = line.Status
+		}
+		err = setLineStatus(stub, &purchaseOrder, j, newStatus, "GOODS_RECEIVED", "receipt "+ReceiptId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	receipt.HasDiscrepancy = len(receipt.Discrepancies) > 0
+
+	for _, MaterialCode := range materials {
+		stock, err := getConsignmentStock(stub, purchaseOrder.Buyer, purchaseOrder.Supplier, MaterialCode)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		stock.Quantity += consigned[MaterialCode]
+		stock.ReceivedQuantity += consigned[MaterialCode]
+		err = putConsignmentStock(stub, stock)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	receiptJSONasBytes, err := json.Marshal(receipt)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(receiptKey, receiptJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	asn.Status = "RECEIVED"
+	err = putASN(stub, asn)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putPurchaseOrder(stub, purchaseOrder)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	Message := "receipt " + ReceiptId + " recorded for delivery note " + DeliveryNoteNumber
+	if receipt.HasDiscrepancy {
+		Message += fmt.Sprintf(" with %d discrepancies", len(receipt.Discrepancies))
+	}
+	notify(stub, "GOODS_RECEIVED", PONumber, Message, purchaseOrder.Supplier)
+
+	fmt.Println("- end recordGoodsReceipt (success)")
+	return shim.Success(receiptJSONasBytes)
+}
+
+//every goods receipt recorded against a purchase order
+func (t *PurchaseOrderChaincode) getGoodsReceipts(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting PO number to query")
+	}
+
+	receipts, err := getGoodsReceipts(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	receiptsAsBytes, err := json.Marshal(receipts)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(receiptsAsBytes)
+}
+
+//goods receipts of a supplier that did not match their shipping notice
+func (t *PurchaseOrderChaincode) getDiscrepancies(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting supplier")
+	}
+
+	selector := map[string]interface{}{"docType": "goodsreceipt", "Supplier": args[0], "HasDiscrepancy": true}
+	queryAsBytes, err := json.Marshal(map[string]interface{}{"selector": selector})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	resultsIterator, err := stub.GetQueryResult(string(queryAsBytes))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	receipts := []GoodsReceipt{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		receipt := GoodsReceipt{}
+		err = json.Unmarshal(queryResponse.Value, &receipt)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		receipts = append(receipts, receipt)
+	}
+
+	receiptsAsBytes, err := json.Marshal(receipts)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(receiptsAsBytes)
+}
+
+//the supplier settles the open discrepancies of a receipt line. RESHIP reopens the quantity
+//that did not arrive so it can go on a new shipping notice.
+//args are PO number, receipt id, line number and RESHIP or ACCEPTED
+func (t *PurchaseOrderChaincode) resolveDiscrepancy(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting PO number, receipt id, line number and resolution")
+	}
+
+	PONumber := args[0]
+	ReceiptId := args[1]
+	LineNumber := args[2]
+	Resolution := strings.ToUpper(args[3])
+	fmt.Println("- start resolveDiscrepancy ", PONumber, ReceiptId, LineNumber, Resolution)
+
+	if !discrepancyResolutions[Resolution] {
+		return shim.Error("Resolution must be RESHIP or ACCEPTED")
+	}
+	purchaseOrder, err := getPurchaseOrder(stub, PONumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = caller.RequireMSP(stub, purchaseOrder.Supplier)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	receiptKey, err := stub.CreateCompositeKey("goodsreceipt", []string{PONumber, ReceiptId})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	receiptAsBytes, err := stub.GetState(receiptKey)
+	if err != nil {
+		return shim.Error("Failed to get goods receipt: " + err.Error())
+	} else if receiptAsBytes == nil {
+		return shim.Error("goods receipt does not exist: " + ReceiptId)
+	}
+	receipt := GoodsReceipt{}
+	err = json.Unmarshal(receiptAsBytes, &receipt)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	ResolvedBy, err := caller.Id(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	resolved := 0
+	var shortQuantity int64
+	for k := range receipt.Discrepancies {
+		discrepancy := &receipt.Discrepancies[k]
+		if discrepancy.LineNumber != LineNumber || discrepancy.Resolution != "" {
+			continue
+		}
+		if discrepancy.Type == "SHORT" {
+			shortQuantity += discrepancy.ExpectedQuantity - discrepancy.ReceivedQuantity
+		}
+		discrepancy.Resolution = Resolution
+		discrepancy.ResolvedBy = ResolvedBy
+		discrepancy.ResolvedDate = txTime.Format(time.RFC3339)
+		resolved++
+	}
+	if resolved == 0 {
+		return shim.Error("line " + LineNumber + " of receipt " + ReceiptId + " has no open discrepancy")
+	}
+	if Resolution == "RESHIP" {
+		if shortQuantity == 0 {
+			return shim.Error("line " + LineNumber + " of receipt " + ReceiptId + " was not short, there is nothing to ship again")
+		}
+		j := findLine(purchaseOrder, LineNumber)
+		if j < 0 {
+			return shim.Error("Line " + LineNumber + " does not exist on purchase order " + PONumber)
+		}
+		purchaseOrder.Lines[j].ShippedQuantity -= shortQuantity
+		err = putPurchaseOrder(stub, purchaseOrder)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	receiptJSONasBytes, err := json.Marshal(receipt)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(receiptKey, receiptJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	notify(stub, "DISCREPANCY_RESOLVED", PONumber, "line "+LineNumber+" of receipt "+ReceiptId+" resolved as "+Resolution, purchaseOrder.Buyer)
+
+	fmt.Println("- end resolveDiscrepancy (success)")
+	return shim.Success(receiptJSONasBytes)
+}
+
+func getGoodsReceipts(stub shim.ChaincodeStubInterface, PONumber string) ([]GoodsReceipt, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("goodsreceipt", []string{PONumber})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	receipts := []GoodsReceipt{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		receipt := GoodsReceipt{}
+		err = json.Unmarshal(queryResponse.Value, &receipt)
+		if err != nil {
+			return nil, err
+		}
+		receipts = append(receipts, receipt)
+	}
+	return receipts, nil
+}
+
+// ==== Consignment stock ====
+
+//make a purchase order a consignment order before the supplier answers it, buyer only.
+//received goods then stay the supplier's stock at the buyer's site until consumed,
+//and are billed by self-billing invoices generated from the consumption
+func (t *PurchaseOrderChaincode) markConsignment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting PO number")
+	}
+
+	PONumber := args[0]
+	fmt.Println("- start markConsignment ", PONumber)
+
+	purchaseOrder, err := getPurchaseOrder(stub, PONumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = caller.RequireMSP(stub, purchaseOrder.Buyer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if purchaseOrder.Acknowledgment != "PENDING" {
+		return shim.Error("purchase order " + PONumber + " was already answered by the supplier")
+	}
+
+	purchaseOrder.Consignment = true
+	err = putPurchaseOrder(stub, purchaseOrder)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end markConsignment (success)")
+	return shim.Success(nil)
+}
+
+//the buyer takes consignment stock into use.
+//args are record id, PO number, material code, quantity consumed and consumption date
+func (t *PurchaseOrderChaincode) recordConsumption(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 5 {
+		return shim.Error("Incorrect number of arguments. Expecting record id, PO number, material code, quantity and consumption date")
+	}
+
+	RecordId := strings.TrimSpace(args[0])
+	PONumber := args[1]
+	MaterialCode := strings.TrimSpace(args[2])
+	ConsumptionDate := args[4]
+	fmt.Println("- start recordConsumption ", RecordId, PONumber, MaterialCode)
+
+	if RecordId == "" {
+		return shim.Error("Record id must not be empty")
+	}
+	Quantity, err := strconv.ParseInt(args[3], 10, 64)
+	if err != nil || Quantity <= 0 {
+		return shim.Error("Quantity consumed must be a positive whole number")
+	}
+	_, err = time.Parse(dateLayout, ConsumptionDate)
+	if err != nil {
+		return shim.Error("Consumption date must be YYYY-MM-DD")
+	}
+
+	purchaseOrder, err := getPurchaseOrder(stub, PONumber)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = caller.RequireMSP(stub, purchaseOrder.Buyer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !purchaseOrder.Consignment {
+		return shim.Error("purchase order " + PONumber + " is not a consignment order")
+	}
+	LineNumber := ""
+	for _, line := range purchaseOrder.Lines {
+		if line.MaterialCode == MaterialCode {
+			LineNumber = line.LineNumber
+			break
+		}
+	}
+	if LineNumber == "" {
+		return shim.Error("material " + MaterialCode + " is not on purchase order " + PONumber)
+	}
+
+	consumptionKey, err := stub.CreateCompositeKey("consumption", []string{PONumber, RecordId})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	consumptionAsBytes, err := stub.GetState(consumptionKey)
+	if err != nil {
+		return shim.Error("Failed to get consumption record: " + err.Error())
+	} else if consumptionAsBytes != nil {
+		return shim.Error("This consumption record already exists: " + RecordId)
+	}
+
+	stock, err := getConsignmentStock(stub, purchaseOrder.Buyer, purchaseOrder.Supplier, MaterialCode)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if Quantity > stock.Quantity {
+		return shim.Error(fmt.Sprintf("only %d of %s in consignment stock, cannot consume %d", stock.Quantity, MaterialCode, Quantity))
+	}
+	stock.Quantity -= Quantity
+	stock.ConsumedQuantity += Quantity
+	err = putConsignmentStock(stub, stock)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	RecordedBy, err := caller.Id(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	consumption := ConsumptionRecord{ObjectType: "consumption", RecordId: RecordId, PONumber: PONumber, LineNumber: LineNumber,
+		MaterialCode: MaterialCode, Buyer: purchaseOrder.Buyer, Supplier: purchaseOrder.Supplier, Quantity: Quantity,
+		ConsumptionDate: ConsumptionDate, RecordedBy: RecordedBy}
+	consumptionJSONasBytes, err := json.Marshal(consumption)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(consumptionKey, consumptionJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end recordConsumption (success)")
+	return shim.Success(nil)
+}
+
+//consumption recorded on a purchase order between two dates (YYYY-MM-DD, both included),
+//either date may be left empty
+func (t *PurchaseOrderChaincode) getConsumptions(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting PO number, from date and to date")
+	}
+
+	PONumber := args[0]
+	FromDate := args[1]
+	ToDate := args[2]
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("consumption", []string{PONumber})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	consumptions := []ConsumptionRecord{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		consumption := ConsumptionRecord{}
+		err = json.Unmarshal(queryResponse.Value, &consumption)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if consumption.ConsumptionDate < FromDate || (ToDate != "" && consumption.ConsumptionDate > ToDate) {
+			continue
+		}
+		consumptions = append(consumptions, consumption)
+	}
+
+	consumptionsAsBytes, err := json.Marshal(consumptions)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(consumptionsAsBytes)
+}
+
+//the supplier's stock at the buyer's site, per material
+func (t *PurchaseOrderChaincode) getConsignmentStock(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting buyer and supplier")
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("consignment", []string{args[0], args[1]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	stocks := []ConsignmentStock{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		stock := ConsignmentStock{}
+		err = json.Unmarshal(queryResponse.Value, &stock)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		stocks = append(stocks, stock)
+	}
+
+	stocksAsBytes, err := json.Marshal(stocks)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(stocksAsBytes)
+}
+
+func getConsignmentStock(stub shim.ChaincodeStubInterface, Buyer string, Supplier string, MaterialCode string) (ConsignmentStock, error) {
+	stock := ConsignmentStock{ObjectType: "consignment", Buyer: Buyer, Supplier: Supplier, MaterialCode: MaterialCode}
+	stockKey, err := stub.CreateCompositeKey("consignment", []string{Buyer, Supplier, MaterialCode})
+	if err != nil {
+		return stock, err
+	}
+	stockAsBytes, err := stub.GetState(stockKey)
+	if err != nil {
+		return stock, fmt.Errorf("Failed to get consignment stock: %s", err.Error())
+	} else if stockAsBytes == nil {
+		return stock, nil
+	}
+	err = json.Unmarshal(stockAsBytes, &stock)
+	return stock, err
+}
+
+func putConsignmentStock(stub shim.ChaincodeStubInterface, stock ConsignmentStock) error {
+	stockKey, err := stub.CreateCompositeKey("consignment", []string{stock.Buyer, stock.Supplier, stock.MaterialCode})
+	if err != nil {
+		return err
+	}
+	stockJSONasBytes, err := json.Marshal(stock)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(stockKey, stockJSONasBytes)
+}
+
+// ==== Helpers ====
+
+//a PO line from line number, material code, quantity, UOP, price, currency and delivery date
+func getPOLine(args []string) (POLine, error) {
+	line := POLine{LineNumber: strings.TrimSpace(args[0]), MaterialCode: strings.TrimSpace(args[1]), UOP: strings.TrimSpace(args[3]),
+		Currency: strings.ToUpper(strings.TrimSpace(args[5])), DeliveryDate: args[6], Status: "OPEN"}
+	if line.LineNumber == "" || line.MaterialCode == "" {
+		return line, fmt.Errorf("line number and material code must not be empty")
+	}
+
+	var err error
+	line.Quantity, err = strconv.ParseInt(args[2], 10, 64)
+	if err != nil || line.Quantity <= 0 {
+		return line, fmt.Errorf("quantity of line %s must be a positive whole number", line.LineNumber)
+	}
+	line.Price, err = currency.ParsePrice(args[4], line.Currency)
+	if err != nil {
+		return line, fmt.Errorf("price of line %s: %s", line.LineNumber, err.Error())
+	}
+	_, err = time.Parse(dateLayout, line.DeliveryDate)
+	if err != nil {
+		return line, fmt.Errorf("delivery date of line %s must be YYYY-MM-DD", line.LineNumber)
+	}
+	return line, nil
+}
+
+//index of a line on the purchase order, -1 when it is not there
+func findLine(purchaseOrder PurchaseOrder, LineNumber string) int {
+	for i, line := range purchaseOrder.Lines {
+		if line.LineNumber == LineNumber {
+			return i
+		}
+	}
+	return -1
+}
+
+//move line i to a new status if the transition is allowed and keep the change with actor and time
+func setLineStatus(stub shim.ChaincodeStubInterface, purchaseOrder *PurchaseOrder, i int, newStatus string, ReasonCode string, Comment string) error {
+	line := &purchaseOrder.Lines[i]
+	if line.Status == newStatus {
+		return nil
+	}
+	allowed := false
+	for _, status := range lineStatusTransitions[line.Status] {
+		if status == newStatus {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("line %s of purchase order %s cannot go from %s to %s", line.LineNumber, purchaseOrder.PONumber, line.Status, newStatus)
+	}
+
+	ChangedBy, err := caller.Id(stub)
+	if err != nil {
+		return err
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return err
+	}
+	change := StatusChange{ObjectType: "statuschange", PONumber: purchaseOrder.PONumber, LineNumber: line.LineNumber,
+		FromStatus: line.Status, ToStatus: newStatus, ReasonCode: ReasonCode, Comment: Comment, ChangedBy: ChangedBy,
+		ChangeDate: txTime.Format(time.RFC3339)}
+	changeKey, err := stub.CreateCompositeKey("statuschange", []string{purchaseOrder.PONumber, line.LineNumber, stub.GetTxID()})
+	if err != nil {
+		return err
+	}
+	changeJSONasBytes, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	err = stub.PutState(changeKey, changeJSONasBytes)
+	if err != nil {
+		return err
+	}
+
+	line.Status = newStatus
+	return nil
+}
+
+//the order status follows its lines: CLOSED when all are closed, DELIVERED when all are
+//delivered or closed, PARTIALLY_DELIVERED once anything arrived and OPEN before that
+func getOrderStatus(purchaseOrder PurchaseOrder) string {
+	closed := 0
+	delivered := 0
+	started := false
+	for _, line := range purchaseOrder.Lines {
+		switch line.Status {
+		case "CLOSED":
+			closed++
+			delivered++
+		case "DELIVERED":
+			delivered++
+		}
+		if line.DeliveredQuantity > 0 {
+			started = true
+		}
+	}
+	switch {
+	case len(purchaseOrder.Lines) > 0 && closed == len(purchaseOrder.Lines):
+		return "CLOSED"
+	case len(purchaseOrder.Lines) > 0 && delivered == len(purchaseOrder.Lines):
+		return "DELIVERED"
+	case started:
+		return "PARTIALLY_DELIVERED"
+	}
+	return "OPEN"
+}
+
+func getPurchaseOrder(stub shim.ChaincodeStubInterface, PONumber string) (PurchaseOrder, error) {
+	purchaseOrder := PurchaseOrder{}
+	POAsBytes, err := stub.GetState(PONumber)
+	if err != nil {
+		return purchaseOrder, fmt.Errorf("Failed to get purchase order: %s", err.Error())
+	} else if POAsBytes == nil {
+		return purchaseOrder, fmt.Errorf("purchase order does not exist: %s", PONumber)
+	}
+	err = json.Unmarshal(POAsBytes, &purchaseOrder)
+	return purchaseOrder, err
+}
+
+func putPurchaseOrder(stub shim.ChaincodeStubInterface, purchaseOrder PurchaseOrder) error {
+	purchaseOrder.Status = getOrderStatus(purchaseOrder)
+	POJSONasBytes, err := json.Marshal(purchaseOrder)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(purchaseOrder.PONumber, POJSONasBytes)
+}
+
+func getPurchaseOrdersForQueryString(stub shim.ChaincodeStubInterface, queryString string) ([]PurchaseOrder, error) {
+	resultsIterator, err := stub.GetQueryResult(queryString)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	purchaseOrders := []PurchaseOrder{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		purchaseOrder := PurchaseOrder{}
+		err = json.Unmarshal(queryResponse.Value, &purchaseOrder)
+		if err != nil {
+			return nil, err
+		}
+		purchaseOrders = append(purchaseOrders, purchaseOrder)
+	}
+	return purchaseOrders, nil
+}
+
+//leave a notification in the inbox of each recipient and emit it as a chaincode event.
+//A transaction carries one event only, so call it once per transaction. Notifying is best
+//effort: a failure is logged and the purchase order change it reports is still recorded
+func notify(stub shim.ChaincodeStubInterface, Type string, Reference string, Message string, Recipients ...string) {
+	notifyArgs := append([]string{"notify", Type, Reference, Message}, Recipients...)
+	response := stub.InvokeChaincode(notificationChaincode, util.ToChaincodeArgs(notifyArgs...), "")
+	if response.Status != shim.OK {
+		fmt.Println("- failed to notify " + strings.Join(Recipients, ", ") + ": " + response.Message)
+		return
+	}
+	err := stub.SetEvent("NotificationEvent", response.Payload)
+	if err != nil {
+		fmt.Println("- failed to emit notification event: " + err.Error())
+	}
+}
+
+//the transaction timestamp is the same on every endorser, unlike time.Now()
+func getTxTime(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos)).UTC(), nil
+}
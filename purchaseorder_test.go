@@ -0,0 +1,382 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/RinuT/chaincode/chaincodetest"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+var (
+	buyer    = chaincodetest.Identity("SchneiderMSP", "")
+	supplier = chaincodetest.Identity("FlextronicsMSP", "")
+	outsider = chaincodetest.Identity("OutsiderMSP", "")
+)
+
+//stands in for the shipment (painting.go) and notification (notification.go) chaincodes
+//and keeps the args of every call. It knows no shipment, so createASN registers them
+type chaincodeRecorder struct {
+	calls [][]string
+}
+
+func (r *chaincodeRecorder) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (r *chaincodeRecorder) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	r.calls = append(r.calls, stub.GetStringArgs())
+	if function, _ := stub.GetFunctionAndParameters(); function == "getShipmentDetails" {
+		return shim.Error("shipment does not exist")
+	}
+	return shim.Success(nil)
+}
+
+//the purchase order chaincode next to recording shipment and notification chaincodes
+func newPurchaseOrderChannel() (*chaincodetest.Stub, *chaincodeRecorder, *chaincodeRecorder) {
+	channel := chaincodetest.NewChannel()
+	purchaseOrders := channel.Install("purchaseorder", new(PurchaseOrderChaincode))
+	shipments := &chaincodeRecorder{}
+	channel.Install(shipmentChaincode, shipments)
+	notifications := &chaincodeRecorder{}
+	channel.Install(notificationChaincode, notifications)
+	return purchaseOrders, shipments, notifications
+}
+
+func invokeOK(t *testing.T, stub *chaincodetest.Stub, creator []byte, args ...string) []byte {
+	t.Helper()
+	response := stub.Invoke(creator, args...)
+	if response.Status != shim.OK {
+		t.Fatalf("%s: %s", args[0], response.Message)
+	}
+	return response.Payload
+}
+
+func invokeFails(t *testing.T, stub *chaincodetest.Stub, creator []byte, want string, args ...string) {
+	t.Helper()
+	response := stub.Invoke(creator, args...)
+	if response.Status == shim.OK {
+		t.Fatalf("%s succeeded, expecting %q", args[0], want)
+	}
+	if !strings.Contains(response.Message, want) {
+		t.Fatalf("%s: %s, expecting %q", args[0], response.Message, want)
+	}
+}
+
+//PO 4500001 from Schneider to Flextronics, 500 of line 10 and 200 of line 20
+func createTestPurchaseOrder(t *testing.T, purchaseOrders *chaincodetest.Stub) {
+	t.Helper()
+	invokeOK(t, purchaseOrders, buyer, "createPurchaseOrder", "4500001", "FlextronicsMSP",
+		"10", "SE-100234", "500", "EA", "12.50", "EUR", "2018-09-30",
+		"20", "SE-100871", "200", "EA", "3.10", "EUR", "2018-10-15")
+}
+
+func readPurchaseOrder(t *testing.T, purchaseOrders *chaincodetest.Stub, PONumber string) PurchaseOrder {
+	t.Helper()
+	purchaseOrder := PurchaseOrder{}
+	err := json.Unmarshal(purchaseOrders.State[PONumber], &purchaseOrder)
+	if err != nil {
+		t.Fatalf("purchase order %s: %s", PONumber, err)
+	}
+	return purchaseOrder
+}
+
+//the calls of a recorder joined with spaces, one per call
+func recorded(recorder *chaincodeRecorder) []string {
+	calls := []string{}
+	for _, call := range recorder.calls {
+		calls = append(calls, strings.Join(call, " "))
+	}
+	return calls
+}
+
+// ==== Purchase orders and line status ====
+
+func TestCreatePurchaseOrderByCaller(t *testing.T) {
+	purchaseOrders, _, notifications := newPurchaseOrderChannel()
+	invokeFails(t, purchaseOrders, buyer, "price of line 10: \"12.5000001\" is not a unit price in EUR, expecting at most 6 decimals",
+		"createPurchaseOrder", "4500001", "FlextronicsMSP", "10", "SE-100234", "500", "EA", "12.5000001", "EUR", "2018-09-30")
+	invokeFails(t, purchaseOrders, buyer, "Line 10 is listed more than once", "createPurchaseOrder", "4500001", "FlextronicsMSP",
+		"10", "SE-100234", "500", "EA", "12.50", "EUR", "2018-09-30", "10", "SE-100871", "200", "EA", "3.10", "EUR", "2018-10-15")
+	createTestPurchaseOrder(t, purchaseOrders)
+	invokeFails(t, purchaseOrders, buyer, "This purchase order already exists: 4500001",
+		"createPurchaseOrder", "4500001", "FlextronicsMSP", "10", "SE-100234", "500", "EA", "12.50", "EUR", "2018-09-30")
+
+	purchaseOrder := readPurchaseOrder(t, purchaseOrders, "4500001")
+	if purchaseOrder.Buyer != "SchneiderMSP" || purchaseOrder.Status != "OPEN" || purchaseOrder.Acknowledgment != "PENDING" ||
+		purchaseOrder.Revision != 1 || len(purchaseOrder.Lines) != 2 || purchaseOrder.Lines[0].Price != "12.50" {
+		t.Fatalf("purchase order = %+v, expecting an open, unanswered first revision bought by the caller SchneiderMSP", purchaseOrder)
+	}
+	want := "notify NEW_PO 4500001 new purchase order 4500001 from SchneiderMSP FlextronicsMSP"
+	if calls := recorded(notifications); len(calls) != 1 || calls[0] != want {
+		t.Fatalf("notification chaincode called with %q, expecting %q", calls, want)
+	}
+
+	invokeFails(t, purchaseOrders, supplier, "FlextronicsMSP is not allowed to do this, expecting SchneiderMSP",
+		"addPurchaseOrderLine", "4500001", "30", "SE-100999", "10", "EA", "1", "EUR", "2018-10-30")
+	invokeOK(t, purchaseOrders, buyer, "addPurchaseOrderLine", "4500001", "30", "SE-100999", "10", "EA", "1", "EUR", "2018-10-30")
+	if purchaseOrder = readPurchaseOrder(t, purchaseOrders, "4500001"); len(purchaseOrder.Lines) != 3 || purchaseOrder.Revision != 2 {
+		t.Fatalf("purchase order has %d lines at revision %d, expecting 3 at revision 2", len(purchaseOrder.Lines), purchaseOrder.Revision)
+	}
+}
+
+func TestCloseLineByHand(t *testing.T) {
+	purchaseOrders, _, _ := newPurchaseOrderChannel()
+	createTestPurchaseOrder(t, purchaseOrders)
+
+	invokeFails(t, purchaseOrders, buyer, "Only CLOSED can be set on a line", "updateLineStatus", "4500001", "10", "DELIVERED", "GOODS_RECEIVED")
+	invokeFails(t, purchaseOrders, buyer, "Unknown reason code: LATE", "updateLineStatus", "4500001", "10", "CLOSED", "LATE")
+	invokeFails(t, purchaseOrders, buyer, "Reason code OTHER needs a comment", "updateLineStatus", "4500001", "10", "CLOSED", "OTHER")
+	invokeFails(t, purchaseOrders, outsider, "OutsiderMSP is not allowed to do this", "updateLineStatus", "4500001", "10", "CLOSED", "CANCELLED")
+	invokeOK(t, purchaseOrders, supplier, "updateLineStatus", "4500001", "10", "closed", "short_closed", "remaining quantity no longer needed")
+	invokeOK(t, purchaseOrders, buyer, "updateLineStatus", "4500001", "20", "CLOSED", "CANCELLED")
+	if status := readPurchaseOrder(t, purchaseOrders, "4500001").Status; status != "CLOSED" {
+		t.Fatalf("purchase order is %s with every line closed, expecting CLOSED", status)
+	}
+
+	changes := []StatusChange{}
+	if err := json.Unmarshal(invokeOK(t, purchaseOrders, buyer, "getStatusChanges", "4500001"), &changes); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || changes[0].LineNumber != "10" || changes[0].ReasonCode != "SHORT_CLOSED" ||
+		changes[0].FromStatus != "OPEN" || !strings.HasPrefix(changes[0].ChangedBy, "FlextronicsMSP/") {
+		t.Fatalf("status changes = %+v, expecting line 10 short closed by FlextronicsMSP and line 20 cancelled", changes)
+	}
+}
+
+// ==== Acknowledgment and change orders ====
+
+func TestAcknowledgePurchaseOrder(t *testing.T) {
+	purchaseOrders, _, _ := newPurchaseOrderChannel()
+	createTestPurchaseOrder(t, purchaseOrders)
+
+	invokeFails(t, purchaseOrders, buyer, "SchneiderMSP is not allowed to do this, expecting FlextronicsMSP",
+		"acknowledgePurchaseOrder", "4500001", "CONFIRM", "")
+	invokeFails(t, purchaseOrders, supplier, "Answer must be CONFIRM or REJECT", "acknowledgePurchaseOrder", "4500001", "OK", "")
+	invokeFails(t, purchaseOrders, supplier, "A comment is required to reject a purchase order", "acknowledgePurchaseOrder", "4500001", "REJECT", " ")
+	invokeOK(t, purchaseOrders, supplier, "acknowledgePurchaseOrder", "4500001", "confirm", "")
+	invokeFails(t, purchaseOrders, supplier, "purchase order 4500001 is already CONFIRMED", "acknowledgePurchaseOrder", "4500001", "REJECT", "changed our mind")
+	invokeFails(t, purchaseOrders, buyer, "purchase order 4500001 was already answered by the supplier, propose a change instead",
+		"addPurchaseOrderLine", "4500001", "30", "SE-100999", "10", "EA", "1", "EUR", "2018-10-30")
+}
+
+func TestChangeOrderBecomesRevision(t *testing.T) {
+	purchaseOrders, _, notifications := newPurchaseOrderChannel()
+	createTestPurchaseOrder(t, purchaseOrders)
+
+	invokeFails(t, purchaseOrders, supplier, "Line 30 does not exist on purchase order 4500001",
+		"proposeChange", "4500001", "capacity limited", "30", "400", "", "")
+	invokeFails(t, purchaseOrders, supplier, "Line 10 has nothing to change", "proposeChange", "4500001", "capacity limited", "10", "", "", "")
+	ChangeId := string(invokeOK(t, purchaseOrders, supplier, "proposeChange", "4500001", "capacity limited until October", "10", "400", "", "2018-10-07"))
+	if acknowledgment := readPurchaseOrder(t, purchaseOrders, "4500001").Acknowledgment; acknowledgment != "CHANGES_PROPOSED" {
+		t.Fatalf("purchase order is %s, expecting CHANGES_PROPOSED", acknowledgment)
+	}
+	want := "notify CHANGE_PROPOSED 4500001 FlextronicsMSP proposed change " + ChangeId + " to purchase order 4500001 SchneiderMSP"
+	if calls := recorded(notifications); calls[len(calls)-1] != want {
+		t.Fatalf("notification chaincode called with %q, expecting %q", calls[len(calls)-1], want)
+	}
+
+	invokeFails(t, purchaseOrders, supplier, "FlextronicsMSP is not allowed to do this, expecting SchneiderMSP", "acceptChange", "4500001", ChangeId)
+	invokeOK(t, purchaseOrders, buyer, "acceptChange", "4500001", ChangeId)
+	invokeFails(t, purchaseOrders, buyer, "change "+ChangeId+" was already accepted", "acceptChange", "4500001", ChangeId)
+	purchaseOrder := readPurchaseOrder(t, purchaseOrders, "4500001")
+	if purchaseOrder.Acknowledgment != "CONFIRMED" || purchaseOrder.Revision != 2 || purchaseOrder.Lines[0].Quantity != 400 ||
+		purchaseOrder.Lines[0].DeliveryDate != "2018-10-07" || purchaseOrder.Lines[0].Price != "12.50" {
+		t.Fatalf("purchase order = %+v, expecting revision 2 confirmed with 400 of line 10 on 2018-10-07", purchaseOrder)
+	}
+	revisions := []PurchaseOrder{}
+	if err := json.Unmarshal(invokeOK(t, purchaseOrders, buyer, "getRevisions", "4500001"), &revisions); err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 2 || revisions[0].Lines[0].Quantity != 500 || revisions[1].Lines[0].Quantity != 400 {
+		t.Fatalf("revisions = %+v, expecting 500 of line 10 at revision 1 and 400 at revision 2", revisions)
+	}
+}
+
+func TestChangeOrderOnOlderRevision(t *testing.T) {
+	purchaseOrders, _, _ := newPurchaseOrderChannel()
+	createTestPurchaseOrder(t, purchaseOrders)
+	invokeOK(t, purchaseOrders, supplier, "acknowledgePurchaseOrder", "4500001", "CONFIRM", "")
+
+	priceChange := string(invokeOK(t, purchaseOrders, buyer, "proposeChange", "4500001", "new price list", "20", "", "2.95", ""))
+	dateChange := string(invokeOK(t, purchaseOrders, buyer, "proposeChange", "4500001", "needed earlier", "20", "", "", "2018-10-01"))
+	invokeOK(t, purchaseOrders, supplier, "acceptChange", "4500001", priceChange)
+	invokeFails(t, purchaseOrders, supplier, "change "+dateChange+" was proposed against revision 1 but the purchase order is at revision 2",
+		"acceptChange", "4500001", dateChange)
+
+	invokeFails(t, purchaseOrders, supplier, "A comment is required to reject a change", "rejectChange", "4500001", dateChange, "")
+	invokeOK(t, purchaseOrders, supplier, "rejectChange", "4500001", dateChange, "propose it again on the new price")
+	changeOrders := []ChangeOrder{}
+	if err := json.Unmarshal(invokeOK(t, purchaseOrders, buyer, "getChangeOrders", "4500001"), &changeOrders); err != nil {
+		t.Fatal(err)
+	}
+	decided := map[string]string{}
+	for _, changeOrder := range changeOrders {
+		decided[changeOrder.ChangeId] = changeOrder.Status
+	}
+	if len(decided) != 2 || decided[priceChange] != "ACCEPTED" || decided[dateChange] != "REJECTED" {
+		t.Fatalf("change orders = %+v, expecting the price change accepted and the date change rejected", changeOrders)
+	}
+	if line := readPurchaseOrder(t, purchaseOrders, "4500001").Lines[1]; line.Price != "2.95" || line.DeliveryDate != "2018-10-15" {
+		t.Fatalf("line 20 = %+v, expecting the new price and the old delivery date", line)
+	}
+}
+
+// ==== Advance shipping notices ====
+
+func TestShippingNoticeRegistersShipment(t *testing.T) {
+	purchaseOrders, shipments, notifications := newPurchaseOrderChannel()
+	createTestPurchaseOrder(t, purchaseOrders)
+
+	invokeFails(t, purchaseOrders, supplier, "purchase order 4500001 is PENDING, only confirmed orders can be shipped",
+		"createASN", "DN-7781", "4500001", "SH-1001", "2018-09-25", "Chennai", "Grenoble", "10", "250", "B-20180901")
+	invokeOK(t, purchaseOrders, supplier, "acknowledgePurchaseOrder", "4500001", "CONFIRM", "")
+	invokeFails(t, purchaseOrders, buyer, "SchneiderMSP is not allowed to do this, expecting FlextronicsMSP",
+		"createASN", "DN-7781", "4500001", "SH-1001", "2018-09-25", "Chennai", "Grenoble", "10", "250", "B-20180901")
+	invokeFails(t, purchaseOrders, supplier, "shipment SH-1001 does not exist yet, origin and destination are needed to register it",
+		"createASN", "DN-7781", "4500001", "SH-1001", "2018-09-25", "", "", "10", "250", "B-20180901")
+
+	shipments.calls = nil
+	invokeOK(t, purchaseOrders, supplier, "createASN", "DN-7781", "4500001", "SH-1001", "2018-09-25", "Chennai", "Grenoble",
+		"10", "250", "B-20180901", "10", "100", "B-20180902")
+	want := []string{
+		"getShipmentDetails SH-1001",
+		"registerShipment SH-1001 SchneiderMSP FlextronicsMSP Chennai Grenoble Chennai good_condition   ",
+	}
+	if calls := recorded(shipments); len(calls) != len(want) || calls[0] != want[0] || calls[1] != want[1] {
+		t.Fatalf("shipment chaincode called with %q, expecting %q", calls, want)
+	}
+	notification := "notify ASN_RECEIVED 4500001 delivery note DN-7781 on purchase order 4500001 shipped as shipment SH-1001 SchneiderMSP"
+	if calls := recorded(notifications); calls[len(calls)-1] != notification {
+		t.Fatalf("notification chaincode called with %q, expecting %q", calls[len(calls)-1], notification)
+	}
+	if line := readPurchaseOrder(t, purchaseOrders, "4500001").Lines[0]; line.ShippedQuantity != 350 {
+		t.Fatalf("line 10 has %d shipped, expecting both batches, 350", line.ShippedQuantity)
+	}
+
+	asn := ASN{}
+	if err := json.Unmarshal(invokeOK(t, purchaseOrders, buyer, "getASN", "4500001", "DN-7781"), &asn); err != nil {
+		t.Fatal(err)
+	}
+	if asn.Status != "SHIPPED" || asn.ShipmentId != "SH-1001" || len(asn.Lines) != 2 || asn.Lines[1].MaterialCode != "SE-100234" {
+		t.Fatalf("shipping notice = %+v, expecting two batches of SE-100234 shipped as SH-1001", asn)
+	}
+	invokeFails(t, purchaseOrders, supplier, "This delivery note already exists: DN-7781",
+		"createASN", "DN-7781", "4500001", "SH-1001", "2018-09-25", "Chennai", "Grenoble", "20", "10", "B-20180903")
+}
+
+func TestShippingNoticeWithinOpenQuantity(t *testing.T) {
+	purchaseOrders, _, _ := newPurchaseOrderChannel()
+	createTestPurchaseOrder(t, purchaseOrders)
+	invokeOK(t, purchaseOrders, supplier, "acknowledgePurchaseOrder", "4500001", "CONFIRM", "")
+
+	invokeOK(t, purchaseOrders, supplier, "createASN", "DN-7781", "4500001", "SH-1001", "2018-09-25", "Chennai", "Grenoble", "10", "400", "B-20180901")
+	invokeFails(t, purchaseOrders, supplier, "line 10 has 100 open, cannot ship 150",
+		"createASN", "DN-7782", "4500001", "SH-1002", "2018-09-26", "Chennai", "Grenoble", "10", "150", "B-20180902")
+	invokeFails(t, purchaseOrders, supplier, "batch id of line 20 must not be empty",
+		"createASN", "DN-7782", "4500001", "SH-1002", "2018-09-26", "Chennai", "Grenoble", "20", "50", " ")
+	invokeFails(t, purchaseOrders, supplier, "quantity of line 10 cannot go below the 400 already shipped",
+		"proposeChange", "4500001", "fewer needed", "10", "300", "", "")
+
+	invokeOK(t, purchaseOrders, buyer, "updateLineStatus", "4500001", "20", "CLOSED", "CANCELLED")
+	invokeFails(t, purchaseOrders, supplier, "line 20 is closed",
+		"createASN", "DN-7782", "4500001", "SH-1002", "2018-09-26", "Chennai", "Grenoble", "20", "50", "B-20180903")
+}
+
+// ==== Goods receipts ====
+
+//PO 4500001 confirmed, with 300 of line 10 announced on DN-7781 in batch B-20180901
+//and 200 of line 20 in batch B-20180902
+func shipTestPurchaseOrder(t *testing.T, purchaseOrders *chaincodetest.Stub) {
+	t.Helper()
+	createTestPurchaseOrder(t, purchaseOrders)
+	invokeOK(t, purchaseOrders, supplier, "acknowledgePurchaseOrder", "4500001", "CONFIRM", "")
+	invokeOK(t, purchaseOrders, supplier, "createASN", "DN-7781", "4500001", "SH-1001", "2018-09-25", "Chennai", "Grenoble",
+		"10", "300", "B-20180901", "20", "200", "B-20180902")
+}
+
+func TestGoodsReceiptFlagsDiscrepancies(t *testing.T) {
+	purchaseOrders, _, notifications := newPurchaseOrderChannel()
+	shipTestPurchaseOrder(t, purchaseOrders)
+
+	invokeFails(t, purchaseOrders, supplier, "FlextronicsMSP is not allowed to do this, expecting SchneiderMSP",
+		"recordGoodsReceipt", "GR-5001", "4500001", "DN-7781", "2018-09-28", "10", "B-20180901", "300")
+	invokeFails(t, purchaseOrders, buyer, "Line 30 is not on delivery note DN-7781",
+		"recordGoodsReceipt", "GR-5001", "4500001", "DN-7781", "2018-09-28", "30", "B-20180901", "300")
+	receipt := GoodsReceipt{}
+	err := json.Unmarshal(invokeOK(t, purchaseOrders, buyer, "recordGoodsReceipt", "GR-5001", "4500001", "DN-7781", "2018-09-28",
+		"10", "B-20180901", "240", "20", "B-20180902", "190", "20", "B-99", "20"), &receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Discrepancy{
+		{LineNumber: "10", Type: "SHORT", ExpectedQuantity: 300, ReceivedQuantity: 240},
+		{LineNumber: "20", BatchId: "B-99", Type: "WRONG_BATCH", ReceivedQuantity: 20},
+		{LineNumber: "20", Type: "OVER", ExpectedQuantity: 200, ReceivedQuantity: 210},
+	}
+	if len(receipt.Discrepancies) != len(want) || !receipt.HasDiscrepancy || !strings.HasPrefix(receipt.RecordedBy, "SchneiderMSP/") {
+		t.Fatalf("receipt = %+v, expecting %+v recorded by SchneiderMSP", receipt, want)
+	}
+	for i, discrepancy := range receipt.Discrepancies {
+		if discrepancy != want[i] {
+			t.Fatalf("discrepancy %d = %+v, expecting %+v", i, discrepancy, want[i])
+		}
+	}
+	notification := "notify GOODS_RECEIVED 4500001 receipt GR-5001 recorded for delivery note DN-7781 with 3 discrepancies FlextronicsMSP"
+	if calls := recorded(notifications); calls[len(calls)-1] != notification {
+		t.Fatalf("notification chaincode called with %q, expecting %q", calls[len(calls)-1], notification)
+	}
+
+	purchaseOrder := readPurchaseOrder(t, purchaseOrders, "4500001")
+	lines := purchaseOrder.Lines
+	if lines[0].DeliveredQuantity != 240 || lines[0].Status != "PARTIALLY_DELIVERED" || lines[1].DeliveredQuantity != 210 ||
+		lines[1].ShippedQuantity != 210 || lines[1].Status != "DELIVERED" || purchaseOrder.Status != "PARTIALLY_DELIVERED" {
+		t.Fatalf("lines = %+v, expecting line 10 partially and line 20 fully delivered", lines)
+	}
+	invokeFails(t, purchaseOrders, buyer, "delivery note DN-7781 was already received",
+		"recordGoodsReceipt", "GR-5002", "4500001", "DN-7781", "2018-09-29", "10", "B-20180901", "60")
+
+	receipts := []GoodsReceipt{}
+	if err = json.Unmarshal(invokeOK(t, purchaseOrders, supplier, "getDiscrepancies", "FlextronicsMSP"), &receipts); err != nil {
+		t.Fatal(err)
+	}
+	if len(receipts) != 1 || receipts[0].ReceiptId != "GR-5001" {
+		t.Fatalf("discrepancies of FlextronicsMSP = %+v, expecting GR-5001", receipts)
+	}
+}
+
+func TestReshipShortQuantity(t *testing.T) {
+	purchaseOrders, _, _ := newPurchaseOrderChannel()
+	shipTestPurchaseOrder(t, purchaseOrders)
+	invokeOK(t, purchaseOrders, buyer, "recordGoodsReceipt", "GR-5001", "4500001", "DN-7781", "2018-09-28",
+		"10", "B-20180901", "240", "20", "B-20180902", "200")
+
+	// the 60 that did not arrive stay shipped until the supplier says what happened to them
+	if line := readPurchaseOrder(t, purchaseOrders, "4500001").Lines[0]; line.ShippedQuantity != 300 {
+		t.Fatalf("line 10 has %d shipped before the shortage is resolved, expecting 300", line.ShippedQuantity)
+	}
+	invokeFails(t, purchaseOrders, supplier, "line 10 has 200 open, cannot ship 260",
+		"createASN", "DN-7782", "4500001", "SH-1002", "2018-10-02", "Chennai", "Grenoble", "10", "260", "B-20180903")
+
+	invokeFails(t, purchaseOrders, buyer, "SchneiderMSP is not allowed to do this, expecting FlextronicsMSP",
+		"resolveDiscrepancy", "4500001", "GR-5001", "10", "RESHIP")
+	invokeFails(t, purchaseOrders, supplier, "Resolution must be RESHIP or ACCEPTED", "resolveDiscrepancy", "4500001", "GR-5001", "10", "REFUND")
+	invokeFails(t, purchaseOrders, supplier, "line 20 of receipt GR-5001 has no open discrepancy",
+		"resolveDiscrepancy", "4500001", "GR-5001", "20", "ACCEPTED")
+	invokeOK(t, purchaseOrders, supplier, "resolveDiscrepancy", "4500001", "GR-5001", "10", "reship")
+	invokeFails(t, purchaseOrders, supplier, "line 10 of receipt GR-5001 has no open discrepancy",
+		"resolveDiscrepancy", "4500001", "GR-5001", "10", "RESHIP")
+
+	invokeOK(t, purchaseOrders, supplier, "createASN", "DN-7782", "4500001", "SH-1002", "2018-10-02", "Chennai", "Grenoble",
+		"10", "260", "B-20180903")
+	invokeOK(t, purchaseOrders, buyer, "recordGoodsReceipt", "GR-5002", "4500001", "DN-7782", "2018-10-05", "10", "B-20180903", "260")
+	purchaseOrder := readPurchaseOrder(t, purchaseOrders, "4500001")
+	if line := purchaseOrder.Lines[0]; line.DeliveredQuantity != 500 || line.ShippedQuantity != 500 || line.Status != "DELIVERED" {
+		t.Fatalf("line 10 = %+v, expecting all 500 shipped and delivered", line)
+	}
+	if purchaseOrder.Status != "DELIVERED" {
+		t.Fatalf("purchase order is %s, expecting DELIVERED", purchaseOrder.Status)
+	}
+}
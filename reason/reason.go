@@ -0,0 +1,35 @@
+//the reason codes a status change is recorded with, shared by the product (tracktrace.go)
+//and shipment (painting.go) chaincodes so both audit trails use the same vocabulary.
+package reason
+
+//the controlled vocabulary for status changes
+var Codes = map[string]bool{
+	"RECEIVED":              true,
+	"DISPATCHED":            true,
+	"IN_TRANSIT":            true,
+	"DELIVERED":             true,
+	"TEMPERATURE_EXCURSION": true,
+	"DAMAGED_PACKAGING":     true,
+	"SEAL_BROKEN":           true,
+	"COUNTERFEIT_SUSPECTED": true,
+	"QA_QUARANTINE":         true,
+	"QA_RELEASE":            true,
+	"QA_REJECTION":          true,
+	"RECALL":                true,
+	"RETURN":                true,
+	"DESTRUCTION":           true,
+	"DISPENSED":             true,
+	"DECOMMISSION":          true,
+	"DATA_CORRECTION":       true,
+	"OTHER":                 true, //needs a comment
+}
+
+//a single unit is dispensed to a patient, a shipment never is
+var productOnly = map[string]bool{
+	"DISPENSED": true,
+}
+
+//whether a code is in the vocabulary and applies to a shipment
+func IsShipmentCode(code string) bool {
+	return Codes[code] && !productOnly[code]
+}
@@ -0,0 +1,17 @@
+package reason
+
+import "testing"
+
+func TestIsShipmentCode(t *testing.T) {
+	for _, code := range []string{"DAMAGED_PACKAGING", "TEMPERATURE_EXCURSION", "OTHER"} {
+		if !IsShipmentCode(code) {
+			t.Errorf("IsShipmentCode(%q) = false", code)
+		}
+	}
+	// product only, not in the vocabulary, not upper case
+	for _, code := range []string{"DISPENSED", "FELL_OFF", "other", ""} {
+		if IsShipmentCode(code) {
+			t.Errorf("IsShipmentCode(%q) = true", code)
+		}
+	}
+}
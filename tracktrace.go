@@ -1,196 +1,3703 @@
-package main
-
-import (
-	"fmt"
-	"encoding/json"
-	"strings"
-
-	"github.com/hyperledger/fabric/core/chaincode/shim"
-	pb "github.com/hyperledger/fabric/protos/peer"
-)
-
-func main() {
-	//logger.SetLevel(shim.LogInfo)
-
-	err := shim.Start(new(SmartContract))
-	if err != nil {
-		fmt.Printf("Error starting Simple chaincode: %s", err)
-	}
-}
-
-
-type SmartContract struct {
-}
-
-type Product struct {
-	ObjectType      			 string `json:"docType"`
-	Uuid                         string `json:"Uuid"` //docType is used to distinguish the various types of objects in state database
-	Material                     string `json:"Material"` //the fieldtags are needed to keep case from bouncing around
-	Make                         string `json:"Make"`
-	RawMaterialLocation          string `json:"RawMaterialLocation"`
-	ProductStatus                string `json:"ProductStatus"` //the fieldtags are needed to keep case from bouncing around
-	ShipmentStatus               string `json:"ShipmentStatus"`
-	BatchCode                    string `json:"BatchCode"`
-}
-
-var ttFunctions = map[string]func(shim.ChaincodeStubInterface, []string) pb.Response{
-	"create_product":     		createProduct,
-	"search_product":     		searchProduct,
-	"update_product_status":    updateProductStatus,
-	"update_Shipment_status":	updateProductStatus,
-}
-
-// Create sample product
-func (t *SmartContract) Init(stub shim.ChaincodeStubInterface) pb.Response {
-	function, args := stub.GetFunctionAndParameters()
-	fmt.Println("init is running " + function)
-
-	Uuid := args[0]
-	Material := args[1]
-	Make := args[2]
-	RawMaterialLocation := args[3]
-	ProductStatus := args[4]
-	ShipmentStatus := args[5]
-	BatchCode := args[6]
-	
-	// ==== Create product and marshal to JSON ====
-	ObjectType := "product"
-	ProductStatus := strings.ToUpper(ProductStatus)
-	Product := &Product{ObjectType, Uuid, Material, Make, RawMaterialLocation, ProductStatus, ShipmentStatus, BatchCode}
-	orderJSONasBytes, err := json.Marshal(Product)
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-
-	err = stub.PutState(Uuid, orderJSONasBytes)
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	return shim.Success(nil)
-}
-
-
-func (t *SmartContract) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
-	function, args := stub.GetFunctionAndParameters()
-
-	if function == "init" {
-		return t.Init(stub)
-	}
-	ttFunc := ttFunctions[function]
-	if ttFunc == nil {
-		return shim.Error("Invalid invoke function.")
-	}
-	return ttFunc(stub, args)
-}
-
-
-//create a product using unique uuid
-
-func createProduct(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	var err error
-	
-
-	// if len(args) != 10 {
-	// 	return shim.Error("Incorrect number of arguments. Expecting 10")
-	// }
-
-	// ==== Input sanitation ====
-	fmt.Println("- start registerering shipment")
-
-	Uuid := args[0]
-	Material := args[1]
-	Make := args[2]
-	RawMaterialLocation := args[3]
-	ProductStatus := args[4]
-	ShipmentStatus := args[5]
-	BatchCode := args[6]
-
-	// ==== Check if order already exists ====
-	orderAsBytes, err := stub.GetState(Uuid)
-	if err != nil {
-		return shim.Error("Failed to register shipment: " + err.Error())
-	} else if orderAsBytes != nil {
-		fmt.Println("This shipment already exists: " + Uuid)
-		return shim.Error("This shipment already exists: " + Uuid)
-	}
-
-	// ==== Create order object and marshal to JSON ====
-	
-	    ObjectType := "shipment"
-		Product := &Product{ObjectType, Uuid, Material, Make, RawMaterialLocation, ProductStatus, ShipmentStatus, BatchCode}
-		fmt.Println(Product)
-		orderJSONasBytes, err := json.Marshal(Product)
-		fmt.Println(orderJSONasBytes)
-		if err != nil {
-			return shim.Error(err.Error())
-		}
-
-		// === Save order to state ===
-		err = stub.PutState(Uuid, orderJSONasBytes)
-		if err != nil {
-			return shim.Error(err.Error())
-		}
-	
-	fmt.Println("- end registering shimpment")
-	return shim.Success(nil)
-
-}
-
-//search the order details using order uuid
-func searchProduct(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	var Uuid, jsonResp string
-	var err error
-
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting shipment Id to query")
-	}
-
-	Uuid = args[0]
-	valAsbytes, err := stub.GetState(Uuid)
-	if err != nil {
-		jsonResp = "{\"Error\":\"Failed to get state for " + Uuid + "\"}"
-		return shim.Error(jsonResp)
-	} else if valAsbytes == nil {
-		jsonResp = "{\"Error\":\"shipment does not exist: " + Uuid + "\"}"
-		return shim.Error(jsonResp)
-	}
-
-	return shim.Success(valAsbytes)
-}
-
-func updateProductStatus(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	if len(args) < 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
-	}
-
-	Uuid := args[0]
-	newStatus := args[1]
-	fmt.Println("- update Product Status ", Uuid, newStatus)
-
-	orderAsBytes, err := stub.GetState(Uuid)
-	if err != nil {
-		return shim.Error("Failed to get product details:" + err.Error())
-	} else if orderAsBytes == nil {
-		return shim.Error("product does not exist")
-	}
-
-	orderToUpdate := Product{}
-	err = json.Unmarshal(orderAsBytes, &orderToUpdate) //unmarshal it aka JSON.parse()
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	if orderToUpdate.ProductStatus != "TAMPERED"
-	{
-	orderToUpdate.Temperature = newStatus //change the temperature
-	orderJSONasBytes, _ := json.Marshal(orderToUpdate)
-	err = stub.PutState(ShipmentId, orderJSONasBytes) //rewrite the marble
-	}
-	else
-		fmt.Println("You cannot change status of a tampered product")
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-
-	fmt.Println("- end updateTemperature (success)")
-	return shim.Success(nil)
-}
+package main
+
+import (
+	"fmt"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RinuT/chaincode/caller"
+	"github.com/RinuT/chaincode/gs1"
+	"github.com/RinuT/chaincode/label"
+	"github.com/RinuT/chaincode/reason"
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func main() {
+	//logger.SetLevel(shim.LogInfo)
+
+	err := shim.Start(new(SmartContract))
+	if err != nil {
+		fmt.Printf("Error starting Simple chaincode: %s", err)
+	}
+}
+
+
+type SmartContract struct {
+}
+
+type Product struct {
+	ObjectType      			 string `json:"docType"`
+	Uuid                         string `json:"Uuid"` //docType is used to distinguish the various types of objects in state database
+	Material                     string `json:"Material"` //the fieldtags are needed to keep case from bouncing around
+	Make                         string `json:"Make"`
+	RawMaterialLocation          string `json:"RawMaterialLocation"`
+	ProductStatus                string `json:"ProductStatus"` //the fieldtags are needed to keep case from bouncing around
+	ShipmentStatus               string `json:"ShipmentStatus"`
+	BatchCode                    string `json:"BatchCode"`
+	Holder                       string `json:"Holder"`
+	CurrentLocation              string `json:"CurrentLocation"`
+	RecallAction                 string `json:"RecallAction"`
+	RecallActionDate             string `json:"RecallActionDate"`
+	ManufactureDate              string `json:"ManufactureDate"` //dates are YYYY-MM-DD
+	ExpiryDate                   string `json:"ExpiryDate"`
+	GTIN                         string `json:"GTIN"`
+	SerialNumber                 string `json:"SerialNumber"`
+	ContainerId                  string `json:"ContainerId"` //case the unit is packed in
+	LastScanLocation             string `json:"LastScanLocation"`
+	LastScanDate                 string `json:"LastScanDate"`
+	QAStatus                     string `json:"QAStatus"` //QUARANTINED, RELEASED or REJECTED
+	RmaId                        string `json:"RmaId"` //open return authorization
+	DispensedAt                  string `json:"DispensedAt"`
+	DispensedDate                string `json:"DispensedDate"`
+	ShipmentId                   string `json:"ShipmentId"` //shipment in the shipment chaincode carrying the unit
+	StabilityBudgetMinutes       int64  `json:"StabilityBudgetMinutes"` //allowed time outside 2-8°C, 0 means not tracked
+	StabilityUsedSeconds         int64  `json:"StabilityUsedSeconds"`
+	StabilityExhausted           bool   `json:"StabilityExhausted"`
+	DecommissionReason           string `json:"DecommissionReason"` //DESTROYED, SAMPLE, STOLEN or LOST
+	DecommissionDate             string `json:"DecommissionDate"`
+	DecommissionedBy             string `json:"DecommissionedBy"`
+	PurgedStateHash              string `json:"PurgedStateHash"` //sha256 of the record before its sensitive fields were purged
+}
+
+//how much time outside 2-8°C a unit has left
+type StabilityBudget struct {
+	Uuid             string  `json:"Uuid"`
+	BatchCode        string  `json:"BatchCode"`
+	BudgetMinutes    int64   `json:"BudgetMinutes"`
+	UsedMinutes      float64 `json:"UsedMinutes"`
+	RemainingMinutes float64 `json:"RemainingMinutes"`
+	Exhausted        bool    `json:"Exhausted"`
+}
+
+//a unit consumed at a hospital, the patient reference is pseudonymous and never patient data
+type Consumption struct {
+	ObjectType       string `json:"docType"`
+	Uuid             string `json:"Uuid"`
+	GTIN             string `json:"GTIN"`
+	Material         string `json:"Material"`
+	BatchCode        string `json:"BatchCode"`
+	Hospital         string `json:"Hospital"`
+	Department       string `json:"Department"`
+	PatientReference string `json:"PatientReference"`
+	DispensedBy      string `json:"DispensedBy"`
+	DispenseDate     string `json:"DispenseDate"`
+	PurgedStateHash  string `json:"PurgedStateHash"` //sha256 of the record before the patient reference was purged
+}
+
+//what a hospital consumed in a period, totals are per material
+type ConsumptionReport struct {
+	Hospital         string         `json:"Hospital"`
+	From             string         `json:"From"`
+	To               string         `json:"To"`
+	Totals           map[string]int `json:"Totals"`
+	Records          []Consumption  `json:"Records"`
+}
+
+//a return merchandise authorization sending products back up the chain
+type Return struct {
+	ObjectType      string   `json:"docType"`
+	RmaId           string   `json:"RmaId"`
+	Products        []string `json:"Products"`
+	RequestedBy     string   `json:"RequestedBy"`
+	ReturnTo        string   `json:"ReturnTo"`
+	Reason          string   `json:"Reason"`
+	Status          string   `json:"Status"` //REQUESTED, APPROVED, REJECTED, SHIPPED, RECEIVED, RESTOCKED or DESTROYED
+	ShipmentId      string   `json:"ShipmentId"`
+	RequestDate     string   `json:"RequestDate"`
+	ApprovalDate    string   `json:"ApprovalDate"`
+	ShipDate        string   `json:"ShipDate"`
+	ReceiptDate     string   `json:"ReceiptDate"`
+	DispositionDate string   `json:"DispositionDate"`
+	CertificateId   string   `json:"CertificateId"`
+}
+
+//proof that returned products were destroyed, and who saw it happen
+type DestructionCertificate struct {
+	ObjectType      string   `json:"docType"`
+	CertificateId   string   `json:"CertificateId"`
+	RmaId           string   `json:"RmaId"`
+	Products        []string `json:"Products"`
+	Method          string   `json:"Method"`
+	Location        string   `json:"Location"`
+	DestroyedBy     string   `json:"DestroyedBy"`
+	Witnesses       []string `json:"Witnesses"`
+	DestructionDate string   `json:"DestructionDate"`
+}
+
+//the shipment chaincode (painting.go) as installed on the same channel
+const shipmentChaincode = "mycc"
+
+//QA state of a whole batch and the certificates of analysis backing it
+type Batch struct {
+	ObjectType      string     `json:"docType"`
+	BatchCode       string     `json:"BatchCode"`
+	QAStatus        string     `json:"QAStatus"`
+	Certificates    []Document `json:"Certificates"`
+}
+
+//a document kept off chain, identified by the hex SHA-256 of its content
+type Document struct {
+	Hash            string `json:"Hash"`
+	Name            string `json:"Name"`
+	AttachedBy      string `json:"AttachedBy"`
+	AttachedDate    string `json:"AttachedDate"`
+}
+
+//a scan of a product identifier and whatever looked wrong about it
+type Scan struct {
+	ObjectType      string   `json:"docType"`
+	Uuid            string   `json:"Uuid"`
+	ScannedBy       string   `json:"ScannedBy"`
+	Location        string   `json:"Location"`
+	ScanDate        string   `json:"ScanDate"`
+	Alerts          []string `json:"Alerts"`
+}
+
+//why a status changed, who changed it and when
+type StatusChange struct {
+	ObjectType      string `json:"docType"`
+	Id              string `json:"Id"`
+	Field           string `json:"Field"` //ProductStatus or ShipmentStatus
+	FromStatus      string `json:"FromStatus"`
+	ToStatus        string `json:"ToStatus"`
+	ReasonCode      string `json:"ReasonCode"`
+	Comment         string `json:"Comment"`
+	EvidenceHash    string `json:"EvidenceHash"` //hex SHA-256 of a supporting document
+	ChangedBy       string `json:"ChangedBy"`
+	ChangeDate      string `json:"ChangeDate"`
+}
+
+//the statuses update_product_status can set, DISPENSED and DECOMMISSIONED are only set
+//by dispense_product and decommission
+var productStatuses = map[string]bool{
+	"IN_GOOD_CONDITION": true,
+	"SUSPECT":           true,
+	"TAMPERED":          true,
+	"RECALLED":          true,
+	"DESTROYED":         true,
+}
+
+//a regulator or QA change to a product whose status is otherwise final
+type StatusOverride struct {
+	ObjectType      string `json:"docType"`
+	Uuid            string `json:"Uuid"`
+	FromStatus      string `json:"FromStatus"`
+	ToStatus        string `json:"ToStatus"`
+	Reason          string `json:"Reason"`
+	OverriddenBy    string `json:"OverriddenBy"`
+	Role            string `json:"Role"`
+	OverrideDate    string `json:"OverrideDate"`
+}
+
+//a distributor's check of a returned pack against the manufacturer's record
+type Verification struct {
+	ObjectType       string `json:"docType"`
+	GTIN             string `json:"GTIN"`
+	SerialNumber     string `json:"SerialNumber"`
+	Lot              string `json:"Lot"`
+	Expiry           string `json:"Expiry"`
+	RequestedBy      string `json:"RequestedBy"`
+	Uuid             string `json:"Uuid"`
+	Result           string `json:"Result"` //GENUINE, UNKNOWN, RECALLED, EXPIRED, ALREADY_DISPENSED or SUSPECT
+	Reason           string `json:"Reason"`
+	VerificationDate string `json:"VerificationDate"`
+}
+
+//a unit cannot travel between two locations faster than this
+const minRelocationTime = time.Hour
+
+//GS1 application identifier data as printed on a pack or scanned from its DataMatrix
+type GS1Data struct {
+	SSCC            string `json:"SSCC,omitempty"`   //(00)
+	GTIN            string `json:"GTIN,omitempty"`   //(01)
+	Lot             string `json:"Lot,omitempty"`    //(10)
+	Expiry          string `json:"Expiry,omitempty"` //(17) converted to YYYY-MM-DD
+	Serial          string `json:"Serial,omitempty"` //(21)
+}
+
+const dateLayout = "2006-01-02"
+
+type Recall struct {
+	ObjectType      string       `json:"docType"`
+	BatchCode       string       `json:"BatchCode"`
+	Reason          string       `json:"Reason"`
+	RecallDate      string       `json:"RecallDate"`
+	Holders         []string     `json:"Holders"`
+	Units           []RecallUnit `json:"Units"`
+}
+
+//where a recalled unit is at the time of the report
+type RecallUnit struct {
+	Uuid            string `json:"Uuid"`
+	Holder          string `json:"Holder"`
+	CurrentLocation string `json:"CurrentLocation"`
+	ShipmentStatus  string `json:"ShipmentStatus"`
+	RecallAction    string `json:"RecallAction"`
+}
+
+var ttFunctions = map[string]func(shim.ChaincodeStubInterface, []string) pb.Response{
+	"create_product":     		createProduct,
+	"search_product":     		searchProduct,
+	"update_product_status":    updateProductStatus,
+	"update_Shipment_status":	updateShipmentStatus,
+	"transfer_product":         transferProduct,
+	"recall_batch":             recallBatch,
+	"recall_report":            recallReport,
+	"record_recall_action":     recordRecallAction,
+	"expiring_products":        expiringProducts,
+	"search_product_by_gtin":   searchProductByGTIN,
+	"parse_gs1":                parseGS1ElementString,
+	"aggregate":                aggregate,
+	"disaggregate":             disaggregate,
+	"update_container_status":  updateContainerStatus,
+	"transfer_container":       transferContainer,
+	"container_of":             containerOf,
+	"container_contents":       containerContents,
+	"verify_scan":              verifyScan,
+	"scan_history":             scanHistory,
+	"verify_product_identifier": verifyProductIdentifier,
+	"verification_history":     verificationHistory,
+	"status_overrides":         statusOverrides,
+	"status_changes":           statusChanges,
+	"quarantine_product":       quarantineProduct,
+	"qa_decision":              qaDecision,
+	"quarantine_batch":         quarantineBatch,
+	"qa_batch_decision":        qaBatchDecision,
+	"attach_certificate":       attachCertificate,
+	"search_batch":             searchBatch,
+	"request_return":           requestReturn,
+	"approve_return":           approveReturn,
+	"ship_return":              shipReturn,
+	"receive_return":           receiveReturn,
+	"restock_return":           restockReturn,
+	"destroy_return":           destroyReturn,
+	"search_return":            searchReturn,
+	"search_destruction":       searchDestructionCertificate,
+	"dispense_product":         dispenseProduct,
+	"hospital_consumption":     hospitalConsumption,
+	"assign_to_shipment":       assignToShipment,
+	"products_on_shipment":     productsOnShipment,
+	"shipment_of_product":      shipmentOfProduct,
+	"shipment_incident":        shipmentIncident,
+	"deduct_stability":         deductStability,
+	"stability_budget":         stabilityBudget,
+	"batch_stability_budget":   batchStabilityBudget,
+	"label_payload":            labelPayload,
+	"verify_label":             verifyLabel,
+	"register_label_key":       registerLabelKey,
+	"label_key":                labelKey,
+	"decommission":             decommissionProduct,
+}
+
+// Create sample product
+func (t *SmartContract) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	function, args := stub.GetFunctionAndParameters()
+	fmt.Println("init is running " + function)
+
+	Uuid := args[0]
+	Material := args[1]
+	Make := args[2]
+	RawMaterialLocation := args[3]
+	ProductStatus := args[4]
+	ShipmentStatus := args[5]
+	BatchCode := args[6]
+	
+	// ==== Create product and marshal to JSON ====
+	ObjectType := "product"
+	ProductStatus = strings.ToUpper(ProductStatus)
+	Product := &Product{ObjectType: ObjectType, Uuid: Uuid, Material: Material, Make: Make, RawMaterialLocation: RawMaterialLocation,
+		ProductStatus: ProductStatus, ShipmentStatus: ShipmentStatus, BatchCode: BatchCode, Holder: Make, CurrentLocation: RawMaterialLocation}
+	orderJSONasBytes, err := json.Marshal(Product)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = stub.PutState(Uuid, orderJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+
+func (t *SmartContract) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	function, args := stub.GetFunctionAndParameters()
+
+	if function == "init" {
+		return t.Init(stub)
+	}
+	ttFunc := ttFunctions[function]
+	if ttFunc == nil {
+		return shim.Error("Invalid invoke function.")
+	}
+	return ttFunc(stub, args)
+}
+
+
+//create a product using unique uuid
+
+func createProduct(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	
+
+	if len(args) < 9 || len(args) > 11 {
+		return shim.Error("Incorrect number of arguments. Expecting 9, 10 or 11")
+	}
+
+	// ==== Input sanitation ====
+	fmt.Println("- start registerering shipment")
+
+	Uuid := args[0]
+	Material := args[1]
+	Make := args[2]
+	RawMaterialLocation := args[3]
+	ProductStatus := strings.ToUpper(args[4])
+	ShipmentStatus := args[5]
+	BatchCode := args[6]
+	ManufactureDate := args[7]
+	ExpiryDate := args[8]
+
+	// ==== Make is trusted to recall the batch, so a product is created by its maker ====
+	mspId, err := cid.GetMSPID(stub)
+	if err != nil {
+		return shim.Error("Failed to get caller MSP: " + err.Error())
+	}
+	if Make != mspId {
+		return shim.Error("Make must be the MSP of the caller, " + mspId)
+	}
+
+	// ==== A product starts in a status update_product_status can set, never in a final one ====
+	if !productStatuses[ProductStatus] {
+		return shim.Error("Unknown product status: " + args[4])
+	}
+	if isFinalStatus(ProductStatus) {
+		return shim.Error("A product cannot be created " + ProductStatus)
+	}
+
+	// ==== Optional GS1 element string, fills in or must agree with lot and expiry ====
+	GTIN := ""
+	SerialNumber := ""
+	if len(args) > 9 && args[9] != "" {
+		gs1, err := parseGS1(args[9])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if gs1.GTIN == "" || gs1.Serial == "" {
+			return shim.Error("GS1 data must contain a (01) GTIN and a (21) serial number")
+		}
+		if gs1.Lot != "" {
+			if BatchCode == "" {
+				BatchCode = gs1.Lot
+			} else if BatchCode != gs1.Lot {
+				return shim.Error("BatchCode " + BatchCode + " does not match GS1 lot " + gs1.Lot)
+			}
+		}
+		if gs1.Expiry != "" {
+			if ExpiryDate == "" {
+				ExpiryDate = gs1.Expiry
+			} else if ExpiryDate != gs1.Expiry {
+				return shim.Error("ExpiryDate " + ExpiryDate + " does not match GS1 expiry " + gs1.Expiry)
+			}
+		}
+		GTIN = gs1.GTIN
+		SerialNumber = gs1.Serial
+	}
+
+	// ==== Optional stability budget in minutes, the time the product may spend outside 2-8°C ====
+	StabilityBudgetMinutes := int64(0)
+	if len(args) > 10 && args[10] != "" {
+		StabilityBudgetMinutes, err = strconv.ParseInt(args[10], 10, 64)
+		if err != nil || StabilityBudgetMinutes <= 0 {
+			return shim.Error("Stability budget must be a positive number of minutes")
+		}
+	}
+
+	manufactured, err := time.Parse(dateLayout, ManufactureDate)
+	if err != nil {
+		return shim.Error("ManufactureDate must be YYYY-MM-DD: " + err.Error())
+	}
+	expires, err := time.Parse(dateLayout, ExpiryDate)
+	if err != nil {
+		return shim.Error("ExpiryDate must be YYYY-MM-DD: " + err.Error())
+	}
+	if !expires.After(manufactured) {
+		return shim.Error("ExpiryDate must be after ManufactureDate")
+	}
+
+	// ==== Check if order already exists ====
+	orderAsBytes, err := stub.GetState(Uuid)
+	if err != nil {
+		return shim.Error("Failed to register shipment: " + err.Error())
+	} else if orderAsBytes != nil {
+		fmt.Println("This shipment already exists: " + Uuid)
+		return shim.Error("This shipment already exists: " + Uuid)
+	}
+
+	// ==== Index the product by GTIN and serial, a serial is unique within its GTIN ====
+	if GTIN != "" {
+		gtinKey, err := stub.CreateCompositeKey("gtin~serial", []string{GTIN, SerialNumber})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		indexAsBytes, err := stub.GetState(gtinKey)
+		if err != nil {
+			return shim.Error("Failed to get GTIN index: " + err.Error())
+		} else if indexAsBytes != nil {
+			return shim.Error("GTIN " + GTIN + " serial " + SerialNumber + " is already registered as " + string(indexAsBytes))
+		}
+		err = stub.PutState(gtinKey, []byte(Uuid))
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	// ==== Create order object and marshal to JSON ====
+	
+	    ObjectType := "product"
+		Product := &Product{ObjectType: ObjectType, Uuid: Uuid, Material: Material, Make: Make, RawMaterialLocation: RawMaterialLocation,
+			ProductStatus: ProductStatus, ShipmentStatus: ShipmentStatus, BatchCode: BatchCode, Holder: Make, CurrentLocation: RawMaterialLocation,
+			ManufactureDate: ManufactureDate, ExpiryDate: ExpiryDate, GTIN: GTIN, SerialNumber: SerialNumber,
+			StabilityBudgetMinutes: StabilityBudgetMinutes}
+		fmt.Println(Product)
+		orderJSONasBytes, err := json.Marshal(Product)
+		fmt.Println(orderJSONasBytes)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		// === Save order to state ===
+		err = stub.PutState(Uuid, orderJSONasBytes)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	
+	fmt.Println("- end registering shimpment")
+	return shim.Success(nil)
+
+}
+
+//search the order details using order uuid
+func searchProduct(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var Uuid, jsonResp string
+	var err error
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting shipment Id to query")
+	}
+
+	Uuid = args[0]
+	valAsbytes, err := stub.GetState(Uuid)
+	if err != nil {
+		jsonResp = "{\"Error\":\"Failed to get state for " + Uuid + "\"}"
+		return shim.Error(jsonResp)
+	} else if valAsbytes == nil {
+		jsonResp = "{\"Error\":\"shipment does not exist: " + Uuid + "\"}"
+		return shim.Error(jsonResp)
+	}
+
+	return shim.Success(valAsbytes)
+}
+
+//change the status of a product with a reason code, optional comment and evidence hash.
+//Only a regulator or QA identity can set a final status or override one, and overriding needs a comment.
+func updateProductStatus(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 3 || len(args) > 5 {
+		return shim.Error("Incorrect number of arguments. Expecting uuid, status, reason code, optional comment and evidence hash")
+	}
+
+	Uuid := args[0]
+	newStatus := strings.ToUpper(args[1])
+	statusReason, err := getStatusReason(args[2:])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("- update Product Status ", Uuid, newStatus, statusReason.ReasonCode)
+
+	err = checkNewStatus(stub, newStatus)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	orderAsBytes, err := stub.GetState(Uuid)
+	if err != nil {
+		return shim.Error("Failed to get product details:" + err.Error())
+	} else if orderAsBytes == nil {
+		return shim.Error("product does not exist")
+	}
+
+	orderToUpdate := Product{}
+	err = json.Unmarshal(orderAsBytes, &orderToUpdate) //unmarshal it aka JSON.parse()
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkStatusOverride(stub, orderToUpdate, newStatus, statusReason)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = recordStatusChange(stub, Uuid, "ProductStatus", orderToUpdate.ProductStatus, newStatus, statusReason)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	orderToUpdate.ProductStatus = newStatus //change the status
+	err = putProduct(stub, orderToUpdate) //rewrite the product
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end updateProductStatus (success)")
+	return shim.Success(nil)
+}
+
+//change where a product is in the shipping process, with the same reason arguments as updateProductStatus
+func updateShipmentStatus(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 3 || len(args) > 5 {
+		return shim.Error("Incorrect number of arguments. Expecting uuid, status, reason code, optional comment and evidence hash")
+	}
+
+	Uuid := args[0]
+	newStatus := args[1]
+	statusReason, err := getStatusReason(args[2:])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("- update Shipment Status ", Uuid, newStatus, statusReason.ReasonCode)
+
+	productToUpdate, err := getProduct(stub, Uuid)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkStatusChange(productToUpdate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = recordStatusChange(stub, Uuid, "ShipmentStatus", productToUpdate.ShipmentStatus, newStatus, statusReason)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	productToUpdate.ShipmentStatus = newStatus
+
+	err = putProduct(stub, productToUpdate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end updateShipmentStatus (success)")
+	return shim.Success(nil)
+}
+
+//hand a product over to a new holder, the optional purpose is SALE (default), RETURN or DESTRUCTION
+func transferProduct(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 && len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 3 or 4")
+	}
+
+	Uuid := args[0]
+	newHolder := args[1]
+	newLocation := args[2]
+	Purpose := "SALE"
+	if len(args) == 4 && args[3] != "" {
+		Purpose = strings.ToUpper(args[3])
+	}
+	fmt.Println("- transfer product ", Uuid, newHolder, newLocation, Purpose)
+
+	productToUpdate, err := getProduct(stub, Uuid)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = requireHolder(stub, productToUpdate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkNotOnReturn(productToUpdate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkTransfer(stub, productToUpdate, Purpose, txTime)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if productToUpdate.Holder != newHolder {
+		err = quarantineOnArrival(stub, &productToUpdate)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	productToUpdate.Holder = newHolder
+	productToUpdate.CurrentLocation = newLocation
+
+	err = putProduct(stub, productToUpdate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end transferProduct (success)")
+	return shim.Success(nil)
+}
+
+//mark every product of a batch as RECALLED and notify the current holders.
+//Only the manufacturer of the batch, or a regulator or QA identity, can recall it
+func recallBatch(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	BatchCode := args[0]
+	Reason := args[1]
+	fmt.Println("- start recallBatch ", BatchCode)
+
+	recallKey, err := stub.CreateCompositeKey("recall", []string{BatchCode})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	recallAsBytes, err := stub.GetState(recallKey)
+	if err != nil {
+		return shim.Error("Failed to get recall: " + err.Error())
+	} else if recallAsBytes != nil {
+		return shim.Error("This batch is already recalled: " + BatchCode)
+	}
+
+	products, err := getProductsByBatch(stub, BatchCode)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if len(products) == 0 {
+		return shim.Error("No products found for batch: " + BatchCode)
+	}
+	err = requireManufacturer(stub, BatchCode, products)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	recall := Recall{ObjectType: "recall", BatchCode: BatchCode, Reason: Reason, RecallDate: txTime.Format(time.RFC3339)}
+	notified := map[string]bool{}
+	for _, product := range products {
+		// tampered or destroyed units keep their status but are still reported
+		if checkStatusChange(product) == nil {
+			err = recordStatusChange(stub, product.Uuid, "ProductStatus", product.ProductStatus, "RECALLED", StatusReason{ReasonCode: "RECALL", Comment: Reason})
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			product.ProductStatus = "RECALLED"
+			err = putProduct(stub, product)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+		recall.Units = append(recall.Units, newRecallUnit(product))
+		if product.Holder != "" && !notified[product.Holder] {
+			notified[product.Holder] = true
+			recall.Holders = append(recall.Holders, product.Holder)
+		}
+	}
+
+	recallJSONasBytes, err := json.Marshal(recall)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(recallKey, recallJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// one event carries every holder, listeners pick out the units they hold
+	err = stub.SetEvent("RecallEvent", recallJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end recallBatch (success)")
+	return shim.Success(recallJSONasBytes)
+}
+
+//the caller must have made every unit of the batch, unless it is a regulator or QA identity
+func requireManufacturer(stub shim.ChaincodeStubInterface, BatchCode string, products []Product) error {
+	Role, err := caller.Role(stub)
+	if err != nil {
+		return err
+	}
+	if Role == "regulator" || Role == "qa" {
+		return nil
+	}
+	mspId, err := cid.GetMSPID(stub)
+	if err != nil {
+		return fmt.Errorf("Failed to get caller MSP: %s", err.Error())
+	}
+	for _, product := range products {
+		if product.Make != mspId {
+			return fmt.Errorf("Only the manufacturer of batch %s, or a regulator or QA identity, can recall it", BatchCode)
+		}
+	}
+	return nil
+}
+
+//report where each unit of a recalled batch currently is
+func recallReport(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting batch code to query")
+	}
+
+	BatchCode := args[0]
+	recallKey, err := stub.CreateCompositeKey("recall", []string{BatchCode})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	recallAsBytes, err := stub.GetState(recallKey)
+	if err != nil {
+		return shim.Error("Failed to get recall: " + err.Error())
+	} else if recallAsBytes == nil {
+		return shim.Error("batch is not recalled: " + BatchCode)
+	}
+
+	recall := Recall{}
+	err = json.Unmarshal(recallAsBytes, &recall)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// the stored units are a snapshot from recall time, refresh them from the products
+	for i, unit := range recall.Units {
+		product, err := getProduct(stub, unit.Uuid)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		recall.Units[i] = newRecallUnit(product)
+	}
+
+	reportAsBytes, err := json.Marshal(recall)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(reportAsBytes)
+}
+
+//the holder of a recalled unit records that it was quarantined or returned.
+//The holder is the caller's MSP, args are uuid and action
+func recordRecallAction(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting uuid and action")
+	}
+
+	Uuid := args[0]
+	Action := strings.ToUpper(args[1])
+	Holder, err := cid.GetMSPID(stub)
+	if err != nil {
+		return shim.Error("Failed to get caller MSP: " + err.Error())
+	}
+	fmt.Println("- record recall action ", Uuid, Holder, Action)
+
+	if Action != "QUARANTINED" && Action != "RETURNED" {
+		return shim.Error("Recall action must be QUARANTINED or RETURNED")
+	}
+
+	productToUpdate, err := getProduct(stub, Uuid)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if productToUpdate.ProductStatus != "RECALLED" {
+		return shim.Error("product is not recalled: " + Uuid)
+	}
+	if productToUpdate.Holder != Holder {
+		return shim.Error("product is not held by " + Holder)
+	}
+
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	productToUpdate.RecallAction = Action
+	productToUpdate.RecallActionDate = txTime.Format(time.RFC3339)
+
+	err = putProduct(stub, productToUpdate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end recordRecallAction (success)")
+	return shim.Success(nil)
+}
+
+//list the products that expire between today and withinDays from today
+func expiringProducts(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting number of days")
+	}
+
+	withinDays, err := strconv.Atoi(args[0])
+	if err != nil || withinDays < 0 {
+		return shim.Error("withinDays must be a non-negative number")
+	}
+
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	from := txTime.Format(dateLayout)
+	to := txTime.AddDate(0, 0, withinDays).Format(dateLayout)
+
+	// YYYY-MM-DD strings sort the same way as the dates they hold
+	queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"product\",\"ExpiryDate\":{\"$gte\":\"%s\",\"$lte\":\"%s\"}}}", from, to)
+	products, err := getProductsForQueryString(stub, queryString)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	productsAsBytes, err := json.Marshal(products)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(productsAsBytes)
+}
+
+//goods that change hands wait in quarantine until the receiver's QA releases them.
+//A QA rejection stands, also when the goods go back on a return
+func quarantineOnArrival(stub shim.ChaincodeStubInterface, product *Product) error {
+	if product.QAStatus == "QUARANTINED" || product.QAStatus == "REJECTED" {
+		return nil
+	}
+	err := recordStatusChange(stub, product.Uuid, "QAStatus", product.QAStatus, "QUARANTINED", StatusReason{ReasonCode: "RECEIVED"})
+	if err != nil {
+		return err
+	}
+	product.QAStatus = "QUARANTINED"
+	return nil
+}
+
+//the status update_product_status and update_container_status set must be one of
+//productStatuses, and only a regulator or QA identity can set a final status
+func checkNewStatus(stub shim.ChaincodeStubInterface, newStatus string) error {
+	if !productStatuses[newStatus] {
+		return fmt.Errorf("Unknown product status: %s", newStatus)
+	}
+	if isFinalStatus(newStatus) {
+		Role, err := caller.Role(stub)
+		if err != nil {
+			return err
+		}
+		if Role != "regulator" && Role != "qa" {
+			return fmt.Errorf("Only a regulator or QA can set a product to %s", newStatus)
+		}
+	}
+	return nil
+}
+
+//a regulator or QA identity can override the final status of a product, with a comment
+//that is recorded along with the override
+func checkStatusOverride(stub shim.ChaincodeStubInterface, product Product, newStatus string, statusReason StatusReason) error {
+	err := checkStatusChange(product)
+	if err == nil {
+		return nil
+	}
+	Role, roleErr := caller.Role(stub)
+	if roleErr != nil {
+		return roleErr
+	}
+	if Role != "regulator" && Role != "qa" {
+		return err
+	}
+	if statusReason.Comment == "" {
+		return fmt.Errorf("A comment is required to override the %s status", product.ProductStatus)
+	}
+	return recordStatusOverride(stub, product, newStatus, statusReason.Comment, Role)
+}
+
+//TAMPERED, RECALLED, DESTROYED, DISPENSED and DECOMMISSIONED are final for ordinary participants
+func checkStatusChange(product Product) error {
+	if isFinalStatus(product.ProductStatus) {
+		return fmt.Errorf("You cannot change status of a %s product: %s", strings.ToLower(product.ProductStatus), product.Uuid)
+	}
+	return nil
+}
+
+func isFinalStatus(status string) bool {
+	switch status {
+	case "TAMPERED", "RECALLED", "DESTROYED", "DISPENSED", "DECOMMISSIONED":
+		return true
+	}
+	return false
+}
+
+//the reason code, comment and evidence hash given with a status change
+type StatusReason struct {
+	ReasonCode      string
+	Comment         string
+	EvidenceHash    string
+}
+
+func getStatusReason(args []string) (StatusReason, error) {
+	statusReason := StatusReason{ReasonCode: strings.ToUpper(args[0])}
+	if len(args) > 1 {
+		statusReason.Comment = strings.TrimSpace(args[1])
+	}
+	if len(args) > 2 {
+		statusReason.EvidenceHash = strings.ToLower(args[2])
+	}
+
+	if !reason.Codes[statusReason.ReasonCode] {
+		return statusReason, fmt.Errorf("Unknown reason code: %s", args[0])
+	}
+	if statusReason.ReasonCode == "OTHER" && statusReason.Comment == "" {
+		return statusReason, fmt.Errorf("Reason code OTHER needs a comment")
+	}
+	if statusReason.EvidenceHash != "" {
+		hash, err := hex.DecodeString(statusReason.EvidenceHash)
+		if err != nil || len(hash) != sha256.Size {
+			return statusReason, fmt.Errorf("Evidence hash must be a hex SHA-256 digest")
+		}
+	}
+	return statusReason, nil
+}
+
+//keep the status change next to the product so GDP reviews can read back every transition
+func recordStatusChange(stub shim.ChaincodeStubInterface, Id string, Field string, fromStatus string, toStatus string, statusReason StatusReason) error {
+	ChangedBy, err := caller.Id(stub)
+	if err != nil {
+		return err
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return err
+	}
+
+	change := StatusChange{ObjectType: "statuschange", Id: Id, Field: Field, FromStatus: fromStatus, ToStatus: toStatus,
+		ReasonCode: statusReason.ReasonCode, Comment: statusReason.Comment, EvidenceHash: statusReason.EvidenceHash,
+		ChangedBy: ChangedBy, ChangeDate: txTime.Format(time.RFC3339)}
+	changeKey, err := stub.CreateCompositeKey("statuschange", []string{Id, stub.GetTxID(), Field})
+	if err != nil {
+		return err
+	}
+	changeJSONasBytes, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(changeKey, changeJSONasBytes)
+}
+
+//every recorded status change of a product
+func statusChanges(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting product uuid")
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("statuschange", []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	changes := []StatusChange{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		change := StatusChange{}
+		err = json.Unmarshal(queryResponse.Value, &change)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		changes = append(changes, change)
+	}
+
+	changesAsBytes, err := json.Marshal(changes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(changesAsBytes)
+}
+
+func recordStatusOverride(stub shim.ChaincodeStubInterface, product Product, newStatus string, Reason string, Role string) error {
+	OverriddenBy, err := caller.Id(stub)
+	if err != nil {
+		return err
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return err
+	}
+
+	override := StatusOverride{ObjectType: "override", Uuid: product.Uuid, FromStatus: product.ProductStatus, ToStatus: newStatus,
+		Reason: Reason, OverriddenBy: OverriddenBy, Role: Role, OverrideDate: txTime.Format(time.RFC3339)}
+	overrideKey, err := stub.CreateCompositeKey("override", []string{product.Uuid, stub.GetTxID()})
+	if err != nil {
+		return err
+	}
+	overrideJSONasBytes, err := json.Marshal(override)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(overrideKey, overrideJSONasBytes)
+}
+
+//every override of a final status on a product
+func statusOverrides(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting product uuid")
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("override", []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	overrides := []StatusOverride{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		override := StatusOverride{}
+		err = json.Unmarshal(queryResponse.Value, &override)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		overrides = append(overrides, override)
+	}
+
+	overridesAsBytes, err := json.Marshal(overrides)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(overridesAsBytes)
+}
+
+//only the organisation holding a product can hand it on
+func requireHolder(stub shim.ChaincodeStubInterface, product Product) error {
+	mspId, err := cid.GetMSPID(stub)
+	if err != nil {
+		return fmt.Errorf("Failed to get caller MSP: %s", err.Error())
+	}
+	if mspId != product.Holder {
+		return fmt.Errorf("Only the holder of %s, %s, can transfer it", product.Uuid, product.Holder)
+	}
+	return nil
+}
+
+//destroyed products stay where they are, quarantined goods are not sold on,
+//and recalled, suspect or expired products only move to be returned or destroyed
+func checkTransfer(stub shim.ChaincodeStubInterface, product Product, Purpose string, txTime time.Time) error {
+	if Purpose != "SALE" && Purpose != "RETURN" && Purpose != "DESTRUCTION" {
+		return fmt.Errorf("Transfer purpose must be SALE, RETURN or DESTRUCTION")
+	}
+	if product.ProductStatus == "DESTROYED" {
+		return fmt.Errorf("You cannot transfer a destroyed product: %s", product.Uuid)
+	}
+	if product.DispensedDate != "" {
+		return fmt.Errorf("You cannot transfer a product dispensed at %s: %s", product.DispensedAt, product.Uuid)
+	}
+	if product.StabilityExhausted && Purpose == "SALE" {
+		return fmt.Errorf("product %s has used up its time outside 2-8°C, it can only be transferred for RETURN or DESTRUCTION", product.Uuid)
+	}
+	if product.ProductStatus == "RECALLED" && Purpose == "SALE" {
+		return fmt.Errorf("product %s is recalled, it can only be transferred for RETURN or DESTRUCTION", product.Uuid)
+	}
+	if product.ProductStatus == "SUSPECT" && Purpose == "SALE" {
+		return fmt.Errorf("product %s is suspected counterfeit, it can only be transferred for RETURN or DESTRUCTION", product.Uuid)
+	}
+	if (product.QAStatus == "QUARANTINED" || product.QAStatus == "REJECTED") && Purpose == "SALE" {
+		return fmt.Errorf("product %s is %s, it needs QA release before it can be sold on", product.Uuid, product.QAStatus)
+	}
+	if product.BatchCode != "" && Purpose == "SALE" {
+		batch, found, err := findBatch(stub, product.BatchCode)
+		if err != nil {
+			return err
+		}
+		if found && (batch.QAStatus == "QUARANTINED" || batch.QAStatus == "REJECTED") {
+			return fmt.Errorf("batch %s is %s, its products cannot be sold on", product.BatchCode, batch.QAStatus)
+		}
+	}
+	expired, err := isExpired(product, txTime)
+	if err != nil {
+		return err
+	}
+	if expired && Purpose == "SALE" {
+		return fmt.Errorf("product %s expired on %s, it can only be transferred for RETURN or DESTRUCTION", product.Uuid, product.ExpiryDate)
+	}
+	return nil
+}
+
+//a unit on an open return moves with the return (ship_return, receive_return), not by plain
+//transfers, so the RMA and the custody record stay in step
+func checkNotOnReturn(product Product) error {
+	if product.RmaId != "" {
+		return fmt.Errorf("product %s is on return %s, it moves with the return", product.Uuid, product.RmaId)
+	}
+	return nil
+}
+
+//a product can be used up to and including its expiry date
+func isExpired(product Product, txTime time.Time) (bool, error) {
+	if product.ExpiryDate == "" {
+		return false, nil
+	}
+	expires, err := time.Parse(dateLayout, product.ExpiryDate)
+	if err != nil {
+		return false, err
+	}
+	return !txTime.Before(expires.AddDate(0, 0, 1)), nil
+}
+
+//search a product by the GTIN and serial number on its pack
+func searchProductByGTIN(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting GTIN and serial number")
+	}
+
+	GTIN := args[0]
+	SerialNumber := args[1]
+	gtinKey, err := stub.CreateCompositeKey("gtin~serial", []string{GTIN, SerialNumber})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	uuidAsBytes, err := stub.GetState(gtinKey)
+	if err != nil {
+		return shim.Error("Failed to get GTIN index: " + err.Error())
+	} else if uuidAsBytes == nil {
+		return shim.Error("no product with GTIN " + GTIN + " serial " + SerialNumber)
+	}
+
+	return searchProduct(stub, []string{string(uuidAsBytes)})
+}
+
+//parse a scanned GS1 element string so clients can check it before they submit it
+func parseGS1ElementString(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting GS1 element string")
+	}
+
+	gs1, err := parseGS1(args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	gs1AsBytes, err := json.Marshal(gs1)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(gs1AsBytes)
+}
+
+//record a scan of a product and flag it as SUSPECT when the scan cannot be genuine.
+//The scanner is the caller's MSP, args are uuid and location
+func verifyScan(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting uuid and location")
+	}
+
+	Uuid := args[0]
+	Location := args[1]
+	ScannedBy, err := cid.GetMSPID(stub)
+	if err != nil {
+		return shim.Error("Failed to get caller MSP: " + err.Error())
+	}
+	fmt.Println("- start verifyScan ", Uuid, ScannedBy, Location)
+
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	scan := Scan{ObjectType: "scan", Uuid: Uuid, ScannedBy: ScannedBy, Location: Location,
+		ScanDate: txTime.Format(time.RFC3339), Alerts: []string{}}
+
+	productAsBytes, err := stub.GetState(Uuid)
+	if err != nil {
+		return shim.Error("Failed to get product details: " + err.Error())
+	}
+	if productAsBytes == nil {
+		scan.Alerts = append(scan.Alerts, "UNKNOWN_SERIAL")
+	} else {
+		product := Product{}
+		err = json.Unmarshal(productAsBytes, &product)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		switch product.ProductStatus {
+		case "DISPENSED", "DECOMMISSIONED", "DESTROYED":
+			scan.Alerts = append(scan.Alerts, "SCAN_AFTER_"+product.ProductStatus)
+		}
+		if product.Holder != "" && product.Holder != ScannedBy {
+			scan.Alerts = append(scan.Alerts, "HELD_BY_"+product.Holder)
+		}
+		if product.LastScanDate != "" && product.LastScanLocation != Location {
+			lastScan, err := time.Parse(time.RFC3339, product.LastScanDate)
+			if err == nil && txTime.Sub(lastScan) < minRelocationTime {
+				scan.Alerts = append(scan.Alerts, "SCANNED_AT_"+product.LastScanLocation+"_AT_"+product.LastScanDate)
+			}
+		}
+
+		// decommissioned records are not touched, the alert and the scan record still go out
+		if product.DecommissionDate == "" {
+			product.LastScanLocation = Location
+			product.LastScanDate = scan.ScanDate
+			// terminal statuses and dispensed packs are kept, the alert and the scan record still go out
+			if len(scan.Alerts) > 0 && checkStatusChange(product) == nil && product.DispensedDate == "" {
+				err = recordStatusChange(stub, Uuid, "ProductStatus", product.ProductStatus, "SUSPECT",
+					StatusReason{ReasonCode: "COUNTERFEIT_SUSPECTED", Comment: strings.Join(scan.Alerts, ", ")})
+				if err != nil {
+					return shim.Error(err.Error())
+				}
+				product.ProductStatus = "SUSPECT"
+			}
+			err = putProduct(stub, product)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+	}
+
+	scanKey, err := stub.CreateCompositeKey("scan", []string{Uuid, stub.GetTxID()})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	scanJSONasBytes, err := json.Marshal(scan)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(scanKey, scanJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if len(scan.Alerts) > 0 {
+		err = stub.SetEvent("CounterfeitAlertEvent", scanJSONasBytes)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	fmt.Println("- end verifyScan (success)")
+	return shim.Success(scanJSONasBytes)
+}
+
+//every scan recorded against a product
+func scanHistory(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting product uuid")
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("scan", []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	scans := []Scan{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		scan := Scan{}
+		err = json.Unmarshal(queryResponse.Value, &scan)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		scans = append(scans, scan)
+	}
+
+	scansAsBytes, err := json.Marshal(scans)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(scansAsBytes)
+}
+
+//verify a returned pack by GTIN, serial, lot and expiry before it is resold.
+//The request, its result and the caller are kept, so this has to be submitted as a transaction.
+func verifyProductIdentifier(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting GTIN, serial, lot and expiry")
+	}
+
+	GTIN := args[0]
+	SerialNumber := args[1]
+	Lot := args[2]
+	Expiry := args[3]
+	RequestedBy, err := caller.Id(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("- start verifyProductIdentifier ", GTIN, SerialNumber, Lot, Expiry, RequestedBy)
+
+	// scanners hand over the GS1 YYMMDD form, the ledger keeps YYYY-MM-DD
+	if len(Expiry) == 6 {
+		gs1Expiry, err := parseGS1Date(Expiry)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		Expiry = gs1Expiry
+	}
+
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	verification := Verification{ObjectType: "verification", GTIN: GTIN, SerialNumber: SerialNumber, Lot: Lot, Expiry: Expiry,
+		RequestedBy: RequestedBy, VerificationDate: txTime.Format(time.RFC3339)}
+
+	uuidAsBytes := []byte(nil)
+	if gs1.IsValidGTIN(GTIN) {
+		gtinKey, err := stub.CreateCompositeKey("gtin~serial", []string{GTIN, SerialNumber})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		uuidAsBytes, err = stub.GetState(gtinKey)
+		if err != nil {
+			return shim.Error("Failed to get GTIN index: " + err.Error())
+		}
+	}
+
+	if uuidAsBytes == nil {
+		verification.Result = "UNKNOWN"
+		verification.Reason = "no product with this GTIN and serial number"
+	} else {
+		product, err := getProduct(stub, string(uuidAsBytes))
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		verification.Uuid = product.Uuid
+		expired, err := isExpired(product, txTime)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		switch {
+		case product.BatchCode != Lot:
+			verification.Result = "UNKNOWN"
+			verification.Reason = "lot does not match the manufacturer's record"
+		case product.ExpiryDate != Expiry:
+			verification.Result = "UNKNOWN"
+			verification.Reason = "expiry does not match the manufacturer's record"
+		case product.ProductStatus == "RECALLED":
+			verification.Result = "RECALLED"
+		case product.ProductStatus == "DISPENSED" || product.ProductStatus == "DECOMMISSIONED" || product.ProductStatus == "DESTROYED":
+			verification.Result = "ALREADY_DISPENSED"
+			verification.Reason = "product is " + product.ProductStatus
+		case product.ProductStatus == "SUSPECT" || product.ProductStatus == "TAMPERED":
+			verification.Result = "SUSPECT"
+			verification.Reason = "product is " + product.ProductStatus
+		case expired:
+			verification.Result = "EXPIRED"
+		default:
+			verification.Result = "GENUINE"
+		}
+	}
+
+	verificationKey, err := stub.CreateCompositeKey("verification", []string{GTIN, SerialNumber, stub.GetTxID()})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	verificationJSONasBytes, err := json.Marshal(verification)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(verificationKey, verificationJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end verifyProductIdentifier ", verification.Result)
+	return shim.Success(verificationJSONasBytes)
+}
+
+//every verification requested for a GTIN and serial number
+func verificationHistory(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting GTIN and serial number")
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("verification", []string{args[0], args[1]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	verifications := []Verification{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		verification := Verification{}
+		err = json.Unmarshal(queryResponse.Value, &verification)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		verifications = append(verifications, verification)
+	}
+
+	verificationsAsBytes, err := json.Marshal(verifications)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(verificationsAsBytes)
+}
+
+func newRecallUnit(product Product) RecallUnit {
+	return RecallUnit{Uuid: product.Uuid, Holder: product.Holder, CurrentLocation: product.CurrentLocation,
+		ShipmentStatus: product.ShipmentStatus, RecallAction: product.RecallAction}
+}
+
+func getProduct(stub shim.ChaincodeStubInterface, Uuid string) (Product, error) {
+	product := Product{}
+	productAsBytes, err := stub.GetState(Uuid)
+	if err != nil {
+		return product, fmt.Errorf("Failed to get product details: %s", err.Error())
+	} else if productAsBytes == nil {
+		return product, fmt.Errorf("product does not exist: %s", Uuid)
+	}
+	err = json.Unmarshal(productAsBytes, &product)
+	return product, err
+}
+
+//every change to a product goes through here, so a decommissioned record stays as it was retired
+func putProduct(stub shim.ChaincodeStubInterface, product Product) error {
+	if product.DecommissionDate != "" {
+		return fmt.Errorf("product %s was decommissioned as %s and cannot be changed", product.Uuid, product.DecommissionReason)
+	}
+	productJSONasBytes, err := json.Marshal(product)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(product.Uuid, productJSONasBytes)
+}
+
+func getProductsByBatch(stub shim.ChaincodeStubInterface, BatchCode string) ([]Product, error) {
+	// marshalled rather than formatted, so a batch code cannot add terms to the selector
+	queryString, err := json.Marshal(map[string]interface{}{"selector": map[string]string{"docType": "product", "BatchCode": BatchCode}})
+	if err != nil {
+		return nil, err
+	}
+	return getProductsForQueryString(stub, string(queryString))
+}
+
+func getProductsForQueryString(stub shim.ChaincodeStubInterface, queryString string) ([]Product, error) {
+	fmt.Printf("- getProductsForQueryString queryString:\n%s\n", queryString)
+
+	resultsIterator, err := stub.GetQueryResult(queryString)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	products := []Product{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		product := Product{}
+		err = json.Unmarshal(queryResponse.Value, &product)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+	return products, nil
+}
+
+//the transaction timestamp is the same on every endorser, unlike time.Now()
+func getTxTime(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos)).UTC(), nil
+}
+
+// ==== GS1 identifiers ====
+
+//fixed lengths of the supported application identifiers, 0 means variable length up to 20
+var gs1AILengths = map[string]int{
+	"00": 18,
+	"01": 14,
+	"10": 0,
+	"17": 6,
+	"21": 0,
+}
+
+const gs1GroupSeparator = "\x1d" //FNC1 as transmitted by the scanner
+
+//parse either the human readable form "(01)...(21)..." or the raw form read from a
+//DataMatrix, where variable length fields are terminated by a group separator
+func parseGS1(elementString string) (GS1Data, error) {
+	data := GS1Data{}
+	fields := map[string]string{}
+
+	elementString = strings.TrimPrefix(elementString, "]d2") //symbology identifier
+	elementString = strings.TrimPrefix(elementString, gs1GroupSeparator)
+	if elementString == "" {
+		return data, fmt.Errorf("empty GS1 element string")
+	}
+
+	if strings.HasPrefix(elementString, "(") {
+		for _, part := range strings.Split(elementString[1:], "(") {
+			end := strings.Index(part, ")")
+			if end < 0 {
+				return data, fmt.Errorf("malformed GS1 element string: %s", elementString)
+			}
+			ai := part[:end]
+			if _, ok := gs1AILengths[ai]; !ok {
+				return data, fmt.Errorf("unsupported GS1 application identifier (%s)", ai)
+			}
+			fields[ai] = part[end+1:]
+		}
+	} else {
+		rest := elementString
+		for rest != "" {
+			if len(rest) < 2 {
+				return data, fmt.Errorf("malformed GS1 element string: %s", elementString)
+			}
+			ai := rest[:2]
+			length, ok := gs1AILengths[ai]
+			if !ok {
+				return data, fmt.Errorf("unsupported GS1 application identifier (%s)", ai)
+			}
+			rest = rest[2:]
+			if length > 0 {
+				if len(rest) < length {
+					return data, fmt.Errorf("GS1 (%s) must be %d characters", ai, length)
+				}
+				fields[ai] = rest[:length]
+				rest = rest[length:]
+			} else if end := strings.Index(rest, gs1GroupSeparator); end >= 0 {
+				fields[ai] = rest[:end]
+				rest = rest[end+1:]
+			} else {
+				fields[ai] = rest
+				rest = ""
+			}
+			rest = strings.TrimPrefix(rest, gs1GroupSeparator)
+		}
+	}
+
+	for ai, value := range fields {
+		length := gs1AILengths[ai]
+		if length > 0 && len(value) != length {
+			return data, fmt.Errorf("GS1 (%s) must be %d characters", ai, length)
+		} else if length == 0 && (value == "" || len(value) > 20) {
+			return data, fmt.Errorf("GS1 (%s) must be 1 to 20 characters", ai)
+		}
+	}
+
+	if sscc, ok := fields["00"]; ok {
+		if !gs1.IsValidSSCC(sscc) {
+			return data, fmt.Errorf("invalid SSCC check digit: %s", sscc)
+		}
+		data.SSCC = sscc
+	}
+	if gtin, ok := fields["01"]; ok {
+		if !gs1.IsValidGTIN(gtin) {
+			return data, fmt.Errorf("invalid GTIN check digit: %s", gtin)
+		}
+		data.GTIN = gtin
+	}
+	if expiry, ok := fields["17"]; ok {
+		date, err := parseGS1Date(expiry)
+		if err != nil {
+			return data, err
+		}
+		data.Expiry = date
+	}
+	data.Lot = fields["10"]
+	data.Serial = fields["21"]
+	return data, nil
+}
+
+//GS1 dates are YYMMDD, a day of 00 means the last day of the month
+func parseGS1Date(value string) (string, error) {
+	dayValue := value
+	lastDayOfMonth := len(value) == 6 && strings.HasSuffix(value, "00")
+	if lastDayOfMonth {
+		dayValue = value[:4] + "01"
+	}
+	date, err := time.Parse("060102", dayValue)
+	if err != nil {
+		return "", fmt.Errorf("invalid GS1 date: %s", value)
+	}
+	if lastDayOfMonth {
+		date = date.AddDate(0, 1, -1)
+	}
+	return date.Format(dateLayout), nil
+}
+
+// ==== Packaging hierarchy ====
+
+//a case or pallet identified by its SSCC, holding products and other containers
+type Container struct {
+	ObjectType      string   `json:"docType"`
+	ContainerId     string   `json:"ContainerId"`
+	ParentId        string   `json:"ParentId"`
+	Products        []string `json:"Products"`
+	Containers      []string `json:"Containers"`
+}
+
+//what a container held at a point in time, nested containers included
+type ContainerContents struct {
+	ContainerId     string              `json:"ContainerId"`
+	Products        []string            `json:"Products"`
+	Containers      []ContainerContents `json:"Containers"`
+}
+
+//pack products and containers into a container, creating it on first use
+func aggregate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 2 {
+		return shim.Error("Incorrect number of arguments. Expecting container id and at least one product or container")
+	}
+
+	ContainerId := args[0]
+	fmt.Println("- start aggregate ", ContainerId, args[1:])
+
+	container, found, err := findContainer(stub, ContainerId)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if !found {
+		if !gs1.IsValidSSCC(ContainerId) {
+			return shim.Error("container id must be a valid SSCC: " + ContainerId)
+		}
+		container = Container{ObjectType: "container", ContainerId: ContainerId, Products: []string{}, Containers: []string{}}
+	}
+
+	// state written in this transaction cannot be read back, so catch repeats here
+	packed := map[string]bool{}
+	for _, childId := range args[1:] {
+		if packed[childId] {
+			return shim.Error(childId + " is listed more than once")
+		}
+		packed[childId] = true
+
+		child, isContainer, err := findContainer(stub, childId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if isContainer {
+			if child.ParentId != "" {
+				return shim.Error("container " + childId + " is already packed in " + child.ParentId)
+			}
+			// walk up from the target so a pallet can never end up inside itself
+			for ancestorId := ContainerId; ancestorId != ""; {
+				if ancestorId == childId {
+					return shim.Error("container " + childId + " cannot be packed inside itself")
+				}
+				ancestor, err := getContainer(stub, ancestorId)
+				if err != nil {
+					break
+				}
+				ancestorId = ancestor.ParentId
+			}
+			child.ParentId = ContainerId
+			err = putContainer(stub, child)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			container.Containers = append(container.Containers, childId)
+			continue
+		}
+
+		product, err := getProduct(stub, childId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if product.ContainerId != "" {
+			return shim.Error("product " + childId + " is already packed in " + product.ContainerId)
+		}
+		product.ContainerId = ContainerId
+		err = putProduct(stub, product)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		container.Products = append(container.Products, childId)
+	}
+
+	err = putContainer(stub, container)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end aggregate (success)")
+	return shim.Success(nil)
+}
+
+//unpack the given products and containers, or everything when none are given
+func disaggregate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 1 {
+		return shim.Error("Incorrect number of arguments. Expecting container id")
+	}
+
+	ContainerId := args[0]
+	fmt.Println("- start disaggregate ", ContainerId, args[1:])
+
+	container, err := getContainer(stub, ContainerId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	remove := map[string]bool{}
+	for _, childId := range args[1:] {
+		remove[childId] = true
+	}
+	removeAll := len(remove) == 0
+
+	products := []string{}
+	for _, Uuid := range container.Products {
+		if !removeAll && !remove[Uuid] {
+			products = append(products, Uuid)
+			continue
+		}
+		delete(remove, Uuid)
+		product, err := getProduct(stub, Uuid)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		product.ContainerId = ""
+		err = putProduct(stub, product)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	containers := []string{}
+	for _, childId := range container.Containers {
+		if !removeAll && !remove[childId] {
+			containers = append(containers, childId)
+			continue
+		}
+		delete(remove, childId)
+		child, err := getContainer(stub, childId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		child.ParentId = ""
+		err = putContainer(stub, child)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	for _, childId := range args[1:] {
+		if remove[childId] {
+			return shim.Error(childId + " is not packed in container " + ContainerId)
+		}
+	}
+
+	container.Products = products
+	container.Containers = containers
+	err = putContainer(stub, container)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end disaggregate (success)")
+	return shim.Success(nil)
+}
+
+//set the status of every product packed in a container, at any depth, checked as update_product_status checks it
+func updateContainerStatus(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 3 || len(args) > 5 {
+		return shim.Error("Incorrect number of arguments. Expecting container id, status, reason code, optional comment and evidence hash")
+	}
+
+	ContainerId := args[0]
+	newStatus := strings.ToUpper(args[1])
+	statusReason, err := getStatusReason(args[2:])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("- update container status ", ContainerId, newStatus, statusReason.ReasonCode)
+
+	err = checkNewStatus(stub, newStatus)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	uuids, err := getPackedProducts(stub, ContainerId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check every unit first so the pallet is updated all or nothing
+	products := []Product{}
+	for _, Uuid := range uuids {
+		product, err := getProduct(stub, Uuid)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = checkStatusOverride(stub, product, newStatus, statusReason)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		products = append(products, product)
+	}
+	for _, product := range products {
+		err = recordStatusChange(stub, product.Uuid, "ProductStatus", product.ProductStatus, newStatus, statusReason)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		product.ProductStatus = newStatus
+		err = putProduct(stub, product)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	fmt.Println("- end updateContainerStatus (success)")
+	return shim.Success(nil)
+}
+
+//hand a container and everything packed in it over to a new holder
+func transferContainer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 && len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 3 or 4")
+	}
+
+	ContainerId := args[0]
+	newHolder := args[1]
+	newLocation := args[2]
+	Purpose := "SALE"
+	if len(args) == 4 && args[3] != "" {
+		Purpose = strings.ToUpper(args[3])
+	}
+	fmt.Println("- transfer container ", ContainerId, newHolder, newLocation, Purpose)
+
+	uuids, err := getPackedProducts(stub, ContainerId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	products := []Product{}
+	for _, Uuid := range uuids {
+		product, err := getProduct(stub, Uuid)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = requireHolder(stub, product)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = checkNotOnReturn(product)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = checkTransfer(stub, product, Purpose, txTime)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		products = append(products, product)
+	}
+	for _, product := range products {
+		if product.Holder != newHolder {
+			err = quarantineOnArrival(stub, &product)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+		product.Holder = newHolder
+		product.CurrentLocation = newLocation
+		err = putProduct(stub, product)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	fmt.Println("- end transferContainer (success)")
+	return shim.Success(nil)
+}
+
+//list the containers a product or container is packed in, innermost first.
+//An optional RFC3339 time answers the question for that point in history.
+func containerOf(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 && len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting id and optional time")
+	}
+
+	Id := args[0]
+	asOf, err := getAsOf(stub, args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	parentId := ""
+	containerKey, err := stub.CreateCompositeKey("container", []string{Id})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	containerAsBytes, err := getStateAsOf(stub, containerKey, asOf)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if containerAsBytes != nil {
+		container := Container{}
+		err = json.Unmarshal(containerAsBytes, &container)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		parentId = container.ParentId
+	} else {
+		productAsBytes, err := getStateAsOf(stub, Id, asOf)
+		if err != nil {
+			return shim.Error(err.Error())
+		} else if productAsBytes == nil {
+			return shim.Error("no product or container " + Id + " at " + asOf.Format(time.RFC3339))
+		}
+		product := Product{}
+		err = json.Unmarshal(productAsBytes, &product)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		parentId = product.ContainerId
+	}
+
+	parents := []string{}
+	for parentId != "" {
+		parents = append(parents, parentId)
+		containerKey, err := stub.CreateCompositeKey("container", []string{parentId})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		containerAsBytes, err := getStateAsOf(stub, containerKey, asOf)
+		if err != nil {
+			return shim.Error(err.Error())
+		} else if containerAsBytes == nil {
+			break
+		}
+		container := Container{}
+		err = json.Unmarshal(containerAsBytes, &container)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		parentId = container.ParentId
+	}
+
+	parentsAsBytes, err := json.Marshal(parents)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(parentsAsBytes)
+}
+
+//list what a container holds, with an optional RFC3339 time to look back in history
+func containerContents(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 && len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting container id and optional time")
+	}
+
+	asOf, err := getAsOf(stub, args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	contents, err := getContainerContentsAsOf(stub, args[0], asOf)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	contentsAsBytes, err := json.Marshal(contents)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(contentsAsBytes)
+}
+
+func getContainerContentsAsOf(stub shim.ChaincodeStubInterface, ContainerId string, asOf time.Time) (ContainerContents, error) {
+	contents := ContainerContents{ContainerId: ContainerId, Products: []string{}, Containers: []ContainerContents{}}
+
+	containerKey, err := stub.CreateCompositeKey("container", []string{ContainerId})
+	if err != nil {
+		return contents, err
+	}
+	containerAsBytes, err := getStateAsOf(stub, containerKey, asOf)
+	if err != nil {
+		return contents, err
+	} else if containerAsBytes == nil {
+		return contents, fmt.Errorf("container %s does not exist at %s", ContainerId, asOf.Format(time.RFC3339))
+	}
+	container := Container{}
+	err = json.Unmarshal(containerAsBytes, &container)
+	if err != nil {
+		return contents, err
+	}
+
+	contents.Products = append(contents.Products, container.Products...)
+	for _, childId := range container.Containers {
+		child, err := getContainerContentsAsOf(stub, childId, asOf)
+		if err != nil {
+			return contents, err
+		}
+		contents.Containers = append(contents.Containers, child)
+	}
+	return contents, nil
+}
+
+//all products packed in a container, following nested containers
+func getPackedProducts(stub shim.ChaincodeStubInterface, ContainerId string) ([]string, error) {
+	container, err := getContainer(stub, ContainerId)
+	if err != nil {
+		return nil, err
+	}
+	uuids := append([]string{}, container.Products...)
+	for _, childId := range container.Containers {
+		childUuids, err := getPackedProducts(stub, childId)
+		if err != nil {
+			return nil, err
+		}
+		uuids = append(uuids, childUuids...)
+	}
+	return uuids, nil
+}
+
+func getContainer(stub shim.ChaincodeStubInterface, ContainerId string) (Container, error) {
+	container, found, err := findContainer(stub, ContainerId)
+	if err == nil && !found {
+		err = fmt.Errorf("container does not exist: %s", ContainerId)
+	}
+	return container, err
+}
+
+//like getContainer, but a missing container is not an error
+func findContainer(stub shim.ChaincodeStubInterface, ContainerId string) (Container, bool, error) {
+	container := Container{}
+	containerKey, err := stub.CreateCompositeKey("container", []string{ContainerId})
+	if err != nil {
+		return container, false, err
+	}
+	containerAsBytes, err := stub.GetState(containerKey)
+	if err != nil {
+		return container, false, fmt.Errorf("Failed to get container: %s", err.Error())
+	} else if containerAsBytes == nil {
+		return container, false, nil
+	}
+	err = json.Unmarshal(containerAsBytes, &container)
+	return container, err == nil, err
+}
+
+func putContainer(stub shim.ChaincodeStubInterface, container Container) error {
+	containerKey, err := stub.CreateCompositeKey("container", []string{container.ContainerId})
+	if err != nil {
+		return err
+	}
+	containerJSONasBytes, err := json.Marshal(container)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(containerKey, containerJSONasBytes)
+}
+
+//the optional second argument is an RFC3339 time, it defaults to the transaction time
+func getAsOf(stub shim.ChaincodeStubInterface, args []string) (time.Time, error) {
+	if len(args) == 2 && args[1] != "" {
+		asOf, err := time.Parse(time.RFC3339, args[1])
+		if err != nil {
+			return asOf, fmt.Errorf("time must be RFC3339: %s", err.Error())
+		}
+		return asOf, nil
+	}
+	return getTxTime(stub)
+}
+
+//the value a key had at the given time, nil if it did not exist yet or was deleted
+func getStateAsOf(stub shim.ChaincodeStubInterface, key string, asOf time.Time) ([]byte, error) {
+	resultsIterator, err := stub.GetHistoryForKey(key)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	// do not rely on the order the history comes back in
+	var value []byte
+	var latest time.Time
+	found := false
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		modified := time.Unix(response.Timestamp.Seconds, int64(response.Timestamp.Nanos))
+		if modified.After(asOf) || (found && modified.Before(latest)) {
+			continue
+		}
+		found = true
+		latest = modified
+		if response.IsDelete {
+			value = nil
+		} else {
+			value = response.Value
+		}
+	}
+	return value, nil
+}
+
+// ==== Quarantine and QA release ====
+
+//put a product in quarantine, QA only
+func quarantineProduct(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting uuid and comment")
+	}
+
+	Uuid := args[0]
+	Comment := strings.TrimSpace(args[1])
+	fmt.Println("- start quarantineProduct ", Uuid)
+
+	err := requireQARole(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	product, err := getProduct(stub, Uuid)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if product.QAStatus == "QUARANTINED" {
+		return shim.Error("product is already quarantined: " + Uuid)
+	}
+
+	err = recordStatusChange(stub, Uuid, "QAStatus", product.QAStatus, "QUARANTINED", StatusReason{ReasonCode: "QA_QUARANTINE", Comment: Comment})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	product.QAStatus = "QUARANTINED"
+	err = putProduct(stub, product)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end quarantineProduct (success)")
+	return shim.Success(nil)
+}
+
+//release or reject a quarantined product, or every product packed in a container, QA only
+func qaDecision(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 && len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting product or container id, RELEASED or REJECTED and optional comment")
+	}
+
+	Id := args[0]
+	Decision := strings.ToUpper(args[1])
+	Comment := ""
+	if len(args) == 3 {
+		Comment = strings.TrimSpace(args[2])
+	}
+	fmt.Println("- start qaDecision ", Id, Decision)
+
+	statusReason, err := getQADecisionReason(Decision, Comment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = requireQARole(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	uuids := []string{Id}
+	_, isContainer, err := findContainer(stub, Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if isContainer {
+		uuids, err = getPackedProducts(stub, Id)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	products := []Product{}
+	for _, Uuid := range uuids {
+		product, err := getProduct(stub, Uuid)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if product.QAStatus != "QUARANTINED" {
+			return shim.Error("product is not quarantined: " + Uuid)
+		}
+		products = append(products, product)
+	}
+	for _, product := range products {
+		err = recordStatusChange(stub, product.Uuid, "QAStatus", product.QAStatus, Decision, statusReason)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		product.QAStatus = Decision
+		err = putProduct(stub, product)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	fmt.Println("- end qaDecision (success)")
+	return shim.Success(nil)
+}
+
+//stop every product of a batch from being sold on, QA only
+func quarantineBatch(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting batch code and comment")
+	}
+
+	BatchCode := args[0]
+	Comment := strings.TrimSpace(args[1])
+	fmt.Println("- start quarantineBatch ", BatchCode)
+
+	err := requireQARole(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	batch, _, err := findBatch(stub, BatchCode)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if batch.QAStatus == "QUARANTINED" {
+		return shim.Error("batch is already quarantined: " + BatchCode)
+	}
+
+	err = recordStatusChange(stub, batchStatusId(BatchCode), "QAStatus", batch.QAStatus, "QUARANTINED", StatusReason{ReasonCode: "QA_QUARANTINE", Comment: Comment})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	batch.QAStatus = "QUARANTINED"
+	err = putBatch(stub, batch)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end quarantineBatch (success)")
+	return shim.Success(nil)
+}
+
+//release or reject a quarantined batch, QA only
+func qaBatchDecision(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 && len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting batch code, RELEASED or REJECTED and optional comment")
+	}
+
+	BatchCode := args[0]
+	Decision := strings.ToUpper(args[1])
+	Comment := ""
+	if len(args) == 3 {
+		Comment = strings.TrimSpace(args[2])
+	}
+	fmt.Println("- start qaBatchDecision ", BatchCode, Decision)
+
+	statusReason, err := getQADecisionReason(Decision, Comment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = requireQARole(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	batch, _, err := findBatch(stub, BatchCode)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if batch.QAStatus != "QUARANTINED" {
+		return shim.Error("batch is not quarantined: " + BatchCode)
+	}
+
+	err = recordStatusChange(stub, batchStatusId(BatchCode), "QAStatus", batch.QAStatus, Decision, statusReason)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	batch.QAStatus = Decision
+	err = putBatch(stub, batch)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end qaBatchDecision (success)")
+	return shim.Success(nil)
+}
+
+//attach a certificate of analysis to a batch by the hash of the document
+func attachCertificate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting batch code, document hash and document name")
+	}
+
+	BatchCode := args[0]
+	Hash := strings.ToLower(args[1])
+	Name := args[2]
+	fmt.Println("- start attachCertificate ", BatchCode, Hash)
+
+	hash, err := hex.DecodeString(Hash)
+	if err != nil || len(hash) != sha256.Size {
+		return shim.Error("Document hash must be a hex SHA-256 digest")
+	}
+	batch, _, err := findBatch(stub, BatchCode)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, certificate := range batch.Certificates {
+		if certificate.Hash == Hash {
+			return shim.Error("certificate is already attached: " + Hash)
+		}
+	}
+
+	AttachedBy, err := caller.Id(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	batch.Certificates = append(batch.Certificates, Document{Hash: Hash, Name: Name, AttachedBy: AttachedBy, AttachedDate: txTime.Format(time.RFC3339)})
+	err = putBatch(stub, batch)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end attachCertificate (success)")
+	return shim.Success(nil)
+}
+
+//the QA state and certificates of a batch
+func searchBatch(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting batch code to query")
+	}
+
+	batch, _, err := findBatch(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	batchAsBytes, err := json.Marshal(batch)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(batchAsBytes)
+}
+
+func getQADecisionReason(Decision string, Comment string) (StatusReason, error) {
+	if Decision == "RELEASED" {
+		return StatusReason{ReasonCode: "QA_RELEASE", Comment: Comment}, nil
+	} else if Decision == "REJECTED" {
+		return StatusReason{ReasonCode: "QA_REJECTION", Comment: Comment}, nil
+	}
+	return StatusReason{}, fmt.Errorf("QA decision must be RELEASED or REJECTED")
+}
+
+func requireQARole(stub shim.ChaincodeStubInterface) error {
+	Role, err := caller.Role(stub)
+	if err != nil {
+		return err
+	}
+	if Role != "qa" {
+		return fmt.Errorf("Only a QA identity can change the QA status")
+	}
+	return nil
+}
+
+//batch status changes are kept under their own id so they never mix with a product uuid
+func batchStatusId(BatchCode string) string {
+	return "batch:" + BatchCode
+}
+
+//a batch without a record yet is returned empty, it has never been quarantined
+func findBatch(stub shim.ChaincodeStubInterface, BatchCode string) (Batch, bool, error) {
+	batch := Batch{ObjectType: "batch", BatchCode: BatchCode, Certificates: []Document{}}
+	batchKey, err := stub.CreateCompositeKey("batch", []string{BatchCode})
+	if err != nil {
+		return batch, false, err
+	}
+	batchAsBytes, err := stub.GetState(batchKey)
+	if err != nil {
+		return batch, false, fmt.Errorf("Failed to get batch: %s", err.Error())
+	} else if batchAsBytes == nil {
+		return batch, false, nil
+	}
+	err = json.Unmarshal(batchAsBytes, &batch)
+	return batch, err == nil, err
+}
+
+func putBatch(stub shim.ChaincodeStubInterface, batch Batch) error {
+	batchKey, err := stub.CreateCompositeKey("batch", []string{batch.BatchCode})
+	if err != nil {
+		return err
+	}
+	batchJSONasBytes, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(batchKey, batchJSONasBytes)
+}
+
+// ==== Returns and destruction ====
+
+//the holder asks to send products back, args are rma id, return to, reason and the product uuids
+func requestReturn(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 4 {
+		return shim.Error("Incorrect number of arguments. Expecting rma id, return to, reason and at least one product")
+	}
+
+	RmaId := args[0]
+	ReturnTo := args[1]
+	Reason := args[2]
+	RequestedBy, err := cid.GetMSPID(stub)
+	if err != nil {
+		return shim.Error("Failed to get caller MSP: " + err.Error())
+	}
+	fmt.Println("- start requestReturn ", RmaId, RequestedBy, ReturnTo)
+
+	rmaKey, err := stub.CreateCompositeKey("return", []string{RmaId})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	rmaAsBytes, err := stub.GetState(rmaKey)
+	if err != nil {
+		return shim.Error("Failed to get return: " + err.Error())
+	} else if rmaAsBytes != nil {
+		return shim.Error("This return already exists: " + RmaId)
+	}
+
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	rma := Return{ObjectType: "return", RmaId: RmaId, Products: []string{}, RequestedBy: RequestedBy, ReturnTo: ReturnTo,
+		Reason: Reason, Status: "REQUESTED", RequestDate: txTime.Format(time.RFC3339)}
+	for i, Uuid := range args[3:] {
+		for _, previous := range args[3 : 3+i] {
+			if previous == Uuid {
+				return shim.Error(Uuid + " is listed more than once")
+			}
+		}
+		product, err := getProduct(stub, Uuid)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if product.Holder != RequestedBy {
+			return shim.Error("product " + Uuid + " is not held by " + RequestedBy)
+		}
+		if product.RmaId != "" {
+			return shim.Error("product " + Uuid + " is already on return " + product.RmaId)
+		}
+		err = checkTransfer(stub, product, "RETURN", txTime)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		product.RmaId = RmaId
+		err = putProduct(stub, product)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		rma.Products = append(rma.Products, Uuid)
+	}
+
+	err = putReturn(stub, rma)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end requestReturn (success)")
+	return shim.Success(nil)
+}
+
+//the party the goods go back to approves or rejects the return
+func approveReturn(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting rma id and APPROVED or REJECTED")
+	}
+
+	RmaId := args[0]
+	Decision := strings.ToUpper(args[1])
+	fmt.Println("- start approveReturn ", RmaId, Decision)
+
+	if Decision != "APPROVED" && Decision != "REJECTED" {
+		return shim.Error("Decision must be APPROVED or REJECTED")
+	}
+	rma, err := getReturn(stub, RmaId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if rma.Status != "REQUESTED" {
+		return shim.Error("return " + RmaId + " is " + rma.Status + ", expected REQUESTED")
+	}
+	err = caller.RequireMSP(stub, rma.ReturnTo)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// a rejected return frees the products for another request
+	if Decision == "REJECTED" {
+		err = clearReturn(stub, rma)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	rma.Status = Decision
+	rma.ApprovalDate = txTime.Format(time.RFC3339)
+	err = putReturn(stub, rma)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end approveReturn (success)")
+	return shim.Success(nil)
+}
+
+//send an approved return back on a shipment registered in the shipment chaincode
+func shipReturn(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting rma id and shipment id")
+	}
+
+	RmaId := args[0]
+	ShipmentId := gs1.NormalizeSSCC(args[1])
+	fmt.Println("- start shipReturn ", RmaId, ShipmentId)
+
+	rma, err := getReturn(stub, RmaId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if rma.Status != "APPROVED" {
+		return shim.Error("return " + RmaId + " is " + rma.Status + ", expected APPROVED")
+	}
+	err = caller.RequireMSP(stub, rma.RequestedBy)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	_, err = getShipment(stub, ShipmentId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	rma.Status = "SHIPPED"
+	rma.ShipmentId = ShipmentId
+	rma.ShipDate = txTime.Format(time.RFC3339)
+	err = putReturn(stub, rma)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end shipReturn (success)")
+	return shim.Success(nil)
+}
+
+//the receiving party takes custody of the returned products
+func receiveReturn(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting rma id and location")
+	}
+
+	RmaId := args[0]
+	Location := args[1]
+	fmt.Println("- start receiveReturn ", RmaId, Location)
+
+	rma, err := getReturn(stub, RmaId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if rma.Status != "SHIPPED" {
+		return shim.Error("return " + RmaId + " is " + rma.Status + ", expected SHIPPED")
+	}
+	err = caller.RequireMSP(stub, rma.ReturnTo)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, Uuid := range rma.Products {
+		product, err := getProduct(stub, Uuid)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = checkTransfer(stub, product, "RETURN", txTime)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = quarantineOnArrival(stub, &product)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if product.ProductStatus == "RECALLED" {
+			product.RecallAction = "RETURNED"
+			product.RecallActionDate = txTime.Format(time.RFC3339)
+		}
+		product.Holder = rma.ReturnTo
+		product.CurrentLocation = Location
+		err = putProduct(stub, product)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	rma.Status = "RECEIVED"
+	rma.ReceiptDate = txTime.Format(time.RFC3339)
+	err = putReturn(stub, rma)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end receiveReturn (success)")
+	return shim.Success(nil)
+}
+
+//put received products back into saleable stock, they still wait for QA release
+func restockReturn(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting rma id")
+	}
+
+	RmaId := args[0]
+	fmt.Println("- start restockReturn ", RmaId)
+
+	rma, err := getReturn(stub, RmaId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if rma.Status != "RECEIVED" {
+		return shim.Error("return " + RmaId + " is " + rma.Status + ", expected RECEIVED")
+	}
+	err = caller.RequireMSP(stub, rma.ReturnTo)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, Uuid := range rma.Products {
+		product, err := getProduct(stub, Uuid)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		switch product.ProductStatus {
+		case "RECALLED", "SUSPECT", "TAMPERED", "DESTROYED":
+			return shim.Error("product " + Uuid + " is " + product.ProductStatus + " and cannot be restocked")
+		}
+		expired, err := isExpired(product, txTime)
+		if err != nil {
+			return shim.Error(err.Error())
+		} else if expired {
+			return shim.Error("product " + Uuid + " is expired and cannot be restocked")
+		}
+	}
+
+	err = clearReturn(stub, rma)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	rma.Status = "RESTOCKED"
+	rma.DispositionDate = txTime.Format(time.RFC3339)
+	err = putReturn(stub, rma)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end restockReturn (success)")
+	return shim.Success(nil)
+}
+
+//destroy received products and issue a destruction certificate,
+//args are rma id, certificate id, method, location and at least one witness
+func destroyReturn(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 5 {
+		return shim.Error("Incorrect number of arguments. Expecting rma id, certificate id, method, location and at least one witness")
+	}
+
+	RmaId := args[0]
+	CertificateId := args[1]
+	Method := args[2]
+	Location := args[3]
+	Witnesses := args[4:]
+	fmt.Println("- start destroyReturn ", RmaId, CertificateId, Witnesses)
+
+	seen := map[string]bool{}
+	for _, Witness := range Witnesses {
+		if Witness == "" || seen[Witness] {
+			return shim.Error("witnesses must be named and distinct")
+		}
+		seen[Witness] = true
+	}
+
+	rma, err := getReturn(stub, RmaId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if rma.Status != "RECEIVED" {
+		return shim.Error("return " + RmaId + " is " + rma.Status + ", expected RECEIVED")
+	}
+	err = caller.RequireMSP(stub, rma.ReturnTo)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	certificateKey, err := stub.CreateCompositeKey("destruction", []string{CertificateId})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	certificateAsBytes, err := stub.GetState(certificateKey)
+	if err != nil {
+		return shim.Error("Failed to get destruction certificate: " + err.Error())
+	} else if certificateAsBytes != nil {
+		return shim.Error("This destruction certificate already exists: " + CertificateId)
+	}
+
+	DestroyedBy, err := caller.Id(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// destruction is the sanctioned end for recalled and tampered products, so no final status check here
+	for _, Uuid := range rma.Products {
+		product, err := getProduct(stub, Uuid)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = recordStatusChange(stub, Uuid, "ProductStatus", product.ProductStatus, "DESTROYED",
+			StatusReason{ReasonCode: "DESTRUCTION", Comment: "destruction certificate " + CertificateId})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		product.ProductStatus = "DESTROYED"
+		product.RmaId = ""
+		err = putProduct(stub, product)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	certificate := DestructionCertificate{ObjectType: "destruction", CertificateId: CertificateId, RmaId: RmaId, Products: rma.Products,
+		Method: Method, Location: Location, DestroyedBy: DestroyedBy, Witnesses: Witnesses, DestructionDate: txTime.Format(time.RFC3339)}
+	certificateJSONasBytes, err := json.Marshal(certificate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(certificateKey, certificateJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	rma.Status = "DESTROYED"
+	rma.CertificateId = CertificateId
+	rma.DispositionDate = txTime.Format(time.RFC3339)
+	err = putReturn(stub, rma)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end destroyReturn (success)")
+	return shim.Success(certificateJSONasBytes)
+}
+
+func searchReturn(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting rma id to query")
+	}
+
+	rma, err := getReturn(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	rmaAsBytes, err := json.Marshal(rma)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(rmaAsBytes)
+}
+
+func searchDestructionCertificate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting certificate id to query")
+	}
+
+	certificateKey, err := stub.CreateCompositeKey("destruction", []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	certificateAsBytes, err := stub.GetState(certificateKey)
+	if err != nil {
+		return shim.Error("Failed to get destruction certificate: " + err.Error())
+	} else if certificateAsBytes == nil {
+		return shim.Error("destruction certificate does not exist: " + args[0])
+	}
+	return shim.Success(certificateAsBytes)
+}
+
+//release the products of a finished or rejected return
+func clearReturn(stub shim.ChaincodeStubInterface, rma Return) error {
+	for _, Uuid := range rma.Products {
+		product, err := getProduct(stub, Uuid)
+		if err != nil {
+			return err
+		}
+		product.RmaId = ""
+		err = putProduct(stub, product)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getReturn(stub shim.ChaincodeStubInterface, RmaId string) (Return, error) {
+	rma := Return{}
+	rmaKey, err := stub.CreateCompositeKey("return", []string{RmaId})
+	if err != nil {
+		return rma, err
+	}
+	rmaAsBytes, err := stub.GetState(rmaKey)
+	if err != nil {
+		return rma, fmt.Errorf("Failed to get return: %s", err.Error())
+	} else if rmaAsBytes == nil {
+		return rma, fmt.Errorf("return does not exist: %s", RmaId)
+	}
+	err = json.Unmarshal(rmaAsBytes, &rma)
+	return rma, err
+}
+
+func putReturn(stub shim.ChaincodeStubInterface, rma Return) error {
+	rmaKey, err := stub.CreateCompositeKey("return", []string{rma.RmaId})
+	if err != nil {
+		return err
+	}
+	rmaJSONasBytes, err := json.Marshal(rma)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(rmaKey, rmaJSONasBytes)
+}
+
+//read a shipment from the shipment chaincode
+func getShipment(stub shim.ChaincodeStubInterface, ShipmentId string) ([]byte, error) {
+	response := stub.InvokeChaincode(shipmentChaincode, util.ToChaincodeArgs("getShipmentDetails", ShipmentId), "")
+	if response.Status != shim.OK {
+		return nil, fmt.Errorf("Failed to get shipment %s: %s", ShipmentId, response.Message)
+	}
+	return response.Payload, nil
+}
+
+//the shipment chaincode passes the buyer and seller of a shipment along, calling it back for
+//them would fail as a chaincode cannot be invoked twice in one transaction. They can be trusted
+//because the client must have sent the transaction to the shipment chaincode. Only the buyer
+//or seller, or a regulator or QA identity, can report on the units of a shipment
+func requireShipmentParty(stub shim.ChaincodeStubInterface, ShipmentId string, Buyer string, Seller string) error {
+	err := caller.RequireChaincode(stub, shipmentChaincode)
+	if err != nil {
+		return err
+	}
+	mspId, err := cid.GetMSPID(stub)
+	if err != nil {
+		return fmt.Errorf("Failed to get caller MSP: %s", err.Error())
+	}
+	if mspId == Buyer || mspId == Seller {
+		return nil
+	}
+	Role, err := caller.Role(stub)
+	if err != nil {
+		return err
+	}
+	if Role != "regulator" && Role != "qa" {
+		return fmt.Errorf("Only the buyer or seller on shipment %s, or a regulator or QA identity, can report on its units", ShipmentId)
+	}
+	return nil
+}
+
+// ==== Hospital dispensing ====
+
+//record that a hospital consumed a unit, after which it can no longer move.
+//args are uuid, ward or department and a pseudonymous patient reference, the hospital is the caller's MSP
+func dispenseProduct(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting uuid, department and patient reference")
+	}
+
+	Uuid := args[0]
+	Department := args[1]
+	PatientReference := args[2]
+	Hospital, err := cid.GetMSPID(stub)
+	if err != nil {
+		return shim.Error("Failed to get caller MSP: " + err.Error())
+	}
+	fmt.Println("- start dispenseProduct ", Uuid, Hospital, Department)
+
+	if !isPseudonymousReference(PatientReference) {
+		return shim.Error("Patient reference must be a pseudonymous token of letters, digits, - or _ and at most 64 characters")
+	}
+
+	product, err := getProduct(stub, Uuid)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if product.Holder != Hospital {
+		return shim.Error("product " + Uuid + " is not held by " + Hospital)
+	}
+	if product.DispensedDate != "" {
+		return shim.Error("product " + Uuid + " was already dispensed on " + product.DispensedDate)
+	}
+	switch product.ProductStatus {
+	case "RECALLED", "SUSPECT", "TAMPERED", "DESTROYED":
+		return shim.Error("product " + Uuid + " is " + product.ProductStatus + " and cannot be dispensed")
+	}
+	if product.QAStatus == "QUARANTINED" || product.QAStatus == "REJECTED" {
+		return shim.Error("product " + Uuid + " is " + product.QAStatus + " and cannot be dispensed")
+	}
+	if product.StabilityExhausted {
+		return shim.Error("product " + Uuid + " has used up its time outside 2-8°C and cannot be dispensed")
+	}
+
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	expired, err := isExpired(product, txTime)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if expired {
+		return shim.Error("product " + Uuid + " expired on " + product.ExpiryDate + " and cannot be dispensed")
+	}
+
+	DispensedBy, err := caller.Id(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	consumption := Consumption{ObjectType: "consumption", Uuid: Uuid, GTIN: product.GTIN, Material: product.Material, BatchCode: product.BatchCode,
+		Hospital: Hospital, Department: Department, PatientReference: PatientReference, DispensedBy: DispensedBy,
+		DispenseDate: txTime.Format(time.RFC3339)}
+	consumptionKey, err := stub.CreateCompositeKey("consumption", []string{Hospital, Uuid})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	consumptionJSONasBytes, err := json.Marshal(consumption)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(consumptionKey, consumptionJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = recordStatusChange(stub, Uuid, "ProductStatus", product.ProductStatus, "DISPENSED", StatusReason{ReasonCode: "DISPENSED", Comment: Department})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	product.ProductStatus = "DISPENSED"
+	product.DispensedAt = Hospital
+	product.DispensedDate = consumption.DispenseDate
+	err = putProduct(stub, product)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end dispenseProduct (success)")
+	return shim.Success(nil)
+}
+
+//what a hospital consumed, optionally between two YYYY-MM-DD dates inclusive
+func hospitalConsumption(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 && len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting hospital and optional from and to dates")
+	}
+
+	report := ConsumptionReport{Hospital: args[0], Totals: map[string]int{}, Records: []Consumption{}}
+	if len(args) == 3 {
+		report.From = args[1]
+		report.To = args[2]
+		for _, date := range []string{report.From, report.To} {
+			_, err := time.Parse(dateLayout, date)
+			if err != nil {
+				return shim.Error("dates must be YYYY-MM-DD: " + err.Error())
+			}
+		}
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("consumption", []string{report.Hospital})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		consumption := Consumption{}
+		err = json.Unmarshal(queryResponse.Value, &consumption)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		day := consumption.DispenseDate[:len(dateLayout)]
+		if report.From != "" && (day < report.From || day > report.To) {
+			continue
+		}
+		report.Totals[consumption.Material]++
+		report.Records = append(report.Records, consumption)
+	}
+
+	reportAsBytes, err := json.Marshal(report)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(reportAsBytes)
+}
+
+//an opaque token from the hospital system, so names or record numbers with spaces are refused
+func isPseudonymousReference(reference string) bool {
+	if reference == "" || len(reference) > 64 {
+		return false
+	}
+	for _, c := range reference {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// ==== Products on shipments ====
+
+//put products, or everything packed in the given containers, on a shipment
+func assignToShipment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 2 {
+		return shim.Error("Incorrect number of arguments. Expecting shipment id and at least one product or container")
+	}
+
+	ShipmentId := gs1.NormalizeSSCC(args[0])
+	fmt.Println("- start assignToShipment ", ShipmentId, args[1:])
+
+	_, err := getShipment(stub, ShipmentId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	uuids := []string{}
+	for _, Id := range args[1:] {
+		_, isContainer, err := findContainer(stub, Id)
+		if err != nil {
+			return shim.Error(err.Error())
+		} else if isContainer {
+			packed, err := getPackedProducts(stub, Id)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			uuids = append(uuids, packed...)
+		} else {
+			uuids = append(uuids, Id)
+		}
+	}
+
+	assigned := map[string]bool{}
+	for _, Uuid := range uuids {
+		if assigned[Uuid] {
+			return shim.Error(Uuid + " is listed more than once")
+		}
+		assigned[Uuid] = true
+
+		product, err := getProduct(stub, Uuid)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if product.ShipmentId == ShipmentId {
+			continue
+		}
+		if product.ShipmentId != "" {
+			oldKey, err := stub.CreateCompositeKey("shipment~product", []string{product.ShipmentId, Uuid})
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			err = stub.DelState(oldKey)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+		indexKey, err := stub.CreateCompositeKey("shipment~product", []string{ShipmentId, Uuid})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = stub.PutState(indexKey, []byte{0x00})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		product.ShipmentId = ShipmentId
+		err = putProduct(stub, product)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	fmt.Println("- end assignToShipment (success)")
+	return shim.Success(nil)
+}
+
+//which units are on a shipment
+func productsOnShipment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting shipment Id to query")
+	}
+
+	products, err := getProductsOnShipment(stub, gs1.NormalizeSSCC(args[0]))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	productsAsBytes, err := json.Marshal(products)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(productsAsBytes)
+}
+
+//which shipment carried a unit, read from the shipment chaincode
+func shipmentOfProduct(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting product uuid")
+	}
+
+	product, err := getProduct(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if product.ShipmentId == "" {
+		return shim.Error("product " + product.Uuid + " is not on a shipment")
+	}
+	shipmentAsBytes, err := getShipment(stub, product.ShipmentId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(shipmentAsBytes)
+}
+
+//called by the shipment chaincode when a shipment is TAMPERED or has a temperature EXCURSION.
+//Tampering marks the units TAMPERED, an excursion sends them to quarantine for QA to judge.
+//args are shipment id, buyer, seller, incident, reason code and comment
+func shipmentIncident(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 6 {
+		return shim.Error("Incorrect number of arguments. Expecting shipment id, buyer, seller, TAMPERED or EXCURSION, reason code and comment")
+	}
+
+	ShipmentId := args[0]
+	Buyer := args[1]
+	Seller := args[2]
+	Incident := strings.ToUpper(args[3])
+	statusReason, err := getStatusReason(args[4:])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("- start shipmentIncident ", ShipmentId, Incident)
+
+	if Incident != "TAMPERED" && Incident != "EXCURSION" {
+		return shim.Error("Incident must be TAMPERED or EXCURSION")
+	}
+	err = requireShipmentParty(stub, ShipmentId, Buyer, Seller)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	products, err := getProductsOnShipment(stub, ShipmentId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, product := range products {
+		changed, err := applyIncident(stub, &product, Incident, statusReason)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if !changed {
+			continue
+		}
+		err = putProduct(stub, product)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	fmt.Println("- end shipmentIncident (success)")
+	return shim.Success(nil)
+}
+
+//marks one unit TAMPERED or quarantines it for an excursion, reporting whether it changed
+func applyIncident(stub shim.ChaincodeStubInterface, product *Product, Incident string, statusReason StatusReason) (bool, error) {
+	if Incident == "TAMPERED" {
+		// products that already reached a final status keep it
+		if checkStatusChange(*product) != nil {
+			return false, nil
+		}
+		err := recordStatusChange(stub, product.Uuid, "ProductStatus", product.ProductStatus, "TAMPERED", statusReason)
+		if err != nil {
+			return false, err
+		}
+		product.ProductStatus = "TAMPERED"
+		return true, nil
+	}
+	if product.QAStatus == "QUARANTINED" {
+		return false, nil
+	}
+	err := recordStatusChange(stub, product.Uuid, "QAStatus", product.QAStatus, "QUARANTINED", statusReason)
+	if err != nil {
+		return false, err
+	}
+	product.QAStatus = "QUARANTINED"
+	return true, nil
+}
+
+func getProductsOnShipment(stub shim.ChaincodeStubInterface, ShipmentId string) ([]Product, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("shipment~product", []string{ShipmentId})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	products := []Product{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, keyParts, err := stub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+		product, err := getProduct(stub, keyParts[1])
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+	return products, nil
+}
+
+// ==== Stability budget ====
+
+//called by the shipment chaincode with the seconds a shipment spent outside 2-8°C,
+//deducted from every unit on the shipment that tracks a stability budget.
+//A reason code and comment quarantine the units for the excursion in the same write,
+//as a second call in the transaction would not see the deduction.
+//args are shipment id, buyer, seller and seconds, optionally followed by reason code and comment
+func deductStability(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 4 && len(args) != 6 {
+		return shim.Error("Incorrect number of arguments. Expecting shipment id, buyer, seller and seconds, optionally followed by reason code and comment")
+	}
+
+	ShipmentId := args[0]
+	Buyer := args[1]
+	Seller := args[2]
+	seconds, err := strconv.ParseInt(args[3], 10, 64)
+	if err != nil || seconds < 0 {
+		return shim.Error("seconds must be a non-negative number")
+	}
+	quarantine := len(args) == 6
+	statusReason := StatusReason{}
+	if quarantine {
+		statusReason, err = getStatusReason(args[4:])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	fmt.Println("- start deductStability ", ShipmentId, seconds)
+
+	err = requireShipmentParty(stub, ShipmentId, Buyer, Seller)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	products, err := getProductsOnShipment(stub, ShipmentId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, product := range products {
+		changed := false
+		if seconds > 0 && product.StabilityBudgetMinutes != 0 && product.DispensedDate == "" {
+			product.StabilityUsedSeconds += seconds
+			if !product.StabilityExhausted && product.StabilityUsedSeconds >= product.StabilityBudgetMinutes*60 {
+				err = recordStatusChange(stub, product.Uuid, "StabilityBudget", "AVAILABLE", "EXHAUSTED",
+					StatusReason{ReasonCode: "TEMPERATURE_EXCURSION", Comment: "excursions on shipment " + ShipmentId})
+				if err != nil {
+					return shim.Error(err.Error())
+				}
+				product.StabilityExhausted = true
+			}
+			changed = true
+		}
+		if quarantine {
+			quarantined, err := applyIncident(stub, &product, "EXCURSION", statusReason)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			changed = changed || quarantined
+		}
+		if !changed {
+			continue
+		}
+		err = putProduct(stub, product)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	fmt.Println("- end deductStability (success)")
+	return shim.Success(nil)
+}
+
+//the remaining stability budget of a unit
+func stabilityBudget(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting product uuid")
+	}
+
+	product, err := getProduct(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	budgetAsBytes, err := json.Marshal(newStabilityBudget(product))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(budgetAsBytes)
+}
+
+//the remaining stability budget of every unit in a batch
+func batchStabilityBudget(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting batch code")
+	}
+
+	products, err := getProductsByBatch(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	budgets := []StabilityBudget{}
+	for _, product := range products {
+		budgets = append(budgets, newStabilityBudget(product))
+	}
+	budgetsAsBytes, err := json.Marshal(budgets)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(budgetsAsBytes)
+}
+
+func newStabilityBudget(product Product) StabilityBudget {
+	usedMinutes := float64(product.StabilityUsedSeconds) / 60
+	remainingMinutes := float64(product.StabilityBudgetMinutes) - usedMinutes
+	if remainingMinutes < 0 {
+		remainingMinutes = 0
+	}
+	return StabilityBudget{Uuid: product.Uuid, BatchCode: product.BatchCode, BudgetMinutes: product.StabilityBudgetMinutes,
+		UsedMinutes: usedMinutes, RemainingMinutes: remainingMinutes, Exhausted: product.StabilityExhausted}
+}
+
+// ==== Label payloads ====
+
+//the unsigned payload to encode in the QR code of a product label. The caller signs the returned
+//bytes as they are with its label key and sets s. Call it as a query, the height changes per block
+func labelPayload(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting product uuid")
+	}
+
+	Uuid := args[0]
+	productAsBytes, err := stub.GetState(Uuid)
+	if err != nil {
+		return shim.Error("Failed to get product: " + err.Error())
+	} else if productAsBytes == nil {
+		return shim.Error("Product does not exist: " + Uuid)
+	}
+	product := Product{}
+	err = json.Unmarshal(productAsBytes, &product)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	_, TxId, _, err := label.GetLabelledState(stub, Uuid, "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	stateHash := sha256.Sum256(productAsBytes)
+	payload, err := label.Stamp(stub, label.Payload{Type: "P", Id: Uuid, Batch: product.BatchCode, Expiry: product.ExpiryDate,
+		TxId: TxId, StateHash: hex.EncodeToString(stateHash[:])})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	payloadAsBytes, err := json.Marshal(payload)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(payloadAsBytes)
+}
+
+//check the signature of a scanned product label and the state it carries against the ledger,
+//needs no attributes so anyone can verify
+func verifyLabel(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting the scanned label payload")
+	}
+
+	payload := label.Payload{}
+	err := json.Unmarshal([]byte(args[0]), &payload)
+	if err != nil || payload.Id == "" || payload.TxId == "" || payload.StateHash == "" {
+		return shim.Error("Label payload is not readable")
+	}
+	if payload.Type != "P" {
+		return shim.Error("Label is not a product label")
+	}
+
+	verification := label.Verification{Id: payload.Id}
+	labelledAsBytes, latestTxId, found, err := label.GetLabelledState(stub, payload.Id, payload.TxId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	labelled := Product{}
+	stateHash := sha256.Sum256(labelledAsBytes)
+	err = label.Verify(stub, payload)
+	verification.Signed = err == nil
+	if !verification.Signed {
+		verification.Reason = err.Error()
+	} else if !found {
+		verification.Reason = "no such product state on the ledger"
+	} else if hex.EncodeToString(stateHash[:]) != strings.ToLower(payload.StateHash) {
+		verification.Reason = "state hash does not match the ledger"
+	} else if err = json.Unmarshal(labelledAsBytes, &labelled); err != nil {
+		return shim.Error(err.Error())
+	} else if labelled.Uuid != payload.Id || labelled.BatchCode != payload.Batch || labelled.ExpiryDate != payload.Expiry {
+		verification.Reason = "batch or expiry on the label does not match the ledger"
+	} else {
+		verification.Genuine = true
+		verification.Current = payload.TxId == latestTxId
+		if !verification.Current {
+			verification.Reason = "product record changed since the label was printed"
+		}
+	}
+
+	if found {
+		product, err := getProduct(stub, payload.Id)
+		if err == nil {
+			verification.Status = product.ProductStatus
+		}
+	}
+
+	verificationAsBytes, err := json.Marshal(verification)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(verificationAsBytes)
+}
+
+//register the PEM public key the caller's organisation signs product labels with
+func registerLabelKey(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting PEM public key")
+	}
+
+	err := label.RegisterKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+//the PEM public key an MSP signs product labels with, for checking labels offline
+func labelKey(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting MSP id")
+	}
+
+	keyAsBytes, err := label.GetKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(keyAsBytes)
+}
+
+// ==== Decommissioning ====
+
+//why a product or shipment can be retired
+var decommissionReasons = map[string]bool{
+	"DESTROYED": true,
+	"SAMPLE":    true,
+	"STOLEN":    true,
+	"LOST":      true,
+}
+
+//retire a product, regulator or QA only. The record stays readable as a tombstone and
+//can no longer be changed. With purge set to true the holder, locations and the patient
+//reference of a dispensed unit are cleared from world state and only a hash of them is kept,
+//the ledger history still holds the earlier values.
+//args are uuid, reason, comment and an optional purge flag
+func decommissionProduct(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 && len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting uuid, reason, comment and optional purge flag")
+	}
+
+	Uuid := args[0]
+	Reason := strings.ToUpper(args[1])
+	Comment := strings.TrimSpace(args[2])
+	Purge := false
+	if len(args) == 4 && args[3] != "" {
+		var err error
+		Purge, err = strconv.ParseBool(args[3])
+		if err != nil {
+			return shim.Error("purge must be true or false")
+		}
+	}
+	fmt.Println("- start decommissionProduct ", Uuid, Reason, Purge)
+
+	if !decommissionReasons[Reason] {
+		return shim.Error("Unknown decommission reason " + Reason + ", expecting DESTROYED, SAMPLE, STOLEN or LOST")
+	}
+	if Comment == "" {
+		return shim.Error("A comment is required to decommission a product")
+	}
+	Role, err := caller.Role(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if Role != "regulator" && Role != "qa" {
+		return shim.Error("Only a regulator or QA identity can decommission a product")
+	}
+
+	product, err := getProduct(stub, Uuid)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if product.DecommissionDate != "" {
+		return shim.Error("product " + Uuid + " was already decommissioned on " + product.DecommissionDate)
+	}
+	// a unit on a return is settled by the return, which releases it once restocked, destroyed or rejected
+	if product.RmaId != "" {
+		return shim.Error("product " + Uuid + " is on return " + product.RmaId + ", close the return before decommissioning it")
+	}
+
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	DecommissionedBy, err := caller.Id(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// a retired unit no longer travels in a container or on a shipment
+	if product.ContainerId != "" {
+		container, err := getContainer(stub, product.ContainerId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		packed := []string{}
+		for _, packedUuid := range container.Products {
+			if packedUuid != Uuid {
+				packed = append(packed, packedUuid)
+			}
+		}
+		container.Products = packed
+		err = putContainer(stub, container)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		product.ContainerId = ""
+	}
+	if product.ShipmentId != "" {
+		indexKey, err := stub.CreateCompositeKey("shipment~product", []string{product.ShipmentId, Uuid})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = stub.DelState(indexKey)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		product.ShipmentId = ""
+	}
+
+	err = recordStatusChange(stub, Uuid, "ProductStatus", product.ProductStatus, "DECOMMISSIONED",
+		StatusReason{ReasonCode: "DECOMMISSION", Comment: Reason + ": " + Comment})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	product.ProductStatus = "DECOMMISSIONED"
+	product.DecommissionReason = Reason
+	product.DecommissionDate = txTime.Format(time.RFC3339)
+	product.DecommissionedBy = DecommissionedBy
+
+	if Purge {
+		if product.DispensedAt != "" {
+			err = purgeConsumption(stub, product.DispensedAt, Uuid)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+		productJSONasBytes, err := json.Marshal(product)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		stateHash := sha256.Sum256(productJSONasBytes)
+		product.PurgedStateHash = hex.EncodeToString(stateHash[:])
+		product.Holder = ""
+		product.CurrentLocation = ""
+		product.RawMaterialLocation = ""
+		product.LastScanLocation = ""
+		product.DispensedAt = ""
+	}
+
+	// putProduct refuses tombstones, so the tombstone itself is written here
+	productJSONasBytes, err := json.Marshal(product)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(Uuid, productJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end decommissionProduct (success)")
+	return shim.Success(nil)
+}
+
+//clear the patient reference of a consumption record and keep a hash of it
+func purgeConsumption(stub shim.ChaincodeStubInterface, Hospital string, Uuid string) error {
+	consumptionKey, err := stub.CreateCompositeKey("consumption", []string{Hospital, Uuid})
+	if err != nil {
+		return err
+	}
+	consumptionAsBytes, err := stub.GetState(consumptionKey)
+	if err != nil {
+		return err
+	} else if consumptionAsBytes == nil {
+		return nil
+	}
+	consumption := Consumption{}
+	err = json.Unmarshal(consumptionAsBytes, &consumption)
+	if err != nil {
+		return err
+	}
+	stateHash := sha256.Sum256(consumptionAsBytes)
+	consumption.PurgedStateHash = hex.EncodeToString(stateHash[:])
+	consumption.PatientReference = ""
+	consumptionJSONasBytes, err := json.Marshal(consumption)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(consumptionKey, consumptionJSONasBytes)
+}
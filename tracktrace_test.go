@@ -0,0 +1,624 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RinuT/chaincode/chaincodetest"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+var (
+	manufacturer = chaincodetest.Identity("ManufacturerMSP", "")
+	distributor  = chaincodetest.Identity("DistributorMSP", "")
+	hospital     = chaincodetest.Identity("HospitalMSP", "")
+	outsider     = chaincodetest.Identity("OutsiderMSP", "")
+	regulator    = chaincodetest.Identity("RegulatorMSP", "regulator")
+)
+
+//stands in for the shipment chaincode (painting.go). It holds the shipments and passes
+//everything else on to the product chaincode in the same transaction, as painting.go does
+type shipmentChaincodeStandIn struct {
+	shipments map[string]string
+}
+
+func (s *shipmentChaincodeStandIn) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (s *shipmentChaincodeStandIn) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	function, args := stub.GetFunctionAndParameters()
+	if function == "getShipmentDetails" {
+		shipment, ok := s.shipments[args[0]]
+		if !ok {
+			return shim.Error("shipment does not exist")
+		}
+		return shim.Success([]byte(shipment))
+	}
+	return stub.InvokeChaincode("tracktrace", stub.GetArgs(), "")
+}
+
+//the product chaincode next to a shipment chaincode holding SHIP1, sold by the
+//distributor to the hospital
+func newProductChannel() (*chaincodetest.Stub, *chaincodetest.Stub) {
+	channel := chaincodetest.NewChannel()
+	products := channel.Install("tracktrace", new(SmartContract))
+	shipments := channel.Install(shipmentChaincode, &shipmentChaincodeStandIn{shipments: map[string]string{
+		"SHIP1": `{"ShipmentId":"SHIP1","Buyer":"HospitalMSP","Seller":"DistributorMSP"}`}})
+	return products, shipments
+}
+
+func invokeOK(t *testing.T, stub *chaincodetest.Stub, creator []byte, args ...string) []byte {
+	t.Helper()
+	response := stub.Invoke(creator, args...)
+	if response.Status != shim.OK {
+		t.Fatalf("%s: %s", args[0], response.Message)
+	}
+	return response.Payload
+}
+
+func invokeFails(t *testing.T, stub *chaincodetest.Stub, creator []byte, want string, args ...string) {
+	t.Helper()
+	response := stub.Invoke(creator, args...)
+	if response.Status == shim.OK {
+		t.Fatalf("%s succeeded, expecting %q", args[0], want)
+	}
+	if !strings.Contains(response.Message, want) {
+		t.Fatalf("%s: %s, expecting %q", args[0], response.Message, want)
+	}
+}
+
+//a unit of lot LOT1 made by the manufacturer
+func createTestProduct(t *testing.T, products *chaincodetest.Stub, Uuid string) {
+	t.Helper()
+	invokeOK(t, products, manufacturer, "create_product", Uuid, "Insulin", "ManufacturerMSP", "Plant 1", "IN_GOOD_CONDITION",
+		"AT_PLANT", "LOT1", "2026-01-01", "2028-01-01")
+}
+
+func readProduct(t *testing.T, products *chaincodetest.Stub, Uuid string) Product {
+	t.Helper()
+	product := Product{}
+	err := json.Unmarshal(products.State[Uuid], &product)
+	if err != nil {
+		t.Fatalf("product %s: %s", Uuid, err)
+	}
+	return product
+}
+
+//a unit of lot LOT2 made by the manufacturer that expires on ExpiryDate
+func createExpiringProduct(t *testing.T, products *chaincodetest.Stub, Uuid string, ExpiryDate string) {
+	t.Helper()
+	invokeOK(t, products, manufacturer, "create_product", Uuid, "Insulin", "ManufacturerMSP", "Plant 1", "IN_GOOD_CONDITION",
+		"AT_PLANT", "LOT2", "2025-01-01", ExpiryDate)
+}
+
+// ==== Expiry ====
+
+func TestExpiringProducts(t *testing.T) {
+	products, _ := newProductChannel()
+	invokeFails(t, products, manufacturer, "ExpiryDate must be after ManufactureDate", "create_product", "P1", "Insulin", "ManufacturerMSP",
+		"Plant 1", "IN_GOOD_CONDITION", "AT_PLANT", "LOT2", "2025-01-01", "2025-01-01")
+	invokeFails(t, products, manufacturer, "ExpiryDate must be YYYY-MM-DD", "create_product", "P1", "Insulin", "ManufacturerMSP",
+		"Plant 1", "IN_GOOD_CONDITION", "AT_PLANT", "LOT2", "2025-01-01", "01/02/2026")
+
+	// the channel clock stands at 2026-01-05
+	for Uuid, ExpiryDate := range map[string]string{"EXP0": "2026-01-04", "EXP1": "2026-01-05", "EXP2": "2026-02-04", "EXP3": "2026-02-05"} {
+		createExpiringProduct(t, products, Uuid, ExpiryDate)
+	}
+	expiring := []Product{}
+	if err := json.Unmarshal(invokeOK(t, products, distributor, "expiring_products", "30"), &expiring); err != nil {
+		t.Fatal(err)
+	}
+	Uuids := []string{}
+	for _, product := range expiring {
+		Uuids = append(Uuids, product.Uuid)
+	}
+	sort.Strings(Uuids)
+	if strings.Join(Uuids, " ") != "EXP1 EXP2" {
+		t.Fatalf("expiring within 30 days: %v, expecting EXP1 EXP2", Uuids)
+	}
+	invokeFails(t, products, distributor, "withinDays must be a non-negative number", "expiring_products", "-1")
+}
+
+func TestExpiredProductsOnlyMoveToBeDestroyed(t *testing.T) {
+	products, _ := newProductChannel()
+	createExpiringProduct(t, products, "EXP0", "2026-01-04")
+	createExpiringProduct(t, products, "EXP1", "2026-01-05")
+
+	// a product can still be used on its expiry date
+	invokeOK(t, products, manufacturer, "transfer_product", "EXP1", "DistributorMSP", "Warehouse")
+	invokeFails(t, products, manufacturer, "product EXP0 expired on 2026-01-04, it can only be transferred for RETURN or DESTRUCTION",
+		"transfer_product", "EXP0", "DistributorMSP", "Warehouse")
+	invokeOK(t, products, manufacturer, "transfer_product", "EXP0", "DistributorMSP", "Incinerator", "DESTRUCTION")
+}
+
+// ==== Packaging hierarchy ====
+
+func containersOf(t *testing.T, products *chaincodetest.Stub, args ...string) string {
+	t.Helper()
+	parents := []string{}
+	if err := json.Unmarshal(invokeOK(t, products, distributor, append([]string{"container_of"}, args...)...), &parents); err != nil {
+		t.Fatal(err)
+	}
+	return strings.Join(parents, " ")
+}
+
+func TestAggregateAndDisaggregate(t *testing.T) {
+	products, _ := newProductChannel()
+	createTestProduct(t, products, "P1")
+	createTestProduct(t, products, "P2")
+	const Case, Pallet = "340123450000000017", "106141412345678908"
+
+	invokeFails(t, products, manufacturer, "container id must be a valid SSCC: 340123450000000018", "aggregate", "340123450000000018", "P1")
+	invokeOK(t, products, manufacturer, "aggregate", Case, "P1", "P2")
+	invokeOK(t, products, manufacturer, "aggregate", Pallet, Case)
+	invokeFails(t, products, manufacturer, "product P1 is already packed in "+Case, "aggregate", Pallet, "P1")
+	invokeFails(t, products, manufacturer, "container "+Pallet+" cannot be packed inside itself", "aggregate", Case, Pallet)
+	if parents := containersOf(t, products, "P1"); parents != Case+" "+Pallet {
+		t.Fatalf("P1 is packed in %q, expecting the case and then the pallet", parents)
+	}
+
+	packed := products.Channel().Now.Format(time.RFC3339)
+	invokeFails(t, products, manufacturer, "P3 is not packed in container "+Case, "disaggregate", Case, "P1", "P3")
+	invokeOK(t, products, manufacturer, "disaggregate", Case, "P1")
+	if parents := containersOf(t, products, "P1"); parents != "" {
+		t.Fatalf("P1 is still packed in %q", parents)
+	}
+	if parents := containersOf(t, products, "P2"); parents != Case+" "+Pallet {
+		t.Fatalf("P2 is packed in %q, expecting the case and then the pallet", parents)
+	}
+	if parents := containersOf(t, products, "P1", packed); parents != Case+" "+Pallet {
+		t.Fatalf("P1 was packed in %q before it was taken out, expecting the case and then the pallet", parents)
+	}
+
+	invokeOK(t, products, manufacturer, "disaggregate", Pallet)
+	if parents := containersOf(t, products, "P2"); parents != Case {
+		t.Fatalf("P2 is packed in %q after the pallet was broken up, expecting only the case", parents)
+	}
+}
+
+// ==== Counterfeit detection ====
+
+func scan(t *testing.T, products *chaincodetest.Stub, creator []byte, Uuid string, Location string) Scan {
+	t.Helper()
+	scan := Scan{}
+	if err := json.Unmarshal(invokeOK(t, products, creator, "verify_scan", Uuid, Location), &scan); err != nil {
+		t.Fatal(err)
+	}
+	return scan
+}
+
+func TestScanFlagsImpossibleScans(t *testing.T) {
+	products, _ := newProductChannel()
+	createTestProduct(t, products, "P1")
+	createTestProduct(t, products, "P2")
+
+	if got := scan(t, products, manufacturer, "P1", "Plant 1"); len(got.Alerts) != 0 {
+		t.Fatalf("a scan by the holder raised %v", got.Alerts)
+	}
+	if products.Event != nil {
+		t.Fatalf("a clean scan sent %s", products.Event.EventName)
+	}
+	got := scan(t, products, manufacturer, "P1", "Pune")
+	if len(got.Alerts) != 1 || !strings.HasPrefix(got.Alerts[0], "SCANNED_AT_Plant 1_AT_") {
+		t.Fatalf("a scan in Pune seconds after one at Plant 1 raised %v", got.Alerts)
+	}
+	if status := readProduct(t, products, "P1").ProductStatus; status != "SUSPECT" {
+		t.Fatalf("P1 is %s after an impossible scan, expecting SUSPECT", status)
+	}
+	if products.Event == nil || products.Event.EventName != "CounterfeitAlertEvent" {
+		t.Fatalf("no counterfeit alert was sent: %+v", products.Event)
+	}
+
+	if got = scan(t, products, distributor, "P2", "Warehouse"); strings.Join(got.Alerts, " ") != "HELD_BY_ManufacturerMSP" {
+		t.Fatalf("a scan by someone other than the holder raised %v", got.Alerts)
+	}
+	if got = scan(t, products, distributor, "P9", "Warehouse"); strings.Join(got.Alerts, " ") != "UNKNOWN_SERIAL" {
+		t.Fatalf("a scan of an unknown serial raised %v", got.Alerts)
+	}
+	scans := []Scan{}
+	if err := json.Unmarshal(invokeOK(t, products, distributor, "scan_history", "P1"), &scans); err != nil {
+		t.Fatal(err)
+	}
+	if len(scans) != 2 {
+		t.Fatalf("P1 has %d scans recorded, expecting 2", len(scans))
+	}
+}
+
+func TestSerialIsUniqueWithinGTIN(t *testing.T) {
+	products, _ := newProductChannel()
+	invokeOK(t, products, manufacturer, "create_product", "P1", "Insulin", "ManufacturerMSP", "Plant 1", "IN_GOOD_CONDITION",
+		"AT_PLANT", "LOT1", "2026-01-01", "2028-01-01", "(01)09506000134352(21)S1")
+	invokeFails(t, products, manufacturer, "GTIN 09506000134352 serial S1 is already registered as P1", "create_product", "P2", "Insulin",
+		"ManufacturerMSP", "Plant 1", "IN_GOOD_CONDITION", "AT_PLANT", "LOT1", "2026-01-01", "2028-01-01", "(01)09506000134352(21)S1")
+	invokeOK(t, products, manufacturer, "create_product", "P2", "Insulin", "ManufacturerMSP", "Plant 1", "IN_GOOD_CONDITION",
+		"AT_PLANT", "LOT1", "2026-01-01", "2028-01-01", "(01)09506000134352(21)S2")
+}
+
+// ==== Shipment incidents ====
+
+func TestShipmentIncidentFromShipmentChaincode(t *testing.T) {
+	products, shipments := newProductChannel()
+	createTestProduct(t, products, "P1")
+	invokeOK(t, products, manufacturer, "assign_to_shipment", "SHIP1", "P1")
+
+	// the shipment chaincode is running when the product chaincode checks the caller,
+	// so any call back to it fails the transaction
+	invokeOK(t, shipments, hospital, "shipment_incident", "SHIP1", "HospitalMSP", "DistributorMSP", "TAMPERED", "SEAL_BROKEN", "seal broken on arrival")
+	if status := readProduct(t, products, "P1").ProductStatus; status != "TAMPERED" {
+		t.Fatalf("ProductStatus = %s, expecting TAMPERED", status)
+	}
+}
+
+func TestShipmentIncidentOnlyForShipmentParties(t *testing.T) {
+	products, shipments := newProductChannel()
+	createTestProduct(t, products, "P1")
+	invokeOK(t, products, manufacturer, "assign_to_shipment", "SHIP1", "P1")
+
+	invokeFails(t, shipments, outsider, "Only the buyer or seller on shipment SHIP1",
+		"shipment_incident", "SHIP1", "HospitalMSP", "DistributorMSP", "TAMPERED", "SEAL_BROKEN", "")
+	if status := readProduct(t, products, "P1").ProductStatus; status != "IN_GOOD_CONDITION" {
+		t.Fatalf("ProductStatus = %s after a refused incident", status)
+	}
+	invokeOK(t, shipments, regulator, "shipment_incident", "SHIP1", "HospitalMSP", "DistributorMSP", "EXCURSION", "TEMPERATURE_EXCURSION", "")
+	if status := readProduct(t, products, "P1").QAStatus; status != "QUARANTINED" {
+		t.Fatalf("QAStatus = %s, expecting QUARANTINED", status)
+	}
+}
+
+func TestShipmentIncidentNotSentDirectly(t *testing.T) {
+	products, _ := newProductChannel()
+	createTestProduct(t, products, "P1")
+	invokeOK(t, products, manufacturer, "assign_to_shipment", "SHIP1", "P1")
+
+	// sent straight to the product chaincode the buyer and seller are whatever the client says
+	invokeFails(t, products, outsider, "only the mycc chaincode can call this",
+		"shipment_incident", "SHIP1", "OutsiderMSP", "OutsiderMSP", "TAMPERED", "SEAL_BROKEN", "")
+}
+
+// ==== Stability budget ====
+
+func TestDeductStabilityFromShipmentChaincode(t *testing.T) {
+	products, shipments := newProductChannel()
+	invokeOK(t, products, manufacturer, "create_product", "P1", "Insulin", "ManufacturerMSP", "Plant 1", "IN_GOOD_CONDITION",
+		"AT_PLANT", "LOT1", "2026-01-01", "2028-01-01", "", "60")
+	invokeOK(t, products, manufacturer, "assign_to_shipment", "SHIP1", "P1")
+
+	invokeOK(t, shipments, distributor, "deduct_stability", "SHIP1", "HospitalMSP", "DistributorMSP", "1800",
+		"TEMPERATURE_EXCURSION", "temperature 12 outside 2-8°C")
+	product := readProduct(t, products, "P1")
+	if product.StabilityUsedSeconds != 1800 || product.QAStatus != "QUARANTINED" {
+		t.Fatalf("used %d seconds and QAStatus %s, expecting 1800 and QUARANTINED", product.StabilityUsedSeconds, product.QAStatus)
+	}
+
+	invokeFails(t, shipments, outsider, "Only the buyer or seller on shipment SHIP1",
+		"deduct_stability", "SHIP1", "HospitalMSP", "DistributorMSP", "1800")
+	invokeFails(t, products, distributor, "only the mycc chaincode can call this",
+		"deduct_stability", "SHIP1", "HospitalMSP", "DistributorMSP", "1800")
+	invokeOK(t, shipments, distributor, "deduct_stability", "SHIP1", "HospitalMSP", "DistributorMSP", "1800")
+	product = readProduct(t, products, "P1")
+	if product.StabilityUsedSeconds != 3600 || !product.StabilityExhausted {
+		t.Fatalf("used %d seconds, exhausted %t, expecting the 60 minute budget used up", product.StabilityUsedSeconds, product.StabilityExhausted)
+	}
+}
+
+// ==== Product and container status ====
+
+func TestUpdateContainerStatus(t *testing.T) {
+	products, _ := newProductChannel()
+	createTestProduct(t, products, "P1")
+	createTestProduct(t, products, "P2")
+	invokeOK(t, products, manufacturer, "aggregate", "340123450000000017", "P1", "P2")
+
+	invokeOK(t, products, distributor, "update_container_status", "340123450000000017", "suspect", "DAMAGED_PACKAGING", "crushed corner")
+	for _, Uuid := range []string{"P1", "P2"} {
+		if status := readProduct(t, products, Uuid).ProductStatus; status != "SUSPECT" {
+			t.Fatalf("%s is %s, expecting SUSPECT", Uuid, status)
+		}
+	}
+	invokeFails(t, products, distributor, "Unknown product status: BROKEN",
+		"update_container_status", "340123450000000017", "broken", "DAMAGED_PACKAGING")
+	invokeFails(t, products, distributor, "Only a regulator or QA can set a product to DESTROYED",
+		"update_container_status", "340123450000000017", "destroyed", "DESTRUCTION")
+
+	invokeOK(t, products, regulator, "update_container_status", "340123450000000017", "destroyed", "DESTRUCTION")
+	invokeFails(t, products, regulator, "A comment is required to override the DESTROYED status",
+		"update_container_status", "340123450000000017", "in_good_condition", "DATA_CORRECTION")
+	invokeOK(t, products, regulator, "update_container_status", "340123450000000017", "in_good_condition", "DATA_CORRECTION", "destroyed by mistake")
+	if status := readProduct(t, products, "P2").ProductStatus; status != "IN_GOOD_CONDITION" {
+		t.Fatalf("P2 is %s after the override, expecting IN_GOOD_CONDITION", status)
+	}
+}
+
+func TestCreateProductStatus(t *testing.T) {
+	products, _ := newProductChannel()
+	invokeFails(t, products, manufacturer, "Unknown product status: fine",
+		"create_product", "P1", "Insulin", "ManufacturerMSP", "Plant 1", "fine", "AT_PLANT", "LOT1", "2026-01-01", "2028-01-01")
+	invokeFails(t, products, manufacturer, "A product cannot be created RECALLED",
+		"create_product", "P1", "Insulin", "ManufacturerMSP", "Plant 1", "recalled", "AT_PLANT", "LOT1", "2026-01-01", "2028-01-01")
+	invokeOK(t, products, manufacturer,
+		"create_product", "P1", "Insulin", "ManufacturerMSP", "Plant 1", "in_good_condition", "AT_PLANT", "LOT1", "2026-01-01", "2028-01-01")
+	if status := readProduct(t, products, "P1").ProductStatus; status != "IN_GOOD_CONDITION" {
+		t.Fatalf("P1 is %s, expecting IN_GOOD_CONDITION", status)
+	}
+}
+
+// ==== Status reasons ====
+
+func TestStatusChangeNeedsReason(t *testing.T) {
+	products, _ := newProductChannel()
+	createTestProduct(t, products, "P1")
+
+	invokeFails(t, products, distributor, "Unknown reason code: FELL_OFF",
+		"update_product_status", "P1", "suspect", "FELL_OFF")
+	invokeFails(t, products, distributor, "Reason code OTHER needs a comment",
+		"update_product_status", "P1", "suspect", "other", " ")
+	invokeFails(t, products, distributor, "Evidence hash must be a hex SHA-256 digest",
+		"update_product_status", "P1", "suspect", "SEAL_BROKEN", "seal torn", "abc123")
+	if status := readProduct(t, products, "P1").ProductStatus; status != "IN_GOOD_CONDITION" {
+		t.Fatalf("P1 is %s after refused changes, expecting IN_GOOD_CONDITION", status)
+	}
+
+	EvidenceHash := strings.Repeat("AB", 32)
+	ChangeDate := products.Channel().Now.Format(time.RFC3339)
+	invokeOK(t, products, distributor, "update_product_status", "P1", "suspect", "seal_broken", "seal torn", EvidenceHash)
+	changes := []StatusChange{}
+	if err := json.Unmarshal(invokeOK(t, products, distributor, "status_changes", "P1"), &changes); err != nil {
+		t.Fatal(err)
+	}
+	recorded := []StatusChange{}
+	for _, change := range changes {
+		if change.Field == "ProductStatus" {
+			recorded = append(recorded, change)
+		}
+	}
+	if len(recorded) != 1 {
+		t.Fatalf("status changes of P1 = %+v, expecting one product status change", changes)
+	}
+	change := recorded[0]
+	if change.FromStatus != "IN_GOOD_CONDITION" || change.ToStatus != "SUSPECT" || change.ReasonCode != "SEAL_BROKEN" ||
+		change.Comment != "seal torn" || change.EvidenceHash != strings.ToLower(EvidenceHash) {
+		t.Fatalf("status change = %+v, expecting SUSPECT for a broken seal with its comment and evidence", change)
+	}
+	if !strings.HasPrefix(change.ChangedBy, "DistributorMSP/") || change.ChangeDate != ChangeDate {
+		t.Fatalf("status change by %s on %s, expecting the DistributorMSP caller at the transaction time", change.ChangedBy, change.ChangeDate)
+	}
+}
+
+func TestOtherReasonWithComment(t *testing.T) {
+	products, _ := newProductChannel()
+	createTestProduct(t, products, "P1")
+	invokeOK(t, products, distributor, "update_product_status", "P1", "suspect", "OTHER", "label smudged")
+	if status := readProduct(t, products, "P1").ProductStatus; status != "SUSPECT" {
+		t.Fatalf("P1 is %s, expecting SUSPECT", status)
+	}
+}
+
+// ==== Quarantine and QA release ====
+
+func TestReceivedGoodsWaitForQARelease(t *testing.T) {
+	products, _ := newProductChannel()
+	createTestProduct(t, products, "P1")
+	qa := chaincodetest.Identity("DistributorMSP", "qa")
+	invokeOK(t, products, manufacturer, "transfer_product", "P1", "DistributorMSP", "Warehouse")
+	if status := readProduct(t, products, "P1").QAStatus; status != "QUARANTINED" {
+		t.Fatalf("P1 is %q on receipt, expecting QUARANTINED", status)
+	}
+	invokeFails(t, products, distributor, "product P1 is QUARANTINED, it needs QA release before it can be sold on",
+		"transfer_product", "P1", "HospitalMSP", "Pharmacy")
+
+	invokeFails(t, products, distributor, "Only a QA identity can change the QA status", "qa_decision", "P1", "RELEASED")
+	invokeFails(t, products, qa, "QA decision must be RELEASED or REJECTED", "qa_decision", "P1", "OK")
+	invokeOK(t, products, qa, "qa_decision", "P1", "released", "visual check passed")
+	invokeFails(t, products, qa, "product is not quarantined: P1", "qa_decision", "P1", "REJECTED")
+	invokeOK(t, products, distributor, "transfer_product", "P1", "HospitalMSP", "Pharmacy")
+
+	invokeFails(t, products, hospital, "Only a QA identity can change the QA status", "quarantine_product", "P1", "cold chain broken")
+	hospitalQA := chaincodetest.Identity("HospitalMSP", "qa")
+	invokeOK(t, products, hospitalQA, "qa_decision", "P1", "REJECTED", "cold chain broken")
+	invokeFails(t, products, hospital, "product P1 is REJECTED, it needs QA release before it can be sold on",
+		"transfer_product", "P1", "DistributorMSP", "Warehouse")
+	// a rejection stands on the way back
+	invokeOK(t, products, hospital, "transfer_product", "P1", "DistributorMSP", "Warehouse", "RETURN")
+	if status := readProduct(t, products, "P1").QAStatus; status != "REJECTED" {
+		t.Fatalf("P1 is %q after its return, expecting it to stay REJECTED", status)
+	}
+}
+
+func TestQuarantinedBatchIsNotSoldOn(t *testing.T) {
+	products, _ := newProductChannel()
+	createTestProduct(t, products, "P1")
+	qa := chaincodetest.Identity("ManufacturerMSP", "qa")
+
+	invokeFails(t, products, manufacturer, "Only a QA identity can change the QA status", "quarantine_batch", "LOT1", "out of specification")
+	invokeFails(t, products, qa, "batch is not quarantined: LOT1", "qa_batch_decision", "LOT1", "RELEASED")
+	invokeOK(t, products, qa, "quarantine_batch", "LOT1", "out of specification")
+	invokeFails(t, products, qa, "batch is already quarantined: LOT1", "quarantine_batch", "LOT1", "again")
+	invokeFails(t, products, manufacturer, "batch LOT1 is QUARANTINED, its products cannot be sold on",
+		"transfer_product", "P1", "DistributorMSP", "Warehouse")
+	invokeOK(t, products, manufacturer, "transfer_product", "P1", "DistributorMSP", "Warehouse", "DESTRUCTION")
+
+	createTestProduct(t, products, "P2")
+	invokeOK(t, products, qa, "qa_batch_decision", "LOT1", "RELEASED", "retest passed")
+	invokeOK(t, products, manufacturer, "transfer_product", "P2", "DistributorMSP", "Warehouse")
+}
+
+// ==== Decommissioning ====
+
+func TestDecommissionLeavesTombstone(t *testing.T) {
+	products, _ := newProductChannel()
+	createTestProduct(t, products, "P1")
+	createTestProduct(t, products, "P2")
+	const Case = "340123450000000017"
+	invokeOK(t, products, manufacturer, "aggregate", Case, "P1", "P2")
+
+	invokeFails(t, products, manufacturer, "Only a regulator or QA identity can decommission a product",
+		"decommission", "P1", "STOLEN", "taken from the truck")
+	invokeFails(t, products, regulator, "Unknown decommission reason MISSING", "decommission", "P1", "missing", "taken from the truck")
+	invokeFails(t, products, regulator, "A comment is required to decommission a product", "decommission", "P1", "STOLEN", " ")
+	invokeOK(t, products, regulator, "decommission", "P1", "stolen", "taken from the truck")
+	invokeFails(t, products, regulator, "product P1 was already decommissioned on", "decommission", "P1", "LOST", "again")
+
+	product := readProduct(t, products, "P1")
+	if product.ProductStatus != "DECOMMISSIONED" || product.DecommissionReason != "STOLEN" || product.ContainerId != "" ||
+		!strings.HasPrefix(product.DecommissionedBy, "RegulatorMSP/") || product.Holder != "ManufacturerMSP" {
+		t.Fatalf("P1 = %+v, expecting a STOLEN tombstone out of its case that still shows its holder", product)
+	}
+	if parents := containersOf(t, products, "P2"); parents != Case {
+		t.Fatalf("P2 is packed in %q, expecting the case to keep it", parents)
+	}
+	invokeFails(t, products, regulator, "product P1 was decommissioned as STOLEN and cannot be changed",
+		"update_product_status", "P1", "suspect", "DATA_CORRECTION", "found again")
+	invokeFails(t, products, manufacturer, "product P1 was decommissioned as STOLEN and cannot be changed",
+		"transfer_product", "P1", "DistributorMSP", "Warehouse")
+}
+
+func TestDecommissionPurgesPatientReference(t *testing.T) {
+	products, _ := newProductChannel()
+	createTestProduct(t, products, "P1")
+	qa := chaincodetest.Identity("HospitalMSP", "qa")
+	invokeOK(t, products, manufacturer, "transfer_product", "P1", "HospitalMSP", "Pharmacy")
+	invokeOK(t, products, qa, "qa_decision", "P1", "RELEASED")
+	invokeOK(t, products, hospital, "dispense_product", "P1", "ICU", "PT-0001")
+
+	invokeFails(t, products, qa, "purge must be true or false", "decommission", "P1", "DESTROYED", "patient asked", "yes")
+	invokeOK(t, products, qa, "decommission", "P1", "DESTROYED", "patient asked", "true")
+	product := readProduct(t, products, "P1")
+	if product.Holder != "" || product.CurrentLocation != "" || product.DispensedAt != "" || len(product.PurgedStateHash) != 64 {
+		t.Fatalf("P1 = %+v, expecting the holder and locations purged and a hash of them kept", product)
+	}
+	consumptionKey, _ := products.CreateCompositeKey("consumption", []string{"HospitalMSP", "P1"})
+	consumption := Consumption{}
+	if err := json.Unmarshal(products.State[consumptionKey], &consumption); err != nil {
+		t.Fatal(err)
+	}
+	if consumption.PatientReference != "" || len(consumption.PurgedStateHash) != 64 {
+		t.Fatalf("consumption = %+v, expecting the patient reference purged and a hash of it kept", consumption)
+	}
+}
+
+// ==== Recalls ====
+
+func TestRecallBatchByManufacturer(t *testing.T) {
+	products, _ := newProductChannel()
+	createTestProduct(t, products, "P1")
+	invokeOK(t, products, manufacturer, "transfer_product", "P1", "DistributorMSP", "Warehouse")
+
+	invokeFails(t, products, distributor, "Only the manufacturer of batch LOT1", "recall_batch", "LOT1", "sterility")
+	invokeFails(t, products, outsider, "Make must be the MSP of the caller",
+		"create_product", "P2", "Insulin", "ManufacturerMSP", "Plant 1", "IN_GOOD_CONDITION", "AT_PLANT", "LOT1", "2026-01-01", "2028-01-01")
+	invokeOK(t, products, manufacturer, "recall_batch", "LOT1", "sterility")
+	if status := readProduct(t, products, "P1").ProductStatus; status != "RECALLED" {
+		t.Fatalf("P1 is %s, expecting RECALLED", status)
+	}
+}
+
+func TestRecallBatchByRegulator(t *testing.T) {
+	products, _ := newProductChannel()
+	createTestProduct(t, products, "P1")
+
+	invokeOK(t, products, regulator, "recall_batch", "LOT1", "sterility")
+	if status := readProduct(t, products, "P1").ProductStatus; status != "RECALLED" {
+		t.Fatalf("P1 is %s, expecting RECALLED", status)
+	}
+}
+
+// ==== Transfers ====
+
+func TestTransferOnlyByHolder(t *testing.T) {
+	products, _ := newProductChannel()
+	createTestProduct(t, products, "P1")
+	createTestProduct(t, products, "P2")
+	invokeOK(t, products, manufacturer, "aggregate", "340123450000000017", "P2")
+
+	invokeFails(t, products, distributor, "Only the holder of P1, ManufacturerMSP, can transfer it",
+		"transfer_product", "P1", "DistributorMSP", "Warehouse")
+	invokeFails(t, products, distributor, "Only the holder of P2, ManufacturerMSP, can transfer it",
+		"transfer_container", "340123450000000017", "DistributorMSP", "Warehouse")
+
+	invokeOK(t, products, manufacturer, "transfer_product", "P1", "DistributorMSP", "Warehouse")
+	invokeOK(t, products, manufacturer, "transfer_container", "340123450000000017", "DistributorMSP", "Warehouse")
+	for _, Uuid := range []string{"P1", "P2"} {
+		if holder := readProduct(t, products, Uuid).Holder; holder != "DistributorMSP" {
+			t.Fatalf("%s is held by %s, expecting DistributorMSP", Uuid, holder)
+		}
+	}
+	invokeFails(t, products, manufacturer, "Only the holder of P1, DistributorMSP, can transfer it",
+		"transfer_product", "P1", "ManufacturerMSP", "Plant 1")
+}
+
+// ==== Returns ====
+
+func TestReturnActorsAreCallers(t *testing.T) {
+	products, _ := newProductChannel()
+	createTestProduct(t, products, "P1")
+	invokeOK(t, products, manufacturer, "transfer_product", "P1", "DistributorMSP", "Warehouse")
+
+	invokeFails(t, products, outsider, "product P1 is not held by OutsiderMSP", "request_return", "RMA1", "ManufacturerMSP", "damaged", "P1")
+	invokeOK(t, products, distributor, "request_return", "RMA1", "ManufacturerMSP", "damaged", "P1")
+	rma := Return{}
+	if err := json.Unmarshal(invokeOK(t, products, distributor, "search_return", "RMA1"), &rma); err != nil {
+		t.Fatal(err)
+	}
+	if rma.RequestedBy != "DistributorMSP" {
+		t.Fatalf("RequestedBy = %s, expecting the caller DistributorMSP", rma.RequestedBy)
+	}
+
+	invokeFails(t, products, distributor, "expecting ManufacturerMSP", "approve_return", "RMA1", "APPROVED")
+	invokeOK(t, products, manufacturer, "approve_return", "RMA1", "APPROVED")
+	invokeFails(t, products, manufacturer, "expecting DistributorMSP", "ship_return", "RMA1", "SHIP1")
+	invokeOK(t, products, distributor, "ship_return", "RMA1", "SHIP1")
+	invokeFails(t, products, distributor, "expecting ManufacturerMSP", "receive_return", "RMA1", "Plant 1")
+	invokeOK(t, products, manufacturer, "receive_return", "RMA1", "Plant 1")
+	if holder := readProduct(t, products, "P1").Holder; holder != "ManufacturerMSP" {
+		t.Fatalf("P1 is held by %s after the return, expecting ManufacturerMSP", holder)
+	}
+	invokeFails(t, products, distributor, "expecting ManufacturerMSP", "restock_return", "RMA1")
+	invokeOK(t, products, manufacturer, "restock_return", "RMA1")
+}
+
+// ==== Hospital dispensing ====
+
+func TestDispenseByCallerHospital(t *testing.T) {
+	products, _ := newProductChannel()
+	createTestProduct(t, products, "P1")
+	qa := chaincodetest.Identity("HospitalMSP", "qa")
+	invokeOK(t, products, manufacturer, "transfer_product", "P1", "DistributorMSP", "Warehouse")
+	invokeOK(t, products, qa, "qa_decision", "P1", "RELEASED")
+	invokeOK(t, products, distributor, "transfer_product", "P1", "HospitalMSP", "Pharmacy")
+	invokeOK(t, products, qa, "qa_decision", "P1", "RELEASED")
+
+	invokeFails(t, products, distributor, "product P1 is not held by DistributorMSP", "dispense_product", "P1", "ICU", "PT-0001")
+	invokeOK(t, products, hospital, "dispense_product", "P1", "ICU", "PT-0001")
+	if product := readProduct(t, products, "P1"); product.DispensedAt != "HospitalMSP" || product.ProductStatus != "DISPENSED" {
+		t.Fatalf("P1 is %s at %q, expecting DISPENSED at the caller HospitalMSP", product.ProductStatus, product.DispensedAt)
+	}
+	report := ConsumptionReport{}
+	if err := json.Unmarshal(invokeOK(t, products, hospital, "hospital_consumption", "HospitalMSP"), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Records) != 1 || report.Records[0].Hospital != "HospitalMSP" {
+		t.Fatalf("consumption of HospitalMSP = %+v, expecting P1", report.Records)
+	}
+}
+
+// ==== Product verification ====
+
+func TestVerificationRequestedByCaller(t *testing.T) {
+	products, _ := newProductChannel()
+
+	invokeFails(t, products, hospital, "Expecting GTIN, serial, lot and expiry",
+		"verify_product_identifier", "09506000134352", "S1", "LOT1", "280101", "SomeoneElseMSP")
+	verification := Verification{}
+	payload := invokeOK(t, products, hospital, "verify_product_identifier", "09506000134352", "S1", "LOT1", "280101")
+	if err := json.Unmarshal(payload, &verification); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(verification.RequestedBy, "HospitalMSP/") || verification.Result != "UNKNOWN" {
+		t.Fatalf("verification = %+v, expecting an UNKNOWN result requested by the HospitalMSP caller", verification)
+	}
+}